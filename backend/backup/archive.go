@@ -0,0 +1,366 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/pkg/errors"
+)
+
+//  Version is the version of the archive format written
+const Version int = 1
+
+const (
+	recordKind  string = "record"
+	historyKind string = "history"
+	endKind     string = "end"
+)
+
+//  ErrPassphraseRequired is returned when opening an encrypted archive without
+//  a passphrase
+var ErrPassphraseRequired error = errors.New("archive is encrypted, a passphrase is required")
+
+//  ErrTruncated is returned when an archive ends prior to the trailer, e.g. the
+//  snapshot failed part way through
+var ErrTruncated error = errors.New("archive is truncated")
+
+//  gzipMagic is the header of a gzip stream, used to detect an unencrypted
+//  archive
+var gzipMagic []byte = []byte{0x1f, 0x8b}
+
+//  An archive is a (optionally OpenPGP symmetrically encrypted) gzip stream of
+//  JSON lines, consisting of a header, the records, the historical entries, and
+//  a trailer with the counts to detect truncation:
+//
+//  	{"version":1,"created":1549411200000000000}
+//  	{"kind":"record","key":"...","value":"<base64>"}
+//  	{"kind":"history","key":"...","value":"<base64>"}
+//  	{"kind":"end","records":1,"history":1}
+//
+//  Values are stored as is, so values encrypted at rest remain encrypted.
+type header struct {
+	Version int   `json:"version"`
+	Created int64 `json:"created"`
+}
+
+type entry struct {
+	Kind  string `json:"kind"`
+	Key   string `json:"key,omitempty"`
+	Value []byte `json:"value,omitempty"`
+
+	//  only set for the trailer
+	Records int `json:"records,omitempty"`
+	History int `json:"history,omitempty"`
+}
+
+//  Summary is the number of records and historical entries in an archive
+type Summary struct {
+	Records int
+	History int
+}
+
+//  Writer writes an archive. All records must be written prior to the history.
+type Writer struct {
+	enc io.WriteCloser
+	gz  *gzip.Writer
+	out *json.Encoder
+
+	sum     Summary
+	history bool
+}
+
+//  NewWriter starts a new archive, encrypted with the passphrase if provided
+func NewWriter(w io.Writer, passphrase []byte) (*Writer, error) {
+	aw := &Writer{}
+
+	if len(passphrase) > 0 {
+		enc, err := openpgp.SymmetricallyEncrypt(w, passphrase, nil, &packet.Config{
+			DefaultHash:   crypto.SHA512,
+			DefaultCipher: packet.CipherAES256,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to start archive encryption")
+		}
+
+		aw.enc, w = enc, enc
+	}
+
+	aw.gz = gzip.NewWriter(w)
+	aw.out = json.NewEncoder(aw.gz)
+
+	if err := aw.out.Encode(&header{Version: Version, Created: time.Now().UnixNano()}); err != nil {
+		return nil, errors.Wrap(err, "unable to write archive header")
+	}
+
+	return aw, nil
+}
+
+//  Record adds a record to the archive
+func (w *Writer) Record(key string, value []byte) error {
+	if w.history {
+		return errors.New("records must be written prior to the history")
+	}
+
+	if err := w.out.Encode(&entry{Kind: recordKind, Key: key, Value: value}); err != nil {
+		return errors.Wrapf(err, "unable to write record for key %s", key)
+	}
+
+	w.sum.Records++
+	return nil
+}
+
+//  History adds a historical entry to the archive
+func (w *Writer) History(hkey string, value []byte) error {
+	w.history = true
+
+	if err := w.out.Encode(&entry{Kind: historyKind, Key: hkey, Value: value}); err != nil {
+		return errors.Wrapf(err, "unable to write historical for key %s", hkey)
+	}
+
+	w.sum.History++
+	return nil
+}
+
+//  Close writes the trailer and flushes the archive, returning the summary of
+//  the entries written. The underlying writer is not closed.
+func (w *Writer) Close() (*Summary, error) {
+	if err := w.out.Encode(&entry{Kind: endKind, Records: w.sum.Records, History: w.sum.History}); err != nil {
+		return nil, errors.Wrap(err, "unable to write archive trailer")
+	}
+
+	if err := w.gz.Close(); err != nil {
+		return nil, errors.Wrap(err, "unable to flush archive")
+	}
+
+	if w.enc != nil {
+		if err := w.enc.Close(); err != nil {
+			return nil, errors.Wrap(err, "unable to flush archive encryption")
+		}
+	}
+
+	sum := w.sum
+	return &sum, nil
+}
+
+//  Reader reads an archive, providing the records and then the history as
+//  backend.Iterators (see Records and History).
+type Reader struct {
+	src io.Reader
+	in  *json.Decoder
+
+	Created time.Time
+
+	cur  *entry
+	sum  Summary
+	done bool
+	err  error
+}
+
+//  NewReader opens the archive, decrypting it with the passphrase if it is
+//  encrypted
+func NewReader(r io.Reader, passphrase []byte) (*Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read archive")
+	}
+
+	var src io.Reader = br
+	if !bytes.Equal(magic, gzipMagic) {
+		if len(passphrase) < 1 {
+			return nil, ErrPassphraseRequired
+		}
+
+		prompted := false
+		md, err := openpgp.ReadMessage(br, nil, func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+			//  called again if the passphrase fails to decrypt
+			if prompted {
+				return nil, errors.New("invalid passphrase")
+			}
+			prompted = true
+			return passphrase, nil
+		}, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decrypt archive")
+		}
+
+		//  the integrity check is made once the body is read to EOF, reading
+		//  again afterwards fails
+		src = &sticky{r: md.UnverifiedBody}
+	}
+
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decompress archive")
+	}
+
+	ar := &Reader{src: src, in: json.NewDecoder(gz)}
+
+	h := &header{}
+	if err := ar.in.Decode(h); err != nil {
+		return nil, errors.Wrap(err, "unable to read archive header")
+	}
+
+	if h.Version != Version {
+		return nil, errors.Errorf("archive version %d is not supported", h.Version)
+	}
+	ar.Created = time.Unix(0, h.Created)
+
+	return ar, nil
+}
+
+//  sticky returns the first error (including io.EOF) from the reader for every
+//  subsequent read
+type sticky struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sticky) Read(p []byte) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	n, err := s.r.Read(p)
+	s.err = err
+	return n, err
+}
+
+//  peek returns the next entry without consuming it or nil once the trailer
+//  has been read or an error occurred
+func (r *Reader) peek() *entry {
+	if r.cur != nil || r.done || r.err != nil {
+		return r.cur
+	}
+
+	e := &entry{}
+	if err := r.in.Decode(e); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			r.err = ErrTruncated
+		} else {
+			r.err = errors.Wrap(err, "unable to read archive entry")
+		}
+		return nil
+	}
+
+	switch e.Kind {
+	case recordKind, historyKind:
+		r.cur = e
+
+	case endKind:
+		r.done = true
+		if e.Records != r.sum.Records || e.History != r.sum.History {
+			r.err = errors.Errorf("archive trailer expected %d records and %d history, read %d and %d",
+				e.Records, e.History, r.sum.Records, r.sum.History)
+			return nil
+		}
+
+		//  the remainder must be drained for the decryption integrity check
+		//  (if encrypted) to be made
+		if _, err := io.Copy(ioutil.Discard, r.src); err != nil {
+			r.err = errors.Wrap(err, "unable to verify archive")
+		}
+
+	default:
+		r.err = errors.Errorf("unknown archive entry kind %s", e.Kind)
+	}
+
+	return r.cur
+}
+
+//  take consumes the next entry if it is of the kind
+func (r *Reader) take(kind string) *entry {
+	e := r.peek()
+	if e == nil || e.Kind != kind {
+		return nil
+	}
+
+	r.cur = nil
+	if kind == recordKind {
+		r.sum.Records++
+	} else {
+		r.sum.History++
+	}
+
+	return e
+}
+
+//  Records returns an iterator over the records of the archive
+func (r *Reader) Records() *Iterator {
+	return &Iterator{r: r, kind: recordKind}
+}
+
+//  History returns an iterator over the historical entries of the archive. Any
+//  records not yet read are skipped.
+func (r *Reader) History() *Iterator {
+	return &Iterator{r: r, kind: historyKind}
+}
+
+//  Summary returns the number of records and historical entries read, once the
+//  archive has been read in full
+func (r *Reader) Summary() (*Summary, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if !r.done {
+		return nil, errors.New("archive has not been read in full")
+	}
+
+	sum := r.sum
+	return &sum, nil
+}
+
+//  Iterator iterates over the records or historical entries of an archive,
+//  implementing backend.Iterator
+type Iterator struct {
+	r    *Reader
+	kind string
+	cur  *entry
+}
+
+func (it *Iterator) Next() bool {
+	if it.kind == historyKind {
+		for it.r.take(recordKind) != nil {
+		}
+	}
+
+	it.cur = it.r.take(it.kind)
+	if it.cur == nil && it.kind == historyKind && !it.r.done && it.r.err == nil {
+		it.r.err = errors.New("unexpected record following the history")
+	}
+
+	return it.cur != nil
+}
+
+func (it *Iterator) Key() string {
+	if it.cur == nil {
+		return ""
+	}
+	return it.cur.Key
+}
+
+func (it *Iterator) Value() []byte {
+	if it.cur == nil {
+		return nil
+	}
+	return it.cur.Value
+}
+
+func (it *Iterator) Err() error {
+	return it.r.err
+}
+
+func (it *Iterator) Close() error {
+	return nil
+}
@@ -0,0 +1,110 @@
+package backup
+
+import (
+	"context"
+	"io"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	"github.com/manulife-gwam/peppermint-sparkles/backend/mirror"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+//  Write streams every record and historical entry of the datastore to the
+//  writer as an archive, encrypted with the passphrase if provided. Values are
+//  written as stored, so the raw backend (rather than a decrypting wrapper)
+//  should be backed up to keep values encrypted at rest within the archive.
+//
+//  The archive is a consistent snapshot if the datastore is a
+//  backend.Snapshotter (point in time for the file datastore, and with the
+//  history of every record included for redis), otherwise the records and
+//  history are iterated with a warning, since writes made during the backup
+//  may or may not be included (e.g. a record without the history written
+//  alongside it).
+func Write(ctx context.Context, w io.Writer, ds backend.Datastore, passphrase []byte) (*Summary, error) {
+	aw, err := NewWriter(w, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if snap, ok := ds.(backend.Snapshotter); ok {
+		err = snap.Snapshot(ctx, aw.Record, aw.History)
+	} else {
+		log.Warnf("%T does not support consistent snapshots, so the backup may include only part of the writes made while it is taken", ds)
+
+		err = iterate(ds.Iterate(ctx, ""), aw.Record)
+		if err == nil {
+			err = iterate(ds.IterateHistory(ctx, ""), aw.History)
+		}
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to backup datastore")
+	}
+
+	return aw.Close()
+}
+
+func iterate(it backend.Iterator, fn func(key string, value []byte) error) error {
+	defer it.Close()
+
+	for it.Next() {
+		if err := fn(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+
+	return it.Err()
+}
+
+//  Transcode reads the archive and writes it anew, encrypted with the new
+//  passphrase if provided, verifying it is complete in the process
+func Transcode(r io.Reader, passphrase []byte, w io.Writer, newPassphrase []byte) (*Summary, error) {
+	ar, err := NewReader(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	aw, err := NewWriter(w, newPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := iterate(ar.Records(), aw.Record); err != nil {
+		return nil, err
+	}
+
+	if err := iterate(ar.History(), aw.History); err != nil {
+		return nil, err
+	}
+
+	if _, err := ar.Summary(); err != nil {
+		return nil, err
+	}
+
+	return aw.Close()
+}
+
+//  Restore loads the archive into the datastore as per mirror.Copy, i.e.
+//  existing records are only overwritten if requested and restoring the same
+//  archive twice does not duplicate history. The records are restored even if
+//  the archive is later found to be truncated, in which case an error is
+//  returned alongside the report.
+func Restore(ctx context.Context, r io.Reader, passphrase []byte, to backend.Datastore, overwrite bool) (*mirror.Report, error) {
+	ar, err := NewReader(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := mirror.CopyFrom(ctx, ar.Records(), ar.History(), to, overwrite)
+	if err != nil {
+		return report, err
+	}
+
+	if _, err := ar.Summary(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,175 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/pkg/errors"
+)
+
+func open(t *testing.T) (*fileds.Datastore, func()) {
+	what := fmt.Sprintf("psparkles_testing_%d.db", time.Now().UnixNano())
+	ds, err := fileds.Open(what, &bolt.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds, func() {
+		ds.Close()
+		os.RemoveAll(what)
+	}
+}
+
+func seed(t *testing.T, ds backend.Datastore) {
+	ctx := context.Background()
+	for _, k := range []string{"a", "b", "c"} {
+		if err := ds.SetIfAbsent(ctx, k, []byte(k), []byte("h"+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ds.CompareAndSwap(ctx, "a", []byte("a"), []byte("a2"), []byte("ha2")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		passphrase []byte
+	}{
+		{name: "plain"},
+		{name: "encrypted", passphrase: []byte("sparkles")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			from, done := open(t)
+			defer done()
+
+			to, done := open(t)
+			defer done()
+
+			seed(t, from)
+			ctx := context.Background()
+
+			buf := &bytes.Buffer{}
+			sum, err := Write(ctx, buf, from, tc.passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sum.Records != 3 || sum.History != 4 {
+				t.Errorf("want 3 records and 4 history, got %+v", sum)
+			}
+
+			raw := buf.Bytes()
+			if encrypted := !bytes.HasPrefix(raw, gzipMagic); encrypted != (tc.passphrase != nil) {
+				t.Errorf("want encrypted %t, got %t", tc.passphrase != nil, encrypted)
+			}
+
+			r, err := Restore(ctx, bytes.NewReader(raw), tc.passphrase, to, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Records != 3 || r.History != 4 {
+				t.Errorf("want 3 records and 4 history restored, got %+v", r)
+			}
+
+			if got, err := to.Get(ctx, "a"); err != nil || string(got) != "a2" {
+				t.Errorf("want a2, got %s with error %v", got, err)
+			}
+
+			//  restoring again must not duplicate anything
+			if r, err = Restore(ctx, bytes.NewReader(raw), tc.passphrase, to, false); err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Records != 0 || r.History != 0 || r.Skipped != 7 {
+				t.Errorf("want everything skipped, got %+v", r)
+			}
+		})
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	ds, done := open(t)
+	defer done()
+
+	seed(t, ds)
+
+	buf := &bytes.Buffer{}
+	if _, err := Write(context.Background(), buf, ds, []byte("sparkles")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(buf.Bytes()), nil); err != ErrPassphraseRequired {
+		t.Errorf("want ErrPassphraseRequired, got %v", err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(buf.Bytes()), []byte("glitter")); err == nil {
+		t.Error("want error for the wrong passphrase")
+	}
+
+	//  re-encrypt with a new passphrase and then decrypt entirely
+	enc, plain := &bytes.Buffer{}, &bytes.Buffer{}
+	if _, err := Transcode(bytes.NewReader(buf.Bytes()), []byte("sparkles"), enc, []byte("glitter")); err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := Transcode(enc, []byte("glitter"), plain, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sum.Records != 3 || sum.History != 4 || !bytes.HasPrefix(plain.Bytes(), gzipMagic) {
+		t.Errorf("want plain archive with 3 records and 4 history, got %+v", sum)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	aw, err := NewWriter(buf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := aw.Record("a", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := aw.History("a.1", []byte("ha")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := aw.Record("b", []byte("b")); err == nil {
+		t.Error("want error for a record following the history")
+	}
+
+	//  flush without the trailer
+	if err := aw.gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	to, done := open(t)
+	defer done()
+
+	r, err := Restore(context.Background(), buf, nil, to, false)
+	if err == nil || errors.Cause(err) != ErrTruncated {
+		t.Errorf("want ErrTruncated, got %v", err)
+	}
+
+	if r == nil || r.Records != 1 {
+		t.Errorf("want the record restored regardless, got %+v", r)
+	}
+}
@@ -0,0 +1,273 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//  Invalidator broadcasts the keys modified by an instance so that every
+//  instance sharing the backend can drop them from its cache.
+type Invalidator interface {
+	//  Publish notifies all listeners that the key has been modified
+	Publish(ctx context.Context, key string) error
+
+	//  Listen calls fn with each key published until the context is cancelled
+	//  or the subscription fails
+	Listen(ctx context.Context, fn func(key string)) error
+}
+
+//  Config is the configuration of the cache
+type Config struct {
+	//  Size is the max number of records held, with the least recently used
+	//  evicted first
+	Size int
+
+	//  TTL is the max duration a record is held. A zero value means records
+	//  are only evicted when modified or the cache is full.
+	TTL time.Duration
+
+	//  Invalidator is the optional broadcaster used to invalidate the records
+	//  modified by other instances
+	Invalidator Invalidator
+}
+
+//  retry is the delay prior to re-subscribing after the invalidation
+//  subscription fails
+const retry time.Duration = time.Second
+
+type entry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+//  Datastore wraps a backend.Datastore, holding the records retrieved with Get
+//  in a bounded LRU cache. Records are invalidated when written or removed
+//  through the cache and, if an Invalidator is configured, when modified by
+//  any other instance. Missing records, iteration, and history are not cached.
+type Datastore struct {
+	ds  backend.Datastore
+	cfg *Config
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+
+	//  gen is incremented on every invalidation, preventing a value retrieved
+	//  prior to an invalidation from being cached after it
+	gen uint64
+
+	cancel context.CancelFunc
+}
+
+//  Wrap returns a caching datastore for the provided datastore. If an
+//  Invalidator is configured, it is listened to until the datastore is closed.
+func Wrap(ds backend.Datastore, cfg *Config) *Datastore {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	c := &Datastore{
+		ds:     ds,
+		cfg:    cfg,
+		ll:     list.New(),
+		items:  make(map[string]*list.Element),
+		cancel: cancel,
+	}
+
+	if cfg.Invalidator != nil {
+		go c.listen(ctx)
+	}
+
+	return c
+}
+
+func (c *Datastore) listen(ctx context.Context) {
+	for {
+		err := c.cfg.Invalidator.Listen(ctx, c.invalidate)
+		if ctx.Err() != nil {
+			return
+		}
+
+		//  invalidations may have been missed while not subscribed
+		log.Error(err, "cache invalidation subscription failed, purging cache")
+		c.Purge()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retry):
+		}
+	}
+}
+
+//  Purge removes all records from the cache
+func (c *Datastore) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+//  invalidate removes the record for the key from the cache
+func (c *Datastore) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	if el, ok := c.items[key]; ok {
+		c.ll.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+//  modified invalidates the key locally and broadcasts the invalidation. The
+//  write has already been made, so a failure to broadcast is only logged and
+//  other instances will hold the stale record for at most the TTL.
+func (c *Datastore) modified(ctx context.Context, key string) {
+	c.invalidate(key)
+
+	if c.cfg.Invalidator != nil {
+		if err := c.cfg.Invalidator.Publish(ctx, key); err != nil {
+			log.Error(err, "unable to publish cache invalidation")
+		}
+	}
+}
+
+func (c *Datastore) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if c.cfg.TTL > 0 && time.Now().After(e.expires) {
+		c.ll.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *Datastore) add(gen uint64, key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen || c.cfg.Size < 1 {
+		return
+	}
+
+	e := &entry{key: key, value: value, expires: time.Now().Add(c.cfg.TTL)}
+	if el, ok := c.items[key]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.ll.PushFront(e)
+
+	for c.ll.Len() > c.cfg.Size {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.items, el.Value.(*entry).key)
+	}
+}
+
+//  Get returns the cached record if available, otherwise retrieving it from
+//  the wrapped datastore
+func (c *Datastore) Get(ctx context.Context, key string) ([]byte, error) {
+	if v, ok := c.get(key); ok {
+		return append([]byte{}, v...), nil
+	}
+
+	c.mu.Lock()
+	gen := c.gen
+	c.mu.Unlock()
+
+	v, err := c.ds.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.add(gen, key, append([]byte{}, v...))
+	return v, nil
+}
+
+//  Close stops listening for invalidations and closes the wrapped datastore
+func (c *Datastore) Close() error {
+	c.cancel()
+	return c.ds.Close()
+}
+
+func (c *Datastore) Keys(ctx context.Context) ([]string, error) {
+	return c.ds.Keys(ctx)
+}
+
+func (c *Datastore) List(ctx context.Context) ([]backend.Value, error) {
+	return c.ds.List(ctx)
+}
+
+func (c *Datastore) Set(ctx context.Context, key string, value []byte) error {
+	defer c.modified(ctx, key)
+	return c.ds.Set(ctx, key, value)
+}
+
+func (c *Datastore) Remove(ctx context.Context, key string) error {
+	defer c.modified(ctx, key)
+	return c.ds.Remove(ctx, key)
+}
+
+func (c *Datastore) AddHistory(ctx context.Context, key string, value []byte) error {
+	return c.ds.AddHistory(ctx, key, value)
+}
+
+func (c *Datastore) RemoveHistory(ctx context.Context, hkey string) error {
+	return c.ds.RemoveHistory(ctx, hkey)
+}
+
+func (c *Datastore) Historical(ctx context.Context) ([]backend.Value, error) {
+	return c.ds.Historical(ctx)
+}
+
+func (c *Datastore) Iterate(ctx context.Context, prefix string) backend.Iterator {
+	return c.ds.Iterate(ctx, prefix)
+}
+
+func (c *Datastore) IterateHistory(ctx context.Context, key string) backend.Iterator {
+	return c.ds.IterateHistory(ctx, key)
+}
+
+func (c *Datastore) SetIfAbsent(ctx context.Context, key string, value, history []byte) error {
+	if err := c.ds.SetIfAbsent(ctx, key, value, history); err != nil {
+		return err
+	}
+
+	c.modified(ctx, key)
+	return nil
+}
+
+//  CompareAndSwap always compares against the wrapped datastore rather than
+//  the cached record. On a conflict, the (stale) cached record is invalidated.
+func (c *Datastore) CompareAndSwap(ctx context.Context, key string, old, value, history []byte) error {
+	err := c.ds.CompareAndSwap(ctx, key, old, value, history)
+	switch {
+	case err == nil:
+		c.modified(ctx, key)
+
+	case backend.IsConflict(err):
+		c.invalidate(key)
+	}
+
+	return err
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+//  open opens a datastore within a temporary directory, removed along with
+//  the directory by the returned func
+func open(t *testing.T) (*fileds.Datastore, func()) {
+	dir, err := ioutil.TempDir("", "psparkles_testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds, err := fileds.Open(filepath.Join(dir, "cache.db"), &bolt.Options{})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return ds, func() {
+		ds.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+//  broker is an in-memory Invalidator shared by multiple caches
+type broker struct {
+	mu   sync.Mutex
+	subs []chan string
+}
+
+func (b *broker) Publish(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, s := range b.subs {
+		s <- key
+	}
+	return nil
+}
+
+func (b *broker) Listen(ctx context.Context, fn func(key string)) error {
+	s := make(chan string, 10)
+
+	b.mu.Lock()
+	b.subs = append(b.subs, s)
+	b.mu.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case k := <-s:
+			fn(k)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	inner, done := open(t)
+	defer done()
+
+	ctx := context.Background()
+	c := Wrap(inner, &Config{Size: 10, TTL: time.Minute})
+
+	if err := c.Set(ctx, "foo", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := c.Get(ctx, "foo"); err != nil || string(got) != "v1" {
+		t.Fatalf("want v1, got %s with error %v", got, err)
+	}
+
+	//  modified behind the cache, so the cached record should be returned
+	if err := inner.Set(ctx, "foo", []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := c.Get(ctx, "foo"); err != nil || string(got) != "v1" {
+		t.Errorf("want cached v1, got %s with error %v", got, err)
+	}
+
+	//  a conflict must invalidate the stale cached record
+	if err := c.CompareAndSwap(ctx, "foo", []byte("v1"), []byte("v3"), nil); !backend.IsConflict(err) {
+		t.Errorf("want ErrConflict, got %v", err)
+	}
+
+	if got, err := c.Get(ctx, "foo"); err != nil || string(got) != "v2" {
+		t.Errorf("want v2, got %s with error %v", got, err)
+	}
+
+	if err := c.Remove(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get(ctx, "foo"); !backend.IsNotFound(err) {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	inner, done := open(t)
+	defer done()
+
+	ctx := context.Background()
+	c := Wrap(inner, &Config{Size: 2, TTL: 50 * time.Millisecond})
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := inner.Set(ctx, k, []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := c.Get(ctx, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := c.ll.Len(); n != 2 {
+		t.Errorf("want 2 cached records, got %d", n)
+	}
+
+	if _, ok := c.get("a"); ok {
+		t.Error("want least recently used record to be evicted")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, ok := c.get("c"); ok {
+		t.Error("want expired record to be evicted")
+	}
+}
+
+func TestInvalidator(t *testing.T) {
+	inner, done := open(t)
+	defer done()
+
+	ctx, b := context.Background(), &broker{}
+
+	c1 := Wrap(inner, &Config{Size: 10, Invalidator: b})
+	defer c1.cancel()
+
+	c2 := Wrap(inner, &Config{Size: 10, Invalidator: b})
+	defer c2.cancel()
+
+	//  wait for both to subscribe
+	for i := 0; i < 100; i++ {
+		b.mu.Lock()
+		n := len(b.subs)
+		b.mu.Unlock()
+
+		if n == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := c1.Set(ctx, "foo", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := c2.Get(ctx, "foo"); err != nil || string(got) != "v1" {
+		t.Fatalf("want v1, got %s with error %v", got, err)
+	}
+
+	if err := c1.CompareAndSwap(ctx, "foo", []byte("v1"), []byte("v2"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, ok := c2.get("foo"); !ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if got, err := c2.Get(ctx, "foo"); err != nil || string(got) != "v2" {
+		t.Errorf("want v2, got %s with error %v", got, err)
+	}
+}
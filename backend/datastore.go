@@ -1,8 +1,14 @@
 package backend
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/binary"
 	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
 )
 
 const (
@@ -10,32 +16,132 @@ const (
 	File  string = "file"
 )
 
+//  ErrNotFound is returned by a Datastore when no value exists for the
+//  requested key. Any other error returned is considered a failure of the
+//  backend itself.
+var ErrNotFound error = errors.New("not found")
+
+//  ErrExists is returned by SetIfAbsent when a value already exists for the key.
+var ErrExists error = errors.New("already exists")
+
+//  ErrConflict is returned by CompareAndSwap when the current value for the key
+//  no longer matches the expected value.
+var ErrConflict error = errors.New("value has been modified")
+
 type Value map[string]string
 
+//  Datastore is the (v2) storage interface. Every call takes a context to allow
+//  for cancellation / timeouts and all failures are returned to the caller
+//  rather than being logged and swallowed.
 type Datastore interface {
 	Close() error
-	Keys() []string
-	List() ([]Value, error)
-	Set(key, value string) error
-	Get(key string) string
-	Remove(key string) error
-	AddHistory(value string) error
-	Historical() ([]Value, error)
+	Keys(ctx context.Context) ([]string, error)
+	List(ctx context.Context) ([]Value, error)
+	Set(ctx context.Context, key string, value []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Remove(ctx context.Context, key string) error
+	AddHistory(ctx context.Context, key string, value []byte) error
+	Historical(ctx context.Context) ([]Value, error)
+
+	//  Iterate returns an Iterator over the current entries with keys starting
+	//  with prefix. An empty prefix iterates over all entries.
+	Iterate(ctx context.Context, prefix string) Iterator
+
+	//  RemoveHistory deletes the historical entry for the provided historical
+	//  key (as returned by IterateHistory). No error is returned if it does not
+	//  exist.
+	RemoveHistory(ctx context.Context, hkey string) error
+
+	//  IterateHistory returns an Iterator over the historical entries of the
+	//  key. An empty key iterates over all historical entries.
+	IterateHistory(ctx context.Context, key string) Iterator
+
+	//  SetIfAbsent stores the value only if no value currently exists for the
+	//  key, returning ErrExists otherwise. If history is not nil, it is added
+	//  as a historical entry for the key in the same transaction.
+	SetIfAbsent(ctx context.Context, key string, value, history []byte) error
+
+	//  CompareAndSwap replaces the current value for the key with value only if
+	//  the current value matches old, returning ErrConflict otherwise. A nil old
+	//  expects no current value and a nil value removes the key. If history is
+	//  not nil, it is added as a historical entry for the key in the same
+	//  transaction.
+	CompareAndSwap(ctx context.Context, key string, old, value, history []byte) error
 }
 
-func Key(app, env string, values ...string) string {
-	in := make([]byte, 0)
-	for _, v := range values {
-		in = append(in, []byte(v)...)
+//  Snapshotter is implemented by a Datastore able to provide a consistent view
+//  of every record and historical entry, either as of a single point in time
+//  or at least with the history written alongside every record included.
+type Snapshotter interface {
+	//  Snapshot calls records with each record and then history with each
+	//  historical entry, each included once, stopping at the first error
+	//  returned. Values are only valid for the duration of the call.
+	Snapshot(ctx context.Context, records, history func(key string, value []byte) error) error
+}
+
+//  IsNotFound is a convenience func for checking if the (possibly wrapped)
+//  error is an ErrNotFound.
+func IsNotFound(err error) bool {
+	return errors.Cause(err) == ErrNotFound
+}
+
+//  IsExists is a convenience func for checking if the (possibly wrapped) error
+//  is an ErrExists.
+func IsExists(err error) bool {
+	return errors.Cause(err) == ErrExists
+}
+
+//  IsConflict is a convenience func for checking if the (possibly wrapped)
+//  error is an ErrConflict.
+func IsConflict(err error) bool {
+	return errors.Cause(err) == ErrConflict
+}
+
+//  HistoryKey generates a unique key for a historical entry of the provided
+//  key. The key is prefixed to allow for grouping the history of a key.
+func HistoryKey(key string, value []byte) (string, error) {
+	buf := make([]byte, 2048)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.Wrap(err, "unable to read in random data to generate key")
 	}
 
-	return fmt.Sprintf("%x%s", sha256.Sum256(in), KeySuffix(app, env))
+	//	generate SHA256 token from random content to be stored + random data to
+	// 	attempt to prevent collisions
+	return fmt.Sprintf("%s.%x", key, sha256.Sum256(append(append([]byte{}, value...), buf...))), nil
 }
 
+//  HistoryRecordKey returns the key of the record the historical key (as
+//  generated by HistoryKey) belongs to.
+func HistoryRecordKey(hkey string) string {
+	if i := strings.LastIndex(hkey, "."); i > 0 {
+		return hkey[:i]
+	}
+	return hkey
+}
+
+//  Key generates the namespaced storage key for the provided values (e.g. a
+//  secret ID), scoped to the app and environment. Neither the values nor the
+//  app and environment can be derived from the key.
+func Key(app, env string, values ...string) string {
+	return fmt.Sprintf("%x%s", hash(values...), KeySuffix(app, env))
+}
+
+//  KeySuffix generates the portion of the storage key scoping it to the app and
+//  environment.
 func KeySuffix(app, env string) string {
-	suf := make([]byte, len(app)+len(env))
-	copy(suf, []byte(app))
-	copy(suf, []byte(env))
+	return fmt.Sprintf("%x", hash(app, env))
+}
 
-	return fmt.Sprintf("%x", sha256.Sum256(suf))
+//  hash returns the SHA-256 of the fields, each length prefixed so that moving
+//  bytes from one field to the next (e.g. app "ab" and env "c" rather than app
+//  "a" and env "bc") produces a different hash
+func hash(fields ...string) []byte {
+	h := sha256.New()
+	for _, f := range fields {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(f)))
+		h.Write(n[:])
+		h.Write([]byte(f))
+	}
+	return h.Sum(nil)
 }
@@ -0,0 +1,310 @@
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+
+	"github.com/pkg/errors"
+)
+
+//  Datastore wraps a backend.Datastore, sealing every record and historical
+//  value with AES-GCM under the active master key prior to storage and opening
+//  them on retrieval. The ID of the sealing key is stored alongside the
+//  ciphertext, allowing the keyring to be swapped while running and existing
+//  values to be re-sealed with Rotate. Keys are not encrypted since they are
+//  already hashed (see backend.Key).
+//
+//  Values are bound to the key they are stored under, and whether they are a
+//  record or historical entry, so a sealed value cannot be copied elsewhere.
+//  Values not sealed and bound (i.e. written prior to enabling encryption or
+//  binding) are rejected with ErrUnsealed, unless allowed by AllowUnsealed
+//  until re-sealed by Rotate, so values cannot be planted in the backend.
+type Datastore struct {
+	ds backend.Datastore
+
+	mu       sync.RWMutex
+	keys     *kms.Keyring
+	unsealed bool
+}
+
+//  ErrUnsealed is returned for values which are not sealed and bound to their
+//  key while unsealed values are not allowed
+var ErrUnsealed error = errors.New("value is not sealed and bound to its key")
+
+//  Wrap returns an encrypting datastore for the provided datastore and keyring
+func Wrap(ds backend.Datastore, keys *kms.Keyring) *Datastore {
+	return &Datastore{ds: ds, keys: keys}
+}
+
+//  SetKeyring swaps in the keyring (e.g. reloaded after adding a new active
+//  key) for all subsequent calls
+func (ds *Datastore) SetKeyring(keys *kms.Keyring) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.keys = keys
+}
+
+//  AllowUnsealed sets whether values not sealed and bound to their key are
+//  returned as is, rather than rejected, for use until an existing datastore
+//  has been re-sealed by Rotate
+func (ds *Datastore) AllowUnsealed(allow bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.unsealed = allow
+}
+
+func (ds *Datastore) keyring() (*kms.Keyring, bool) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	return ds.keys, ds.unsealed
+}
+
+//  unseal opens the value stored under the kind and key, rejecting values which
+//  are not sealed and bound unless allowed
+func unseal(kr *kms.Keyring, unsealed bool, k kind, key string, value []byte) ([]byte, error) {
+	plain, bound, err := open(kr, k, key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bound && !unsealed {
+		return nil, errors.Wrapf(ErrUnsealed, "key %s", key)
+	}
+	return plain, nil
+}
+
+//  sealOptional seals the value, leaving a nil value as nil
+func sealOptional(kr *kms.Keyring, k kind, key string, value []byte) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return seal(kr, k, key, value)
+}
+
+func (ds *Datastore) Close() error {
+	return ds.ds.Close()
+}
+
+func (ds *Datastore) Keys(ctx context.Context) ([]string, error) {
+	return ds.ds.Keys(ctx)
+}
+
+func (ds *Datastore) List(ctx context.Context) ([]backend.Value, error) {
+	return backend.Collect(ds.Iterate(ctx, ""))
+}
+
+func (ds *Datastore) Set(ctx context.Context, key string, value []byte) error {
+	kr, _ := ds.keyring()
+
+	sealed, err := seal(kr, recordKind, key, value)
+	if err != nil {
+		return err
+	}
+	return ds.ds.Set(ctx, key, sealed)
+}
+
+func (ds *Datastore) Get(ctx context.Context, key string) ([]byte, error) {
+	raw, err := ds.ds.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	kr, unsealed := ds.keyring()
+	return unseal(kr, unsealed, recordKind, key, raw)
+}
+
+func (ds *Datastore) Remove(ctx context.Context, key string) error {
+	return ds.ds.Remove(ctx, key)
+}
+
+func (ds *Datastore) AddHistory(ctx context.Context, key string, value []byte) error {
+	kr, _ := ds.keyring()
+
+	sealed, err := seal(kr, historyKind, key, value)
+	if err != nil {
+		return err
+	}
+	return ds.ds.AddHistory(ctx, key, sealed)
+}
+
+func (ds *Datastore) RemoveHistory(ctx context.Context, hkey string) error {
+	return ds.ds.RemoveHistory(ctx, hkey)
+}
+
+func (ds *Datastore) Historical(ctx context.Context) ([]backend.Value, error) {
+	return backend.Collect(ds.IterateHistory(ctx, ""))
+}
+
+func (ds *Datastore) Iterate(ctx context.Context, prefix string) backend.Iterator {
+	kr, unsealed := ds.keyring()
+	return &iterator{Iterator: ds.ds.Iterate(ctx, prefix), keys: kr, unsealed: unsealed, kind: recordKind}
+}
+
+func (ds *Datastore) IterateHistory(ctx context.Context, key string) backend.Iterator {
+	kr, unsealed := ds.keyring()
+	return &iterator{Iterator: ds.ds.IterateHistory(ctx, key), keys: kr, unsealed: unsealed, kind: historyKind}
+}
+
+func (ds *Datastore) SetIfAbsent(ctx context.Context, key string, value, history []byte) error {
+	kr, _ := ds.keyring()
+
+	sealed, err := seal(kr, recordKind, key, value)
+	if err != nil {
+		return err
+	}
+
+	hist, err := sealOptional(kr, historyKind, key, history)
+	if err != nil {
+		return err
+	}
+
+	return ds.ds.SetIfAbsent(ctx, key, sealed, hist)
+}
+
+//  CompareAndSwap compares old against the opened current value since sealing
+//  the same value twice never results in the same ciphertext. The swap is then
+//  made against the current ciphertext, so a write between the retrieval and
+//  swap still results in a backend.ErrConflict.
+func (ds *Datastore) CompareAndSwap(ctx context.Context, key string, old, value, history []byte) error {
+	kr, unsealed := ds.keyring()
+
+	var cur []byte
+	if old != nil {
+		raw, err := ds.ds.Get(ctx, key)
+		if err != nil {
+			if backend.IsNotFound(err) {
+				return backend.ErrConflict
+			}
+			return err
+		}
+
+		plain, err := unseal(kr, unsealed, recordKind, key, raw)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(plain, old) {
+			return backend.ErrConflict
+		}
+		cur = raw
+	}
+
+	sealed, err := sealOptional(kr, recordKind, key, value)
+	if err != nil {
+		return err
+	}
+
+	hist, err := sealOptional(kr, historyKind, key, history)
+	if err != nil {
+		return err
+	}
+
+	return ds.ds.CompareAndSwap(ctx, key, cur, sealed, hist)
+}
+
+//  Rotate re-seals every record and historical value not sealed with the
+//  active key and bound to its key (including values written prior to
+//  enabling encryption, regardless of AllowUnsealed),
+//  returning the number of values re-sealed. Records modified while rotating
+//  are skipped since they will have been re-sealed by the write. Rotate can be
+//  safely re-run and should be until no values are re-sealed prior to removing
+//  retired keys from the keyring.
+func (ds *Datastore) Rotate(ctx context.Context) (int, error) {
+	n, err := ds.rotateRecords(ctx)
+	if err != nil {
+		return n, err
+	}
+
+	h, err := ds.rotateHistory(ctx)
+	return n + h, err
+}
+
+func (ds *Datastore) rotateRecords(ctx context.Context) (int, error) {
+	kr, _ := ds.keyring()
+
+	keys, err := ds.ds.Keys(ctx)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to retrieve record keys")
+	}
+
+	var n int
+	for _, k := range keys {
+		raw, err := ds.ds.Get(ctx, k)
+		if err != nil {
+			if backend.IsNotFound(err) {
+				continue
+			}
+			return n, errors.Wrapf(err, "unable to retrieve record for key %s", k)
+		}
+
+		if current(kr, raw) {
+			continue
+		}
+
+		plain, _, err := open(kr, recordKind, k, raw)
+		if err != nil {
+			return n, errors.Wrapf(err, "unable to open record for key %s", k)
+		}
+
+		sealed, err := seal(kr, recordKind, k, plain)
+		if err != nil {
+			return n, err
+		}
+
+		if err := ds.ds.CompareAndSwap(ctx, k, raw, sealed, nil); err != nil {
+			if backend.IsConflict(err) {
+				continue
+			}
+			return n, errors.Wrapf(err, "unable to re-seal record for key %s", k)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+func (ds *Datastore) rotateHistory(ctx context.Context) (int, error) {
+	kr, _ := ds.keyring()
+
+	//  collect the stale entries prior to re-sealing to avoid modifying the
+	//  datastore while iterating
+	stale := make(map[string][]byte)
+
+	it := ds.ds.IterateHistory(ctx, "")
+	for it.Next() {
+		if !current(kr, it.Value()) {
+			stale[it.Key()] = append([]byte{}, it.Value()...)
+		}
+	}
+	it.Close()
+
+	if err := it.Err(); err != nil {
+		return 0, errors.Wrap(err, "unable to retrieve history")
+	}
+
+	var n int
+	for hkey, raw := range stale {
+		plain, _, err := open(kr, historyKind, backend.HistoryRecordKey(hkey), raw)
+		if err != nil {
+			return n, errors.Wrapf(err, "unable to open historical for key %s", hkey)
+		}
+
+		if err := ds.AddHistory(ctx, backend.HistoryRecordKey(hkey), plain); err != nil {
+			return n, errors.Wrapf(err, "unable to re-seal historical for key %s", hkey)
+		}
+
+		if err := ds.ds.RemoveHistory(ctx, hkey); err != nil {
+			return n, errors.Wrapf(err, "unable to remove historical for key %s", hkey)
+		}
+		n++
+	}
+
+	return n, nil
+}
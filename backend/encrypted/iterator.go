@@ -0,0 +1,50 @@
+package encrypted
+
+import (
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+)
+
+//  iterator opens the values of the wrapped iterator, stopping at the first
+//  value which fails to open
+type iterator struct {
+	backend.Iterator
+	keys     *kms.Keyring
+	unsealed bool
+	kind     kind
+
+	value []byte
+	err   error
+}
+
+func (it *iterator) Next() bool {
+	if it.err != nil || !it.Iterator.Next() {
+		it.value = nil
+		return false
+	}
+
+	key := it.Iterator.Key()
+	if it.kind == historyKind {
+		key = backend.HistoryRecordKey(key)
+	}
+
+	v, err := unseal(it.keys, it.unsealed, it.kind, key, it.Iterator.Value())
+	if err != nil {
+		it.err, it.value = err, nil
+		return false
+	}
+
+	it.value = v
+	return true
+}
+
+func (it *iterator) Value() []byte {
+	return it.value
+}
+
+func (it *iterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.Iterator.Err()
+}
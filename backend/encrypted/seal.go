@@ -0,0 +1,122 @@
+package encrypted
+
+import (
+	"bytes"
+	"crypto/rand"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+
+	"github.com/pkg/errors"
+)
+
+//  magic prefixes every sealed value, followed by the key ID, a ':', the nonce,
+//  and the ciphertext. The prefix and key ID are authenticated as additional
+//  data, along with the kind and storage key of the value (see
+//  additionalData) so a sealed value cannot be moved to another record or
+//  into the history.
+var magic []byte = []byte("psenc2:")
+
+//  legacyMagic prefixes values sealed without being bound to their storage
+//  key, which are only opened when unsealed values are allowed until re-sealed
+//  by Rotate
+var legacyMagic []byte = []byte("psenc1:")
+
+//  ErrUnknownKey is returned when a value was sealed with a key not in the
+//  keyring (e.g. a retired key was removed prior to the rotation completing)
+var ErrUnknownKey error = errors.New("value sealed with unknown key")
+
+//  kind is the kind of value sealed, a record or a historical entry
+type kind byte
+
+const (
+	recordKind  kind = 'r'
+	historyKind kind = 'h'
+)
+
+//  additionalData returns the data authenticated along with a sealed value,
+//  the header followed by the kind and the storage key of the record (the
+//  record key of a historical entry, since the historical key is generated on
+//  storage)
+func additionalData(hdr []byte, k kind, key string) []byte {
+	ad := make([]byte, 0, len(hdr)+1+len(key))
+	return append(append(append(ad, hdr...), byte(k)), key...)
+}
+
+//  seal encrypts the value with the active key, bound to the kind and key it
+//  is stored under
+func seal(kr *kms.Keyring, k kind, key string, value []byte) ([]byte, error) {
+	active := kr.Active()
+	gcm, _ := kr.Key(active)
+
+	hdr := make([]byte, 0, len(magic)+len(active)+1)
+	hdr = append(append(append(hdr, magic...), active...), ':')
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "unable to generate nonce")
+	}
+
+	out := append(append([]byte{}, hdr...), nonce...)
+	return gcm.Seal(out, nonce, value, additionalData(hdr, k, key)), nil
+}
+
+//  header returns the magic and the ID of the key the value was sealed with or
+//  false if the value is not sealed
+func header(value []byte) ([]byte, string, bool) {
+	for _, m := range [][]byte{magic, legacyMagic} {
+		if !bytes.HasPrefix(value, m) {
+			continue
+		}
+
+		rest := value[len(m):]
+		i := bytes.IndexByte(rest, ':')
+		if i < 1 {
+			return nil, "", false
+		}
+		return m, string(rest[:i]), true
+	}
+	return nil, "", false
+}
+
+//  current returns whether the value is sealed with the active key and bound
+//  to its storage key, so need not be re-sealed
+func current(kr *kms.Keyring, value []byte) bool {
+	m, id, ok := header(value)
+	return ok && bytes.Equal(m, magic) && id == kr.Active()
+}
+
+//  open decrypts the sealed value stored under the kind and key, returning
+//  whether it was bound to them. Values not sealed (e.g. written prior to
+//  enabling encryption) are returned as is and values sealed prior to being
+//  bound are opened, neither being bound.
+func open(kr *kms.Keyring, k kind, key string, value []byte) ([]byte, bool, error) {
+	m, id, ok := header(value)
+	if !ok {
+		return value, false, nil
+	}
+
+	gcm, ok := kr.Key(id)
+	if !ok {
+		return nil, false, errors.Wrapf(ErrUnknownKey, "key %s", id)
+	}
+
+	n := len(m) + len(id) + 1
+	hdr, body := value[:n], value[n:]
+	if len(body) < gcm.NonceSize() {
+		return nil, false, errors.New("sealed value is too short")
+	}
+
+	bound := bytes.Equal(m, magic)
+
+	ad := hdr
+	if bound {
+		ad = additionalData(hdr, k, key)
+	}
+
+	out, err := gcm.Open(nil, body[:gcm.NonceSize()], body[gcm.NonceSize():], ad)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to open value sealed with key %s", id)
+	}
+
+	return out, bound, nil
+}
@@ -0,0 +1,351 @@
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/pkg/errors"
+)
+
+func key(t *testing.T) []byte {
+	k := make([]byte, kms.KeySize)
+	if _, err := rand.Read(k); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func openFile(t *testing.T) (*fileds.Datastore, func()) {
+	what := fmt.Sprintf("psparkles_testing_%d.db", time.Now().UnixNano())
+	ds, err := fileds.Open(what, &bolt.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds, func() {
+		ds.Close()
+		os.RemoveAll(what)
+	}
+}
+
+func TestSealed(t *testing.T) {
+	inner, done := openFile(t)
+	defer done()
+
+	kr, err := kms.NewKeyring("k1", map[string][]byte{"k1": key(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, ds := context.Background(), Wrap(inner, kr)
+
+	k, want := "foo", []byte("notSuperS3cret")
+	if err := ds.Set(ctx, k, want); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := inner.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(raw, want) {
+		t.Errorf("stored value contains the plaintext: %s", raw)
+	}
+
+	if m, id, ok := header(raw); !ok || id != "k1" || !bytes.Equal(m, magic) {
+		t.Errorf("want key ID k1, got %s", id)
+	}
+
+	got, err := ds.Get(ctx, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(want, got) {
+		t.Errorf("\nwant %s\ngot %s\n", want, got)
+	}
+
+	//  tampering with the stored key ID must fail to open
+	tampered := bytes.Replace(raw, []byte("k1:"), []byte("k2:"), 1)
+	if _, _, err := open(kr, recordKind, k, tampered); err == nil {
+		t.Error("want error opening value with tampered key ID")
+	}
+
+	if err := ds.AddHistory(ctx, k, want); err != nil {
+		t.Fatal(err)
+	}
+
+	vals, err := ds.Historical(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vals {
+		for _, got := range v {
+			if got != string(want) {
+				t.Errorf("\nwant %s\ngot %s\n", want, got)
+			}
+		}
+	}
+}
+
+//  legacySeal seals the value as prior to values being bound to their key
+func legacySeal(t *testing.T, kr *kms.Keyring, value []byte) []byte {
+	gcm, _ := kr.Key(kr.Active())
+
+	hdr := append(append(append([]byte{}, legacyMagic...), kr.Active()...), ':')
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		t.Fatal(err)
+	}
+
+	return gcm.Seal(append(append([]byte{}, hdr...), nonce...), nonce, value, hdr)
+}
+
+func TestBound(t *testing.T) {
+	inner, done := openFile(t)
+	defer done()
+
+	kr, err := kms.NewKeyring("k1", map[string][]byte{"k1": key(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, ds := context.Background(), Wrap(inner, kr)
+
+	if err := ds.Set(ctx, "foo", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.AddHistory(ctx, "foo", []byte("h1")); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := inner.Get(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//  a sealed record copied onto another record must fail to open
+	if err := inner.Set(ctx, "bar", raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ds.Get(ctx, "bar"); err == nil {
+		t.Error("want error opening a record copied to another key")
+	}
+
+	//  as must a historical entry copied onto a record, and a record copied
+	//  into the history
+	hist, err := backend.Collect(inner.IterateHistory(ctx, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range hist {
+		for _, h := range v {
+			if err := inner.Set(ctx, "foo", []byte(h)); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := ds.Get(ctx, "foo"); err == nil {
+				t.Errorf("want error opening a historical entry copied onto a record, got %s", got)
+			}
+		}
+	}
+
+	if err := inner.AddHistory(ctx, "foo", raw); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := backend.Collect(ds.IterateHistory(ctx, "foo")); err == nil {
+		t.Error("want error opening a record copied into the history")
+	}
+}
+
+func TestUnsealed(t *testing.T) {
+	inner, done := openFile(t)
+	defer done()
+
+	kr, err := kms.NewKeyring("k1", map[string][]byte{"k1": key(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, ds := context.Background(), Wrap(inner, kr)
+
+	//  planted in the backend, or written prior to enabling encryption or
+	//  binding values to their key
+	if err := inner.Set(ctx, "plain", []byte("v0")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := inner.Set(ctx, "legacy", legacySeal(t, kr, []byte("v1"))); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, k := range []string{"plain", "legacy"} {
+		if _, err := ds.Get(ctx, k); errors.Cause(err) != ErrUnsealed {
+			t.Errorf("%s: want ErrUnsealed, got %v", k, err)
+		}
+	}
+
+	if _, err := ds.List(ctx); errors.Cause(err) != ErrUnsealed {
+		t.Errorf("want ErrUnsealed listing, got %v", err)
+	}
+
+	ds.AllowUnsealed(true)
+	for k, want := range map[string]string{"plain": "v0", "legacy": "v1"} {
+		if got, err := ds.Get(ctx, k); err != nil || string(got) != want {
+			t.Errorf("want %s, got %s with error %v", want, got, err)
+		}
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	inner, done := openFile(t)
+	defer done()
+
+	kr, err := kms.NewKeyring("k1", map[string][]byte{"k1": key(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, ds := context.Background(), Wrap(inner, kr)
+
+	k := "foo"
+	if err := ds.SetIfAbsent(ctx, k, []byte("v1"), []byte("h1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.SetIfAbsent(ctx, k, []byte("v1"), nil); !backend.IsExists(err) {
+		t.Errorf("want ErrExists, got %v", err)
+	}
+
+	if err := ds.CompareAndSwap(ctx, k, []byte("nope"), []byte("v2"), nil); !backend.IsConflict(err) {
+		t.Errorf("want ErrConflict, got %v", err)
+	}
+
+	//  compared on the plaintext rather than the ciphertext
+	if err := ds.CompareAndSwap(ctx, k, []byte("v1"), []byte("v2"), []byte("h2")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ds.Get(ctx, k); err != nil || string(got) != "v2" {
+		t.Errorf("want v2, got %s with error %v", got, err)
+	}
+
+	if err := ds.CompareAndSwap(ctx, k, []byte("v2"), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ds.Get(ctx, k); !backend.IsNotFound(err) {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+
+	if err := ds.CompareAndSwap(ctx, k, []byte("v2"), []byte("v3"), nil); !backend.IsConflict(err) {
+		t.Errorf("want ErrConflict for removed key, got %v", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	inner, done := openFile(t)
+	defer done()
+
+	ctx := context.Background()
+
+	//  written prior to enabling encryption
+	if err := inner.Set(ctx, "plain", []byte("v0")); err != nil {
+		t.Fatal(err)
+	}
+
+	k1, k2 := key(t), key(t)
+
+	kr, err := kms.NewKeyring("k1", map[string][]byte{"k1": k1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ds := Wrap(inner, kr)
+	ds.AllowUnsealed(true)
+
+	if err := ds.Set(ctx, "foo", []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	//  sealed prior to binding values to their key
+	if err := inner.AddHistory(ctx, "foo", legacySeal(t, kr, []byte("h0"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.AddHistory(ctx, "foo", []byte("h1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ds.Get(ctx, "plain"); err != nil || string(got) != "v0" {
+		t.Errorf("want v0, got %s with error %v", got, err)
+	}
+
+	kr, err = kms.NewKeyring("k2", map[string][]byte{"k1": k1, "k2": k2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.SetKeyring(kr)
+
+	n, err := ds.Rotate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 4 {
+		t.Errorf("want 4 re-sealed values, got %d", n)
+	}
+
+	if n, err := ds.Rotate(ctx); err != nil || n != 0 {
+		t.Errorf("want no re-sealed values on re-run, got %d with error %v", n, err)
+	}
+
+	//  with the retired key removed and unsealed values rejected, all values
+	//  must still open
+	kr, err = kms.NewKeyring("k2", map[string][]byte{"k2": k2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds.SetKeyring(kr)
+	ds.AllowUnsealed(false)
+
+	for k, want := range map[string]string{"plain": "v0", "foo": "v1"} {
+		if got, err := ds.Get(ctx, k); err != nil || string(got) != want {
+			t.Errorf("want %s, got %s with error %v", want, got, err)
+		}
+	}
+
+	vals, err := backend.Collect(ds.IterateHistory(ctx, "foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0)
+	for _, v := range vals {
+		for _, h := range v {
+			got = append(got, h)
+		}
+	}
+	sort.Strings(got)
+
+	if want, got := fmt.Sprint([]string{"h0", "h1"}), fmt.Sprint(got); want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+}
@@ -0,0 +1,117 @@
+package file
+
+import (
+	"os"
+	"time"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/pkg/errors"
+)
+
+//  compactBatch is the max number of entries copied per transaction
+const compactBatch int = 1000
+
+//  Compact rewrites the datastore file, reclaiming the space freed by removed
+//  records and history (bolt never shrinks a file). The file must not be open,
+//  since bolt only allows a single process to hold it. The sizes of the file
+//  before and after compaction are returned.
+func Compact(name string) (int64, int64, error) {
+	fi, err := os.Stat(name)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "unable to access datastore file")
+	}
+
+	//  fail rather than wait if the file is held by a running server
+	src, err := bolt.Open(name, 0600, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err == bolt.ErrTimeout {
+		return 0, 0, ErrInUse
+	}
+
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "unable to open datastore file")
+	}
+
+	//  closed prior to replacing the file once compacted, otherwise on return
+	closed := false
+	defer func() {
+		if !closed {
+			src.Close()
+		}
+	}()
+
+	tmp := name + ".compact"
+	if err := os.RemoveAll(tmp); err != nil {
+		return 0, 0, errors.Wrap(err, "unable to remove stale compaction file")
+	}
+
+	dst, err := bolt.Open(tmp, fi.Mode(), nil)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "unable to create compaction file")
+	}
+
+	if err := copyBuckets(src, dst); err != nil {
+		dst.Close()
+		os.RemoveAll(tmp)
+		return 0, 0, err
+	}
+
+	if err := dst.Close(); err != nil {
+		os.RemoveAll(tmp)
+		return 0, 0, errors.Wrap(err, "unable to close compaction file")
+	}
+
+	cfi, err := os.Stat(tmp)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "unable to access compaction file")
+	}
+
+	closed = true
+	if err := src.Close(); err != nil {
+		os.RemoveAll(tmp)
+		return 0, 0, errors.Wrap(err, "unable to close datastore file")
+	}
+
+	if err := os.Rename(tmp, name); err != nil {
+		return 0, 0, errors.Wrap(err, "unable to replace datastore file")
+	}
+
+	return fi.Size(), cfi.Size(), nil
+}
+
+//  copyBuckets copies every top level bucket (the datastore has no nested
+//  buckets) from src to dst in batches, keeping the transactions small
+func copyBuckets(src, dst *bolt.DB) error {
+	return src.View(func(stx *bolt.Tx) error {
+		return stx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			c := b.Cursor()
+			k, v := c.First()
+
+			for {
+				err := dst.Update(func(dtx *bolt.Tx) error {
+					db, err := dtx.CreateBucketIfNotExists(name)
+					if err != nil {
+						return err
+					}
+
+					//  keys are copied in order, allowing pages to be filled
+					db.FillPercent = 1.0
+
+					for i := 0; k != nil && i < compactBatch; i++ {
+						if err := db.Put(k, v); err != nil {
+							return err
+						}
+						k, v = c.Next()
+					}
+					return nil
+				})
+				if err != nil {
+					return errors.Wrapf(err, "unable to copy bucket %s", name)
+				}
+
+				if k == nil {
+					return nil
+				}
+			}
+		})
+	})
+}
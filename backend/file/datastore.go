@@ -1,9 +1,8 @@
 package file
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
-	"fmt"
+	"bytes"
+	"context"
 
 	"github.com/manulife-gwam/peppermint-sparkles/backend"
 
@@ -22,8 +21,17 @@ type Datastore struct {
 
 var ErrInvalidDatastore error = errors.New("no valid datastore")
 
+//  ErrInUse is returned when the datastore file is held by another process
+//  (e.g. a running server) for longer than the timeout of the options, since
+//  bolt only allows a single process to hold the file
+var ErrInUse error = errors.New("datastore file is in use by another process")
+
 func Open(name string, opts *bolt.Options) (*Datastore, error) {
 	db, err := bolt.Open(name, 0600, opts)
+	if err == bolt.ErrTimeout {
+		return nil, ErrInUse
+	}
+
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to open datastore file")
 	}
@@ -54,114 +62,187 @@ func (ds *Datastore) Close() error {
 	return nil
 }
 
-func (ds *Datastore) keys(b string) []string {
-	vals := make([]string, 0)
-	if ds.db != nil {
-		ds.db.View(func(tx *bolt.Tx) error {
-			curs := tx.Bucket([]byte(b)).Cursor()
-			for k, _ := curs.First(); k != nil; k, _ = curs.Next() {
-				vals = append(vals, string(k))
-			}
+//  view wraps a read-only transaction, ensuring the datastore is valid and the
+//  context has not been cancelled prior to starting
+func (ds *Datastore) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if ds.db == nil {
+		return ErrInvalidDatastore
+	}
 
-			return nil
-		})
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	return vals
+
+	return ds.db.View(fn)
+}
+
+//  update wraps a read-write transaction, ensuring the datastore is valid and
+//  the context has not been cancelled prior to starting
+func (ds *Datastore) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if ds.db == nil {
+		return ErrInvalidDatastore
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return ds.db.Update(fn)
 }
 
 //  Keys iterates over the available keys and returns as a list.
-func (ds *Datastore) Keys() []string {
-	return ds.keys(bucket)
+func (ds *Datastore) Keys(ctx context.Context) ([]string, error) {
+	return backend.CollectKeys(ds.Iterate(ctx, ""))
 }
 
 //  Set adds a new entry into the key/value store. If the key exists, the old
 //  value will be overwritten.
-func (ds *Datastore) Set(key, value string) error {
-	if ds.db == nil {
-		return ErrInvalidDatastore
-	}
-	return ds.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket([]byte(bucket)).Put([]byte(key), []byte(value))
+func (ds *Datastore) Set(ctx context.Context, key string, value []byte) error {
+	return ds.update(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put([]byte(key), value)
 	})
 }
 
-func (ds *Datastore) get(b, k string) string {
-	if ds.db == nil {
-		return ""
-	}
-	var val string
-	ds.db.View(func(tx *bolt.Tx) error {
-		val = string(tx.Bucket([]byte(b)).Get([]byte(k)))
+func (ds *Datastore) get(ctx context.Context, b, k string) ([]byte, error) {
+	var val []byte
+	err := ds.view(ctx, func(tx *bolt.Tx) error {
+		//  the returned value is only valid for the life of the transaction so
+		//  a copy must be made
+		if v := tx.Bucket([]byte(b)).Get([]byte(k)); v != nil {
+			val = append([]byte{}, v...)
+		}
 		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	if val == nil {
+		return nil, backend.ErrNotFound
+	}
 
-	return val
+	return val, nil
 }
 
-//  Get retrieves the relevant content for the provided key.
-func (ds *Datastore) Get(key string) string {
-	return ds.get(bucket, key)
+//  Get retrieves the relevant content for the provided key. If no content is
+//  available, backend.ErrNotFound is returned.
+func (ds *Datastore) Get(ctx context.Context, key string) ([]byte, error) {
+	return ds.get(ctx, bucket, key)
 }
 
 //  Remove deletes the content for the provided key. No error is returned if the
 //  provided key does not exist.
-func (ds *Datastore) Remove(key string) error {
-	if ds.db == nil {
-		return ErrInvalidDatastore
-	}
-
-	return ds.db.Update(func(tx *bolt.Tx) error {
+func (ds *Datastore) Remove(ctx context.Context, key string) error {
+	return ds.update(ctx, func(tx *bolt.Tx) error {
 		return tx.Bucket([]byte(bucket)).Delete([]byte(key))
 	})
 }
 
-func (ds *Datastore) List() ([]backend.Value, error) {
-	if ds.db == nil {
-		return nil, ErrInvalidDatastore
-	}
+func (ds *Datastore) List(ctx context.Context) ([]backend.Value, error) {
+	return backend.Collect(ds.Iterate(ctx, ""))
+}
 
-	vals := make([]backend.Value, 0)
-	for _, k := range ds.Keys() {
-		vals = append(vals, backend.Value{k: ds.Get(k)})
+//  addHistory generates a new historical key for the provided key and stores
+//  the value as part of the provided transaction
+func addHistory(tx *bolt.Tx, key string, value []byte) error {
+	hkey, err := backend.HistoryKey(key, value)
+	if err != nil {
+		return err
 	}
+	return tx.Bucket([]byte(historical)).Put([]byte(hkey), value)
+}
 
-	return vals, nil
+func (ds *Datastore) AddHistory(ctx context.Context, key string, value []byte) error {
+	return ds.update(ctx, func(tx *bolt.Tx) error {
+		return addHistory(tx, key, value)
+	})
 }
 
-func (ds *Datastore) AddHistory(value string) error {
-	if ds.db == nil {
-		return ErrInvalidDatastore
-	}
+//  RemoveHistory deletes the historical entry for the provided historical key.
+//  No error is returned if the historical key does not exist.
+func (ds *Datastore) RemoveHistory(ctx context.Context, hkey string) error {
+	return ds.update(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(historical)).Delete([]byte(hkey))
+	})
+}
 
-	buf := make([]byte, 2048)
-	if _, err := rand.Read(buf); err != nil {
-		return errors.Wrap(err, "unable to read in random data to generate key")
-	}
+func (ds *Datastore) historicalKeys(ctx context.Context) ([]string, error) {
+	return backend.CollectKeys(ds.IterateHistory(ctx, ""))
+}
 
-	//	generate SHA256 token from random content to be stored + random data to
-	// 	attempt to prevent collisions
-	key := fmt.Sprintf("%x", sha256.Sum256(append([]byte(value), buf...)))
+func (ds *Datastore) Historical(ctx context.Context) ([]backend.Value, error) {
+	return backend.Collect(ds.IterateHistory(ctx, ""))
+}
 
-	return ds.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket([]byte(historical)).Put([]byte(key), []byte(value))
+//  SetIfAbsent stores the value only if no value exists for the key, returning
+//  backend.ErrExists otherwise. The optional history is written as part of the
+//  same transaction.
+func (ds *Datastore) SetIfAbsent(ctx context.Context, key string, value, history []byte) error {
+	return ds.update(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b.Get([]byte(key)) != nil {
+			return backend.ErrExists
+		}
+
+		if err := b.Put([]byte(key), value); err != nil {
+			return err
+		}
+
+		if history != nil {
+			return addHistory(tx, key, history)
+		}
+		return nil
 	})
 }
 
-func (ds *Datastore) historicalKeys() []string {
-	return ds.keys(historical)
-}
+//  CompareAndSwap replaces the value for the key only if the current value
+//  matches old, returning backend.ErrConflict otherwise. A nil value removes
+//  the key. The optional history is written as part of the same transaction.
+func (ds *Datastore) CompareAndSwap(ctx context.Context, key string, old, value, history []byte) error {
+	return ds.update(ctx, func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
 
-func (ds *Datastore) Historical() ([]backend.Value, error) {
-	if ds.db == nil {
-		return nil, ErrInvalidDatastore
-	}
+		cur := b.Get([]byte(key))
+		if (cur == nil) != (old == nil) || !bytes.Equal(cur, old) {
+			return backend.ErrConflict
+		}
 
-	vals := make([]backend.Value, 0)
-	for _, k := range ds.historicalKeys() {
-		if res := ds.get(historical, historical); len(res) > 0 {
-			vals = append(vals, backend.Value{k: res})
+		var err error
+		if value == nil {
+			err = b.Delete([]byte(key))
+		} else {
+			err = b.Put([]byte(key), value)
+		}
+		if err != nil {
+			return err
+		}
+
+		if history != nil {
+			return addHistory(tx, key, history)
+		}
+		return nil
+	})
+}
+
+//  Snapshot walks the records and then history in a single read-only
+//  transaction, providing a consistent view without blocking writers.
+func (ds *Datastore) Snapshot(ctx context.Context, records, history func(key string, value []byte) error) error {
+	return ds.view(ctx, func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return records(string(k), v)
+		})
+		if err != nil {
+			return err
 		}
-	}
 
-	return vals, nil
+		return tx.Bucket([]byte(historical)).ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return history(string(k), v)
+		})
+	})
 }
@@ -0,0 +1,140 @@
+package file
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+//  batchSize is the max number of entries read per transaction while iterating
+const batchSize int = 100
+
+type entry struct {
+	key   string
+	value []byte
+}
+
+//  iterator walks a bucket in batches, each batch read in its own short-lived
+//  transaction so that writers are not held up by a long running iteration.
+//  Iteration resumes from the last key read, so entries written behind the
+//  cursor during iteration will not be returned.
+type iterator struct {
+	ctx    context.Context
+	ds     *Datastore
+	bucket []byte
+	prefix []byte
+
+	last []byte
+	buf  []entry
+	pos  int
+	done bool
+	err  error
+}
+
+func (ds *Datastore) iterate(ctx context.Context, b, prefix string) *iterator {
+	return &iterator{
+		ctx:    ctx,
+		ds:     ds,
+		bucket: []byte(b),
+		prefix: []byte(prefix),
+		pos:    -1,
+	}
+}
+
+//  Iterate returns an iterator over the current entries with keys starting
+//  with prefix
+func (ds *Datastore) Iterate(ctx context.Context, prefix string) backend.Iterator {
+	return ds.iterate(ctx, bucket, prefix)
+}
+
+//  IterateHistory returns an iterator over the historical entries for the key
+func (ds *Datastore) IterateHistory(ctx context.Context, key string) backend.Iterator {
+	if len(key) > 0 {
+		//  historical keys are grouped by the key followed by a '.'
+		key = key + "."
+	}
+	return ds.iterate(ctx, historical, key)
+}
+
+func (it *iterator) fetch() error {
+	it.buf, it.pos = it.buf[:0], 0
+
+	return it.ds.view(it.ctx, func(tx *bolt.Tx) error {
+		curs := tx.Bucket(it.bucket).Cursor()
+
+		var k, v []byte
+		if it.last == nil {
+			k, v = curs.Seek(it.prefix)
+		} else {
+			//  resume from the last key read, skipping it if it still exists
+			if k, v = curs.Seek(it.last); k != nil && bytes.Equal(k, it.last) {
+				k, v = curs.Next()
+			}
+		}
+
+		for ; k != nil && bytes.HasPrefix(k, it.prefix); k, v = curs.Next() {
+			if len(it.buf) >= batchSize {
+				return nil
+			}
+
+			//  keys and values are only valid for the life of the transaction so
+			//  copies must be made
+			it.buf = append(it.buf, entry{key: string(k), value: append([]byte{}, v...)})
+		}
+
+		it.done = true
+		return nil
+	})
+}
+
+func (it *iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	if it.pos++; it.pos < len(it.buf) {
+		return true
+	}
+
+	if it.done {
+		return false
+	}
+
+	if err := it.fetch(); err != nil {
+		it.err = err
+		return false
+	}
+
+	if len(it.buf) < 1 {
+		return false
+	}
+
+	it.last = []byte(it.buf[len(it.buf)-1].key)
+	return true
+}
+
+func (it *iterator) Key() string {
+	if it.pos < 0 || it.pos >= len(it.buf) {
+		return ""
+	}
+	return it.buf[it.pos].key
+}
+
+func (it *iterator) Value() []byte {
+	if it.pos < 0 || it.pos >= len(it.buf) {
+		return nil
+	}
+	return it.buf[it.pos].value
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
+
+func (it *iterator) Close() error {
+	it.buf, it.done = nil, true
+	return nil
+}
@@ -6,12 +6,15 @@
 package file
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+
 	bolt "github.com/coreos/bbolt"
 )
 
@@ -24,23 +27,34 @@ func TestOpen(t *testing.T) {
 	defer ds.Close()
 	defer os.RemoveAll(what)
 
+	ctx := context.Background()
+
 	key, want := "foo", "bar"
-	if err := ds.Set(key, want); err != nil {
+	if err := ds.Set(ctx, key, []byte(want)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ds.Get(ctx, key)
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	if got := ds.Get(key); want != got {
+	if want != string(got) {
 		t.Errorf("\nwant %s\ngot %s\n", want, got)
 	}
 
-	if err := ds.AddHistory(want); err != nil {
+	if err := ds.AddHistory(ctx, key, []byte(want)); err != nil {
 		t.Fatal(err)
 	}
 
 	//	there should only be 1 historical item
-	hkeys := ds.historicalKeys()
-	if got := ds.get(historical, hkeys[0]); want != got {
-		t.Errorf("\nwant %s\ngot %s\n", want, got)
+	hkeys, err := ds.historicalKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ds.get(ctx, historical, hkeys[0]); err != nil || want != string(got) {
+		t.Errorf("\nwant %s\ngot %s\nerr %v\n", want, got, err)
 	}
 }
 
@@ -52,8 +66,10 @@ func TestClose(t *testing.T) {
 	}
 	defer os.RemoveAll(what)
 
+	ctx := context.Background()
+
 	key := "foo"
-	if err := ds.Set(key, "bar"); err != nil {
+	if err := ds.Set(ctx, key, []byte("bar")); err != nil {
 		t.Fatal(err)
 	}
 
@@ -62,7 +78,7 @@ func TestClose(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if val := ds.Get(key); len(val) > 0 {
+	if val, err := ds.Get(ctx, key); err == nil || len(val) > 0 {
 		t.Error("datastore returned value after closure")
 	}
 }
@@ -76,12 +92,19 @@ func TestKeys(t *testing.T) {
 	defer ds.Close()
 	defer os.RemoveAll(what)
 
-	if keys := ds.Keys(); len(keys) > 0 {
+	ctx := context.Background()
+
+	keys, err := ds.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) > 0 {
 		t.Error("keys should have been empty")
 
 		//	empty, just in case
 		for _, k := range keys {
-			if err := ds.Remove(k); err != nil {
+			if err := ds.Remove(ctx, k); err != nil {
 				t.Fatal(err)
 			}
 		}
@@ -90,12 +113,15 @@ func TestKeys(t *testing.T) {
 	wants := []string{"foo", "bar", "baz"}
 	for _, w := range wants {
 		r := rand.NewSource(time.Now().UnixNano()).Int63()
-		if err := ds.Set(w, fmt.Sprintf("%d", r)); err != nil {
+		if err := ds.Set(ctx, w, []byte(fmt.Sprintf("%d", r))); err != nil {
 			t.Fatal(err)
 		}
 	}
 
-	keys := ds.Keys()
+	keys, err = ds.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if got, want := len(keys), len(wants); want != got {
 		t.Errorf("\nwant %d\ngot %d\n", want, got)
 	}
@@ -123,26 +149,32 @@ func TestSetGet(t *testing.T) {
 	defer ds.Close()
 	defer os.RemoveAll(what)
 
+	ctx := context.Background()
+
 	key, bar := "foo", "bar"
-	if got := ds.Get(key); len(got) > 0 {
-		t.Error("expected an empty result but return", got)
+	if got, err := ds.Get(ctx, key); !backend.IsNotFound(err) {
+		t.Errorf("expected a not found error but returned %s with error %v", got, err)
 	}
 
-	if err := ds.Set(key, bar); err != nil {
+	if err := ds.Set(ctx, key, []byte(bar)); err != nil {
 		t.Fatal(err)
 	}
 
-	if got := ds.Get(key); bar != got {
-		t.Errorf("\nwant %s\ngot %s\n", bar, got)
+	if got, err := ds.Get(ctx, key); err != nil || bar != string(got) {
+		t.Errorf("\nwant %s\ngot %s\nerr %v\n", bar, got, err)
 	}
 
 	baz := "baz"
-	if err := ds.Set(key, baz); err != nil {
+	if err := ds.Set(ctx, key, []byte(baz)); err != nil {
 		t.Fatal(err)
 	}
 
-	got := ds.Get(key)
-	switch got {
+	raw, err := ds.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch got := string(raw); got {
 	case bar:
 		t.Error("value remains the same after an update")
 
@@ -163,22 +195,24 @@ func TestRemove(t *testing.T) {
 	defer ds.Close()
 	defer os.RemoveAll(what)
 
+	ctx := context.Background()
+
 	key, bar := "foo", "bar"
-	if err := ds.Set(key, bar); err != nil {
+	if err := ds.Set(ctx, key, []byte(bar)); err != nil {
 		t.Fatal(err)
 	}
 
 	//	test if set worked
-	if got := ds.Get(key); bar != got {
-		t.Errorf("\nwant %s\ngot %s\n", bar, got)
+	if got, err := ds.Get(ctx, key); err != nil || bar != string(got) {
+		t.Errorf("\nwant %s\ngot %s\nerr %v\n", bar, got, err)
 	}
 
-	if err := ds.Remove(key); err != nil {
+	if err := ds.Remove(ctx, key); err != nil {
 		t.Fatal(err)
 	}
 
-	if got := ds.Get(key); len(got) > 0 || got == bar {
-		t.Errorf("non-empty value of %s was returned after removal", got)
+	if got, err := ds.Get(ctx, key); !backend.IsNotFound(err) {
+		t.Errorf("value of %s was returned after removal with error %v", got, err)
 	}
 }
 
@@ -198,14 +232,16 @@ func TestList(t *testing.T) {
 		"796362b8b4289fca4d666ab486487d6699e828f9c098fc1c91566c291ef682f6": "biz",
 	}
 
+	ctx := context.Background()
+
 	//	fill the datastore with sample values
 	for k, v := range wants {
-		if err := ds.Set(k, v); err != nil {
+		if err := ds.Set(ctx, k, []byte(v)); err != nil {
 			t.Fatal(err)
 		}
 	}
 
-	gots, err := ds.List()
+	gots, err := ds.List(ctx)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -218,3 +254,215 @@ func TestList(t *testing.T) {
 		}
 	}
 }
+
+func TestSetIfAbsent(t *testing.T) {
+	what := fmt.Sprintf("psparkles_testing_%d.db", time.Now().UnixNano())
+	ds, err := Open(what, &bolt.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	defer os.RemoveAll(what)
+
+	ctx := context.Background()
+
+	key, bar := "foo", "bar"
+	if err := ds.SetIfAbsent(ctx, key, []byte(bar), []byte(bar)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.SetIfAbsent(ctx, key, []byte("baz"), []byte("baz")); !backend.IsExists(err) {
+		t.Errorf("expected an exists error but returned %v", err)
+	}
+
+	if got, err := ds.Get(ctx, key); err != nil || bar != string(got) {
+		t.Errorf("\nwant %s\ngot %s\nerr %v\n", bar, got, err)
+	}
+
+	//	only the successful set should have written history
+	hkeys, err := ds.historicalKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 1, len(hkeys); want != got {
+		t.Errorf("\nwant %d\ngot %d\n", want, got)
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	what := fmt.Sprintf("psparkles_testing_%d.db", time.Now().UnixNano())
+	ds, err := Open(what, &bolt.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	defer os.RemoveAll(what)
+
+	ctx := context.Background()
+
+	key, bar, baz := "foo", []byte("bar"), []byte("baz")
+	if err := ds.CompareAndSwap(ctx, key, bar, baz, nil); !backend.IsConflict(err) {
+		t.Errorf("expected a conflict error for a missing key but returned %v", err)
+	}
+
+	if err := ds.CompareAndSwap(ctx, key, nil, bar, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.CompareAndSwap(ctx, key, baz, bar, nil); !backend.IsConflict(err) {
+		t.Errorf("expected a conflict error for a stale value but returned %v", err)
+	}
+
+	if err := ds.CompareAndSwap(ctx, key, bar, baz, baz); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ds.Get(ctx, key); err != nil || string(baz) != string(got) {
+		t.Errorf("\nwant %s\ngot %s\nerr %v\n", baz, got, err)
+	}
+
+	//	a nil value should remove the key
+	if err := ds.CompareAndSwap(ctx, key, baz, nil, baz); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ds.Get(ctx, key); !backend.IsNotFound(err) {
+		t.Errorf("value of %s was returned after removal with error %v", got, err)
+	}
+
+	hkeys, err := ds.historicalKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 2, len(hkeys); want != got {
+		t.Errorf("\nwant %d\ngot %d\n", want, got)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	what := fmt.Sprintf("psparkles_testing_%d.db", time.Now().UnixNano())
+	ds, err := Open(what, &bolt.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+	defer os.RemoveAll(what)
+
+	ctx := context.Background()
+
+	//	ensure there are more entries than a single batch
+	wants := make(map[string]string)
+	for i := 0; i < (batchSize*2)+5; i++ {
+		k, v := fmt.Sprintf("foo.%03d", i), fmt.Sprintf("%d", i)
+		if err := ds.Set(ctx, k, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+		wants[k] = v
+	}
+
+	if err := ds.Set(ctx, "bar", []byte("baz")); err != nil {
+		t.Fatal(err)
+	}
+
+	it := ds.Iterate(ctx, "foo.")
+	defer it.Close()
+
+	gots := 0
+	for it.Next() {
+		want, ok := wants[it.Key()]
+		if !ok {
+			t.Errorf("unexpected key %s returned for prefix", it.Key())
+			continue
+		}
+
+		if got := string(it.Value()); want != got {
+			t.Errorf("\nwant %s\ngot %s\n", want, got)
+		}
+		gots++
+	}
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := len(wants), gots; want != got {
+		t.Errorf("\nwant %d\ngot %d\n", want, got)
+	}
+
+	keys, err := ds.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := len(wants)+1, len(keys); want != got {
+		t.Errorf("\nwant %d\ngot %d\n", want, got)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	what := fmt.Sprintf("psparkles_testing_%d.db", time.Now().UnixNano())
+	ds, err := Open(what, &bolt.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(what)
+
+	ctx := context.Background()
+
+	//	fill then empty the history to leave free pages behind
+	for i := 0; i < 2000; i++ {
+		k := fmt.Sprintf("key_%d", i)
+		if err := ds.SetIfAbsent(ctx, k, []byte(k), make([]byte, 512)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hkeys, err := ds.historicalKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hkey := range hkeys {
+		if err := ds.RemoveHistory(ctx, hkey); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//	the file can not be compacted, nor opened again, while open
+	if _, _, err := Compact(what); err != ErrInUse {
+		t.Errorf("want ErrInUse compacting an open datastore, got %v", err)
+	}
+
+	if _, err := Open(what, &bolt.Options{Timeout: 10 * time.Millisecond}); err != ErrInUse {
+		t.Errorf("want ErrInUse opening an open datastore, got %v", err)
+	}
+
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	before, after, err := Compact(what)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if after >= before {
+		t.Errorf("want the file to shrink, got %d bytes from %d", after, before)
+	}
+
+	if ds, err = Open(what, &bolt.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	keys, err := ds.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 2000 {
+		t.Errorf("want 2000 keys, got %d", len(keys))
+	}
+}
@@ -0,0 +1,76 @@
+package backend
+
+//  Iterator provides streaming iteration over the entries of a Datastore,
+//  allowing large stores to be walked without loading every entry (or
+//  blocking the backend) at once. Entries are retrieved in batches as Next is
+//  called. Depending on the backend, an entry modified during iteration may be
+//  returned more than once or not at all.
+//
+//  Usage:
+//
+//  	it := ds.Iterate(ctx, "")
+//  	defer it.Close()
+//
+//  	for it.Next() {
+//  		fmt.Println(it.Key(), string(it.Value()))
+//  	}
+//
+//  	if err := it.Err(); err != nil {
+//  		...
+//  	}
+type Iterator interface {
+	//  Next advances to the next entry, returning false once the entries are
+	//  exhausted or an error occurred
+	Next() bool
+
+	//  Key returns the key of the current entry
+	Key() string
+
+	//  Value returns the value of the current entry
+	Value() []byte
+
+	//  Err returns the first error encountered while iterating
+	Err() error
+
+	//  Close releases any resources held by the iterator
+	Close() error
+}
+
+//  CollectKeys drains the iterator, returning the unique keys
+func CollectKeys(it Iterator) ([]string, error) {
+	defer it.Close()
+
+	keys, seen := make([]string, 0), make(map[string]bool)
+	for it.Next() {
+		if k := it.Key(); !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+//  Collect drains the iterator, returning the unique entries as a list of
+//  values
+func Collect(it Iterator) ([]Value, error) {
+	defer it.Close()
+
+	vals, seen := make([]Value, 0), make(map[string]bool)
+	for it.Next() {
+		if k := it.Key(); !seen[k] {
+			seen[k] = true
+			vals = append(vals, Value{k: string(it.Value())})
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return vals, nil
+}
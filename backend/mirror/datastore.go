@@ -0,0 +1,216 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+//  Datastore mirrors every write made to the primary datastore onto the
+//  secondary, allowing a new backend to be kept in sync while migrating to it
+//  (see Copy and Verify). The primary is the source of truth:
+//
+//  	- writes are only mirrored once successful on the primary
+//  	- a failure to mirror is logged rather than returned
+//  	- reads are made from the primary, falling back to the secondary only
+//  	  when the primary fails (i.e. not for backend.ErrNotFound)
+//
+//  Since historical keys are generated per datastore, mirrored history is
+//  matched by the record key and value rather than the historical key.
+type Datastore struct {
+	primary   backend.Datastore
+	secondary backend.Datastore
+}
+
+//  New returns a datastore mirroring the writes made to the primary onto the
+//  secondary
+func New(primary, secondary backend.Datastore) *Datastore {
+	return &Datastore{primary: primary, secondary: secondary}
+}
+
+//  fallback reports if the failed primary call should be retried against the
+//  secondary
+func fallback(ctx context.Context, err error) bool {
+	if err == nil || backend.IsNotFound(err) || ctx.Err() != nil {
+		return false
+	}
+
+	log.Error(err, "primary datastore failed, falling back to secondary")
+	return true
+}
+
+//  mirrored logs the failure to mirror a write to the secondary
+func mirrored(err error, what, key string) {
+	if err != nil {
+		log.Error(errors.Wrapf(err, "unable to mirror %s for key %s", what, key))
+	}
+}
+
+//  Close closes both datastores, returning the first error
+func (ds *Datastore) Close() error {
+	err := ds.primary.Close()
+	if serr := ds.secondary.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+func (ds *Datastore) Keys(ctx context.Context) ([]string, error) {
+	keys, err := ds.primary.Keys(ctx)
+	if fallback(ctx, err) {
+		return ds.secondary.Keys(ctx)
+	}
+	return keys, err
+}
+
+func (ds *Datastore) List(ctx context.Context) ([]backend.Value, error) {
+	vals, err := ds.primary.List(ctx)
+	if fallback(ctx, err) {
+		return ds.secondary.List(ctx)
+	}
+	return vals, err
+}
+
+func (ds *Datastore) Get(ctx context.Context, key string) ([]byte, error) {
+	v, err := ds.primary.Get(ctx, key)
+	if fallback(ctx, err) {
+		return ds.secondary.Get(ctx, key)
+	}
+	return v, err
+}
+
+func (ds *Datastore) Historical(ctx context.Context) ([]backend.Value, error) {
+	vals, err := ds.primary.Historical(ctx)
+	if fallback(ctx, err) {
+		return ds.secondary.Historical(ctx)
+	}
+	return vals, err
+}
+
+//  Iterate iterates over the primary only, since a failure part way through
+//  can not be resumed against the secondary
+func (ds *Datastore) Iterate(ctx context.Context, prefix string) backend.Iterator {
+	return ds.primary.Iterate(ctx, prefix)
+}
+
+//  IterateHistory iterates over the primary only, since a failure part way
+//  through can not be resumed against the secondary
+func (ds *Datastore) IterateHistory(ctx context.Context, key string) backend.Iterator {
+	return ds.primary.IterateHistory(ctx, key)
+}
+
+func (ds *Datastore) Set(ctx context.Context, key string, value []byte) error {
+	if err := ds.primary.Set(ctx, key, value); err != nil {
+		return err
+	}
+
+	mirrored(ds.secondary.Set(ctx, key, value), "record", key)
+	return nil
+}
+
+func (ds *Datastore) Remove(ctx context.Context, key string) error {
+	if err := ds.primary.Remove(ctx, key); err != nil {
+		return err
+	}
+
+	mirrored(ds.secondary.Remove(ctx, key), "removal", key)
+	return nil
+}
+
+func (ds *Datastore) AddHistory(ctx context.Context, key string, value []byte) error {
+	if err := ds.primary.AddHistory(ctx, key, value); err != nil {
+		return err
+	}
+
+	mirrored(ds.secondary.AddHistory(ctx, key, value), "historical", key)
+	return nil
+}
+
+//  RemoveHistory removes the historical entry from the primary and the first
+//  entry for the same record key with the same value from the secondary
+func (ds *Datastore) RemoveHistory(ctx context.Context, hkey string) error {
+	key := backend.HistoryRecordKey(hkey)
+
+	value, err := find(ds.primary.IterateHistory(ctx, key), func(k string, _ []byte) bool {
+		return k == hkey
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to retrieve historical")
+	}
+
+	if err := ds.primary.RemoveHistory(ctx, hkey); err != nil {
+		return err
+	}
+
+	if value == nil {
+		return nil
+	}
+
+	var match string
+	_, err = find(ds.secondary.IterateHistory(ctx, key), func(k string, v []byte) bool {
+		if bytes.Equal(v, value) {
+			match = k
+			return true
+		}
+		return false
+	})
+
+	if err == nil && len(match) > 0 {
+		err = ds.secondary.RemoveHistory(ctx, match)
+	}
+
+	mirrored(err, "historical removal", hkey)
+	return nil
+}
+
+//  find returns a copy of the value of the first entry matching fn or nil if
+//  none match
+func find(it backend.Iterator, fn func(k string, v []byte) bool) ([]byte, error) {
+	defer it.Close()
+
+	for it.Next() {
+		if fn(it.Key(), it.Value()) {
+			return append([]byte{}, it.Value()...), nil
+		}
+	}
+
+	return nil, it.Err()
+}
+
+//  SetIfAbsent mirrors the resulting record and history onto the secondary
+//  regardless of whether the record already exists there
+func (ds *Datastore) SetIfAbsent(ctx context.Context, key string, value, history []byte) error {
+	if err := ds.primary.SetIfAbsent(ctx, key, value, history); err != nil {
+		return err
+	}
+
+	ds.mirror(ctx, key, value, history)
+	return nil
+}
+
+//  CompareAndSwap compares against the primary only, mirroring the resulting
+//  record and history onto the secondary
+func (ds *Datastore) CompareAndSwap(ctx context.Context, key string, old, value, history []byte) error {
+	if err := ds.primary.CompareAndSwap(ctx, key, old, value, history); err != nil {
+		return err
+	}
+
+	ds.mirror(ctx, key, value, history)
+	return nil
+}
+
+func (ds *Datastore) mirror(ctx context.Context, key string, value, history []byte) {
+	if value == nil {
+		mirrored(ds.secondary.Remove(ctx, key), "removal", key)
+	} else {
+		mirrored(ds.secondary.Set(ctx, key, value), "record", key)
+	}
+
+	if history != nil {
+		mirrored(ds.secondary.AddHistory(ctx, key, history), "historical", key)
+	}
+}
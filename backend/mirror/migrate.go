@@ -0,0 +1,207 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+
+	"github.com/pkg/errors"
+)
+
+//  Report summarizes the result of a Copy
+type Report struct {
+	//  Records is the number of records copied
+	Records int
+
+	//  History is the number of historical entries copied
+	History int
+
+	//  Skipped is the number of records and historical entries already present
+	//  in the destination
+	Skipped int
+
+	//  Conflicts are the keys of the records present in the destination with a
+	//  different value, which are only overwritten if requested
+	Conflicts []string
+}
+
+//  Copy copies the records and history from one datastore to another. Values
+//  are copied as is, so records encrypted at rest remain encrypted under the
+//  same master keys. Records already present in the destination are only
+//  overwritten if requested, since when mirroring they may be newer than the
+//  copy being made. Historical entries are matched by the record key and value,
+//  so re-running a copy does not duplicate history.
+func Copy(ctx context.Context, from, to backend.Datastore, overwrite bool) (*Report, error) {
+	return CopyFrom(ctx, from.Iterate(ctx, ""), from.IterateHistory(ctx, ""), to, overwrite)
+}
+
+//  CopyFrom copies the records and history provided by the iterators (e.g. read
+//  from a backup) to the datastore, as per Copy. The records are copied in full
+//  prior to the history. Both iterators are closed once copied.
+func CopyFrom(ctx context.Context, records, historical backend.Iterator, to backend.Datastore, overwrite bool) (*Report, error) {
+	defer records.Close()
+	defer historical.Close()
+
+	r := &Report{Conflicts: make([]string, 0)}
+
+	if err := r.copyRecords(ctx, records, to, overwrite); err != nil {
+		return r, err
+	}
+
+	if err := r.copyHistory(ctx, historical, to); err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+func (r *Report) copyRecords(ctx context.Context, it backend.Iterator, to backend.Datastore, overwrite bool) error {
+	for it.Next() {
+		k, v := it.Key(), it.Value()
+
+		err := to.SetIfAbsent(ctx, k, v, nil)
+		if err == nil {
+			r.Records++
+			continue
+		}
+
+		if !backend.IsExists(err) {
+			return errors.Wrapf(err, "unable to copy record for key %s", k)
+		}
+
+		cur, err := to.Get(ctx, k)
+		if err != nil && !backend.IsNotFound(err) {
+			return errors.Wrapf(err, "unable to retrieve existing record for key %s", k)
+		}
+
+		switch {
+		case bytes.Equal(cur, v):
+			r.Skipped++
+
+		case overwrite:
+			if err := to.Set(ctx, k, v); err != nil {
+				return errors.Wrapf(err, "unable to overwrite record for key %s", k)
+			}
+			r.Records++
+
+		default:
+			r.Conflicts = append(r.Conflicts, k)
+		}
+	}
+
+	return errors.Wrap(it.Err(), "unable to iterate records")
+}
+
+func (r *Report) copyHistory(ctx context.Context, it backend.Iterator, to backend.Datastore) error {
+	dest := newHistory(to)
+
+	for it.Next() {
+		key := backend.HistoryRecordKey(it.Key())
+
+		found, err := dest.take(ctx, key, it.Value())
+		if err != nil {
+			return err
+		}
+
+		if found {
+			r.Skipped++
+			continue
+		}
+
+		if err := to.AddHistory(ctx, key, it.Value()); err != nil {
+			return errors.Wrapf(err, "unable to copy historical for key %s", it.Key())
+		}
+		r.History++
+	}
+
+	return errors.Wrap(it.Err(), "unable to iterate history")
+}
+
+//  Verify ensures every record and historical entry in one datastore is
+//  present with the same value in the other, returning the keys of those which
+//  are missing or differ. Additional entries in the destination (e.g. written
+//  while mirroring) are not considered a mismatch.
+func Verify(ctx context.Context, from, to backend.Datastore) ([]string, error) {
+	mismatched := make([]string, 0)
+
+	it := from.Iterate(ctx, "")
+	defer it.Close()
+
+	for it.Next() {
+		cur, err := to.Get(ctx, it.Key())
+		if err != nil && !backend.IsNotFound(err) {
+			return nil, errors.Wrapf(err, "unable to retrieve record for key %s", it.Key())
+		}
+
+		if !bytes.Equal(cur, it.Value()) {
+			mismatched = append(mismatched, it.Key())
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to iterate records")
+	}
+
+	dest := newHistory(to)
+
+	hit := from.IterateHistory(ctx, "")
+	defer hit.Close()
+
+	for hit.Next() {
+		found, err := dest.take(ctx, backend.HistoryRecordKey(hit.Key()), hit.Value())
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			mismatched = append(mismatched, hit.Key())
+		}
+	}
+
+	if err := hit.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to iterate history")
+	}
+
+	return mismatched, nil
+}
+
+//  history tracks the historical values of a datastore by record key, loaded
+//  as each record key is first seen, to match entries by value
+type history struct {
+	ds     backend.Datastore
+	counts map[string]map[[sha256.Size]byte]int
+}
+
+func newHistory(ds backend.Datastore) *history {
+	return &history{ds: ds, counts: make(map[string]map[[sha256.Size]byte]int)}
+}
+
+//  take reports if an unmatched historical entry with the value exists for the
+//  record key, marking it as matched
+func (h *history) take(ctx context.Context, key string, value []byte) (bool, error) {
+	counts, ok := h.counts[key]
+	if !ok {
+		counts = make(map[[sha256.Size]byte]int)
+
+		it := h.ds.IterateHistory(ctx, key)
+		for it.Next() {
+			counts[sha256.Sum256(it.Value())]++
+		}
+		it.Close()
+
+		if err := it.Err(); err != nil {
+			return false, errors.Wrapf(err, "unable to retrieve history for key %s", key)
+		}
+		h.counts[key] = counts
+	}
+
+	sum := sha256.Sum256(value)
+	if counts[sum] < 1 {
+		return false, nil
+	}
+
+	counts[sum]--
+	return true, nil
+}
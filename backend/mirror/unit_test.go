@@ -0,0 +1,183 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+
+	bolt "github.com/coreos/bbolt"
+)
+
+func open(t *testing.T) (*fileds.Datastore, func()) {
+	what := fmt.Sprintf("psparkles_testing_%d.db", time.Now().UnixNano())
+	ds, err := fileds.Open(what, &bolt.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ds, func() {
+		ds.Close()
+		os.RemoveAll(what)
+	}
+}
+
+func historical(t *testing.T, ds backend.Datastore, key string) []backend.Value {
+	vals, err := backend.Collect(ds.IterateHistory(context.Background(), key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return vals
+}
+
+func TestMirror(t *testing.T) {
+	primary, done := open(t)
+	defer done()
+
+	secondary, done := open(t)
+	defer done()
+
+	ctx, ds := context.Background(), New(primary, secondary)
+
+	if err := ds.SetIfAbsent(ctx, "foo", []byte("v1"), []byte("h1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.CompareAndSwap(ctx, "foo", []byte("v1"), []byte("v2"), []byte("h2")); err != nil {
+		t.Fatal(err)
+	}
+
+	//  conflicts on the primary must not be mirrored
+	if err := ds.CompareAndSwap(ctx, "foo", []byte("v1"), []byte("v3"), []byte("h3")); !backend.IsConflict(err) {
+		t.Errorf("want ErrConflict, got %v", err)
+	}
+
+	for _, d := range []backend.Datastore{primary, secondary} {
+		if got, err := d.Get(ctx, "foo"); err != nil || string(got) != "v2" {
+			t.Errorf("want v2, got %s with error %v", got, err)
+		}
+
+		if n := len(historical(t, d, "foo")); n != 2 {
+			t.Errorf("want 2 historical entries, got %d", n)
+		}
+	}
+
+	//  remove the h1 entry by the primary's historical key
+	for _, v := range historical(t, primary, "foo") {
+		for hkey, val := range v {
+			if val != "h1" {
+				continue
+			}
+
+			if err := ds.RemoveHistory(ctx, hkey); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, d := range []backend.Datastore{primary, secondary} {
+		vals := historical(t, d, "foo")
+		if len(vals) != 1 {
+			t.Fatalf("want 1 historical entry, got %d", len(vals))
+		}
+
+		for _, v := range vals[0] {
+			if v != "h2" {
+				t.Errorf("want h2, got %s", v)
+			}
+		}
+	}
+
+	if err := ds.CompareAndSwap(ctx, "foo", []byte("v2"), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := secondary.Get(ctx, "foo"); !backend.IsNotFound(err) {
+		t.Errorf("want ErrNotFound, got %v", err)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	primary, done := open(t)
+	defer done()
+
+	secondary, done := open(t)
+	defer done()
+
+	ctx, ds := context.Background(), New(primary, secondary)
+
+	if err := ds.Set(ctx, "foo", []byte("bar")); err != nil {
+		t.Fatal(err)
+	}
+
+	//  a closed primary fails every call
+	primary.Close()
+
+	if got, err := ds.Get(ctx, "foo"); err != nil || string(got) != "bar" {
+		t.Errorf("want bar from the secondary, got %s with error %v", got, err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	from, done := open(t)
+	defer done()
+
+	to, done := open(t)
+	defer done()
+
+	ctx := context.Background()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := from.SetIfAbsent(ctx, k, []byte(k), []byte("h"+k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//  already mirrored
+	if err := to.SetIfAbsent(ctx, "a", []byte("a"), []byte("ha")); err != nil {
+		t.Fatal(err)
+	}
+
+	//  differs from the source
+	if err := to.Set(ctx, "b", []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Copy(ctx, from, to, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Records != 1 || r.History != 2 || r.Skipped != 2 {
+		t.Errorf("want 1 record, 2 history, and 2 skipped, got %+v", r)
+	}
+
+	if len(r.Conflicts) != 1 || r.Conflicts[0] != "b" {
+		t.Errorf("want conflict for b, got %v", r.Conflicts)
+	}
+
+	mismatched, err := Verify(ctx, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mismatched) != 1 || mismatched[0] != "b" {
+		t.Errorf("want mismatch for b, got %v", mismatched)
+	}
+
+	if r, err = Copy(ctx, from, to, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Records != 1 || r.History != 0 || len(r.Conflicts) != 0 {
+		t.Errorf("want only b to be overwritten, got %+v", r)
+	}
+
+	if mismatched, err = Verify(ctx, from, to); err != nil || len(mismatched) != 0 {
+		t.Errorf("want no mismatches, got %v with error %v", mismatched, err)
+	}
+}
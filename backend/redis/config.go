@@ -0,0 +1,157 @@
+package redis
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	//  SingleMode connects to a single redis node
+	SingleMode string = "single"
+
+	//  SentinelMode connects to the current master of a Sentinel monitored
+	//  group, following failovers
+	SentinelMode string = "sentinel"
+
+	//  ClusterMode connects to a Redis Cluster, using the provided addresses as
+	//  the seed nodes
+	ClusterMode string = "cluster"
+
+	//  DefaultPrefix is the namespace used for keys when no prefix is provided
+	DefaultPrefix string = "psparkles"
+)
+
+//  Config is the connection configuration for the redis datastore
+type Config struct {
+	//  Mode is one of SingleMode (default), SentinelMode, or ClusterMode
+	Mode string
+
+	//  Addrs is the address of the redis node for SingleMode, the Sentinel
+	//  addresses for SentinelMode, or the seed nodes for ClusterMode
+	Addrs []string
+
+	//  MasterName is the name of the Sentinel monitored master
+	MasterName string
+
+	//  Username and Password are used to authenticate. If a Username is
+	//  provided, the ACL style AUTH (Redis 6+) is used.
+	Username string
+	Password string
+
+	//  DB is the database to select. It is ignored for ClusterMode.
+	DB int
+
+	//  Prefix namespaces all keys written by the datastore, allowing for a
+	//  shared instance / cluster. DefaultPrefix is used if empty.
+	Prefix string
+
+	//  TLS enables TLS connections when not nil
+	TLS *tls.Config
+}
+
+//  TLSConfig generates a TLS config for connecting to redis. The CA file is
+//  optional and, if provided, is used instead of the system roots. The cert
+//  and key files are optional and used for client certificate auth.
+func TLSConfig(caFile, certFile, keyFile, serverName string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if len(caFile) > 0 {
+		ca, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read in CA file")
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no valid certificates found in CA file")
+		}
+		cfg.RootCAs = pool
+	}
+
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load client certificate key pair")
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+//  client creates the relevant redis client for the configured mode
+func (cfg *Config) client() (redis.UniversalClient, error) {
+	if len(cfg.Addrs) < 1 {
+		return nil, errors.New("at least 1 redis address must be provided")
+	}
+
+	passwd, db := cfg.Password, cfg.DB
+	if cfg.Mode == ClusterMode {
+		db = 0
+	}
+
+	//  the client of this version only supports the legacy, password only AUTH
+	//  so ACL auth is performed when the connection is established. Since the
+	//  client would otherwise attempt to AUTH / SELECT prior to this, both are
+	//  handled here instead.
+	var onConnect func(*redis.Conn) error
+	if len(cfg.Username) > 0 {
+		user, pw, sel := cfg.Username, passwd, db
+
+		passwd, db = "", 0
+		onConnect = func(cn *redis.Conn) error {
+			if err := cn.Do("auth", user, pw).Err(); err != nil {
+				return errors.Wrap(err, "unable to authenticate with username and password")
+			}
+
+			if sel > 0 {
+				return cn.Select(sel).Err()
+			}
+			return nil
+		}
+	}
+
+	switch cfg.Mode {
+	case "", SingleMode:
+		return redis.NewClient(&redis.Options{
+			Addr:      cfg.Addrs[0],
+			Password:  passwd,
+			DB:        db,
+			TLSConfig: cfg.TLS,
+			OnConnect: onConnect,
+		}), nil
+
+	case SentinelMode:
+		if len(cfg.MasterName) < 1 {
+			return nil, errors.New("a master name must be provided for sentinel mode")
+		}
+
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    cfg.MasterName,
+			SentinelAddrs: cfg.Addrs,
+			Password:      passwd,
+			DB:            db,
+			TLSConfig:     cfg.TLS,
+			OnConnect:     onConnect,
+		}), nil
+
+	case ClusterMode:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.Addrs,
+			Password:  passwd,
+			TLSConfig: cfg.TLS,
+			OnConnect: onConnect,
+		}), nil
+
+	default:
+		return nil, errors.Errorf("%s is not a supported redis mode", cfg.Mode)
+	}
+}
@@ -1,9 +1,9 @@
 package redis
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
-	"fmt"
+	"bytes"
+	"context"
+	"strings"
 
 	"github.com/manulife-gwam/peppermint-sparkles/backend"
 	log "github.com/sirupsen/logrus"
@@ -14,35 +14,66 @@ import (
 
 const tag string = "peppermint-sparkles.backend.redis"
 
+const (
+	bucket     string = "mints"
+	historical string = "buttermints"
+
+	//  legacyDB and legacyHistoricalDB are the DB indexes used prior to the
+	//  key prefix namespacing
+	legacyDB           int = 0
+	legacyHistoricalDB int = 1
+)
+
 var ErrInvalidDatastore error = errors.New("no valid datastore")
 
+//  Datastore stores the records and history in a single redis keyspace (rather
+//  than a DB per type, which is not supported by Redis Cluster) with the keys
+//  namespaced as:
+//
+//  	<prefix>:mints:{<key>}
+//  	<prefix>:buttermints:{<key>}.<hash>
+//
+//  Modified keys are broadcast for cache invalidation on the channel
+//  <prefix>:invalidations.
+//
+//  The key is wrapped as a hash tag so that a record and its history always
+//  land in the same cluster slot, allowing them to be written in a single
+//  transaction.
 type Datastore struct {
-	client     *redis.Client
-	historical *redis.Client
-}
+	client redis.UniversalClient
+	cfg    *Config
 
-func Open(opts *redis.Options) (*Datastore, error) {
-	ds := &Datastore{}
-
-	opts.DB = 0 //	ensure that is uses the same (default) DB every time
-	ds.client = redis.NewClient(opts)
+	records string
+	history string
+	channel string
+}
 
-	//	ensure a valid connection prior to returning
-	cr, err := ds.client.Ping().Result()
+func Open(cfg *Config) (*Datastore, error) {
+	client, err := cfg.client()
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to ping redis datastore")
+		return nil, errors.Wrap(err, "unable to create redis client")
+	}
+
+	prefix := cfg.Prefix
+	if len(prefix) < 1 {
+		prefix = DefaultPrefix
 	}
-	log.Debugf("client ping result %s", cr)
 
-	opts.DB = 1 //	ensure that is uses the same (default) historical DB every time
-	ds.historical = redis.NewClient(opts)
+	ds := &Datastore{
+		client:  client,
+		cfg:     cfg,
+		records: strings.Join([]string{prefix, bucket, ""}, ":"),
+		history: strings.Join([]string{prefix, historical, ""}, ":"),
+		channel: strings.Join([]string{prefix, invalidations}, ":"),
+	}
 
-	//	ensure a valid connection to the historical store prior to returning
-	hr, err := ds.historical.Ping().Result()
+	//	ensure a valid connection prior to returning
+	res, err := ds.client.Ping().Result()
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to ping historical redis datastore")
+		ds.client.Close()
+		return nil, errors.Wrap(err, "unable to ping redis datastore")
 	}
-	log.Debugf("historical ping result %s", hr)
+	log.Debugf("client ping result %s", res)
 
 	return ds, nil
 }
@@ -52,117 +83,307 @@ func (ds *Datastore) Close() error {
 	if ds.client != nil {
 		return ds.client.Close()
 	}
+	return nil
+}
 
-	if ds.historical != nil {
-		return ds.historical.Close()
+//  with ensures the client is valid and the context has not been cancelled,
+//  returning a copy of the client bound to the context
+func with(ctx context.Context, client redis.UniversalClient) (redis.UniversalClient, error) {
+	if client == nil {
+		return nil, ErrInvalidDatastore
 	}
 
-	return nil
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	switch c := client.(type) {
+	case *redis.Client:
+		return c.WithContext(ctx), nil
+
+	case *redis.ClusterClient:
+		return c.WithContext(ctx), nil
+	}
+
+	return client, nil
 }
 
-func keys(client *redis.Client) ([]string, error) {
-	keys := make([]string, 0)
-	if client != nil {
-		k, err := client.Keys("*").Result()
-		if err != nil {
-			return keys, err
-		}
+//  recordKey namespaces the key of a record
+func (ds *Datastore) recordKey(key string) string {
+	return ds.records + "{" + key + "}"
+}
 
-		for _, v := range k {
-			keys = append(keys, v)
+//  historyKey generates and namespaces the key of a new historical entry for
+//  the record key
+func (ds *Datastore) historyKey(key string, value []byte) (string, error) {
+	hkey, err := backend.HistoryKey(key, value)
+	if err != nil {
+		return "", err
+	}
+
+	return ds.history + "{" + key + "}" + strings.TrimPrefix(hkey, key), nil
+}
+
+//  wrapHistory namespaces an existing historical key, using the record key
+//  portion (prior to the last '.') as the hash tag
+func (ds *Datastore) wrapHistory(hkey string) string {
+	key := backend.HistoryRecordKey(hkey)
+	return ds.history + "{" + key + "}" + strings.TrimPrefix(hkey, key)
+}
+
+//  unwrap strips the namespace and hash tag of the provided redis key,
+//  returning the key as known by the caller
+func unwrap(ns, key string) string {
+	k := strings.TrimPrefix(key, ns)
+	if strings.HasPrefix(k, "{") {
+		if i := strings.Index(k, "}"); i > 0 {
+			return k[1:i] + k[i+1:]
 		}
 	}
-	return keys, nil
+	return k
 }
 
-func (ds *Datastore) Keys() []string {
-	vals, err := keys(ds.client)
+//  Keys iterates over the available keys using SCAN and returns as a list.
+func (ds *Datastore) Keys(ctx context.Context) ([]string, error) {
+	return backend.CollectKeys(ds.Iterate(ctx, ""))
+}
+
+func (ds *Datastore) Set(ctx context.Context, key string, value []byte) error {
+	c, err := with(ctx, ds.client)
 	if err != nil {
-		//	log error but still return the empty list
-		log.Error(err, "unable to retrieve keys")
+		return err
 	}
-	return vals
+	return c.Set(ds.recordKey(key), value, 0).Err()
 }
 
-func (ds *Datastore) Set(key, value string) error {
-	if ds.client == nil {
-		return ErrInvalidDatastore
+func (ds *Datastore) Get(ctx context.Context, key string) ([]byte, error) {
+	c, err := with(ctx, ds.client)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.Get(ds.recordKey(key)).Bytes()
+	if err != nil {
+		if err == redis.Nil {
+			return nil, backend.ErrNotFound
+		}
+		return nil, errors.Wrap(err, "unable to retrieve result for key")
 	}
-	return ds.client.Set(key, value, 0).Err()
+
+	return res, nil
 }
 
-func get(key string, client *redis.Client) string {
-	res, err := client.Get(key).Result()
-	if err != nil && err != redis.Nil {
-		//	log error but still return the empty string
-		log.Error(err, "unable to retrieve result for key")
-		return ""
+func (ds *Datastore) Remove(ctx context.Context, key string) error {
+	c, err := with(ctx, ds.client)
+	if err != nil {
+		return err
 	}
-	return res
+	return c.Del(ds.recordKey(key)).Err()
 }
 
-func (ds *Datastore) Get(key string) string {
-	return get(key, ds.client)
+func (ds *Datastore) List(ctx context.Context) ([]backend.Value, error) {
+	return backend.Collect(ds.Iterate(ctx, ""))
 }
 
-func (ds *Datastore) Remove(key string) error {
-	if ds.client == nil {
-		return ErrInvalidDatastore
+func (ds *Datastore) AddHistory(ctx context.Context, key string, value []byte) error {
+	c, err := with(ctx, ds.client)
+	if err != nil {
+		return err
+	}
+
+	hkey, err := ds.historyKey(key, value)
+	if err != nil {
+		return err
 	}
 
-	return ds.client.Del(key).Err()
+	return c.Set(hkey, value, 0).Err()
 }
 
-func (ds *Datastore) List() ([]backend.Value, error) {
-	if ds.client == nil {
-		return nil, ErrInvalidDatastore
+//  RemoveHistory deletes the historical entry for the provided historical key.
+//  No error is returned if the historical key does not exist.
+func (ds *Datastore) RemoveHistory(ctx context.Context, hkey string) error {
+	c, err := with(ctx, ds.client)
+	if err != nil {
+		return err
 	}
+	return c.Del(ds.wrapHistory(hkey)).Err()
+}
 
-	vals := make([]backend.Value, 0)
-	for _, k := range ds.Keys() {
-		vals = append(vals, backend.Value{k: ds.Get(k)})
+func (ds *Datastore) Historical(ctx context.Context) ([]backend.Value, error) {
+	return backend.Collect(ds.IterateHistory(ctx, ""))
+}
+
+//  commit queues the write (or removal if value is nil) of the record along
+//  with the optional history as a MULTI / EXEC on the watched transaction
+func (ds *Datastore) commit(tx *redis.Tx, key string, value, history []byte) error {
+	var hkey string
+	if history != nil {
+		k, err := ds.historyKey(key, history)
+		if err != nil {
+			return err
+		}
+		hkey = k
 	}
 
-	return vals, nil
+	_, err := tx.Pipelined(func(pipe redis.Pipeliner) error {
+		if value == nil {
+			pipe.Del(ds.recordKey(key))
+		} else {
+			pipe.Set(ds.recordKey(key), value, 0)
+		}
+
+		if history != nil {
+			pipe.Set(hkey, history, 0)
+		}
+		return nil
+	})
+
+	return err
 }
 
-func (ds *Datastore) AddHistory(value string) error {
-	if ds.historical == nil {
-		return ErrInvalidDatastore
+//  SetIfAbsent stores the value only if no value exists for the key, returning
+//  backend.ErrExists otherwise. When no history is provided, SETNX is used
+//  directly. Otherwise, the key is watched and the record and history are
+//  written in a single MULTI / EXEC.
+func (ds *Datastore) SetIfAbsent(ctx context.Context, key string, value, history []byte) error {
+	c, err := with(ctx, ds.client)
+	if err != nil {
+		return err
 	}
 
-	buf := make([]byte, 2048)
-	if _, err := rand.Read(buf); err != nil {
-		return errors.Wrap(err, "unable to read in random data to generate key")
+	rkey := ds.recordKey(key)
+
+	if history == nil {
+		ok, err := c.SetNX(rkey, value, 0).Result()
+		if err != nil {
+			return errors.Wrap(err, "unable to set value for key")
+		}
+
+		if !ok {
+			return backend.ErrExists
+		}
+		return nil
 	}
 
-	//	generate SHA256 token from random content to be stored + random data to
-	// 	attempt to prevent collisions
-	key := fmt.Sprintf("%x", sha256.Sum256(append([]byte(value), buf...)))
+	err = c.Watch(func(tx *redis.Tx) error {
+		n, err := tx.Exists(rkey).Result()
+		if err != nil {
+			return errors.Wrap(err, "unable to check existence of key")
+		}
 
-	return ds.historical.Set(key, value, 0).Err()
+		if n > 0 {
+			return backend.ErrExists
+		}
+
+		return ds.commit(tx, key, value, history)
+	}, rkey)
+
+	//  the watched key was modified between the check and EXEC
+	if err == redis.TxFailedErr {
+		return backend.ErrExists
+	}
+
+	return err
 }
 
-func (ds *Datastore) historicalKeys() []string {
-	vals, err := keys(ds.historical)
+//  CompareAndSwap replaces the value for the key only if the current value
+//  matches old, returning backend.ErrConflict otherwise. A nil value removes
+//  the key. The key is watched and the record and history are written in a
+//  single MULTI / EXEC.
+func (ds *Datastore) CompareAndSwap(ctx context.Context, key string, old, value, history []byte) error {
+	c, err := with(ctx, ds.client)
 	if err != nil {
-		//	log error but still return the empty list
-		log.Error(err, "unable to retrieve historical keys")
+		return err
+	}
+
+	rkey := ds.recordKey(key)
+
+	err = c.Watch(func(tx *redis.Tx) error {
+		cur, err := tx.Get(rkey).Bytes()
+		if err != nil {
+			if err != redis.Nil {
+				return errors.Wrap(err, "unable to retrieve current value for key")
+			}
+			cur = nil
+		}
+
+		if (cur == nil) != (old == nil) || !bytes.Equal(cur, old) {
+			return backend.ErrConflict
+		}
+
+		return ds.commit(tx, key, value, history)
+	}, rkey)
+
+	//  the watched key was modified between the compare and EXEC
+	if err == redis.TxFailedErr {
+		return backend.ErrConflict
 	}
-	return vals
+
+	return err
 }
 
-func (ds *Datastore) Historical() ([]backend.Value, error) {
-	if ds.historical == nil {
-		return nil, ErrInvalidDatastore
+//  ImportLegacy copies the records and history stored in the DB index layout
+//  used prior to the key prefix namespacing (records in DB 0, history in DB 1)
+//  into the namespaced layout. Existing namespaced entries are not overwritten
+//  and the legacy keys are left in place. The number of records and historical
+//  entries imported is returned.
+func (ds *Datastore) ImportLegacy(ctx context.Context) (int, error) {
+	if ds.cfg.Mode == ClusterMode {
+		return 0, errors.New("legacy DB index layout is not supported in cluster mode")
 	}
 
-	vals := make([]backend.Value, 0)
-	for _, k := range ds.historicalKeys() {
-		if res := get(k, ds.historical); len(res) > 0 {
-			vals = append(vals, backend.Value{k: res})
+	var total int
+	for db, wrap := range map[int]func(k string) string{
+		legacyDB:           ds.recordKey,
+		legacyHistoricalDB: ds.wrapHistory,
+	} {
+		n, err := ds.importLegacy(ctx, db, wrap)
+		total += n
+
+		if err != nil {
+			return total, errors.Wrapf(err, "unable to import legacy DB %d", db)
+		}
+	}
+
+	return total, nil
+}
+
+func (ds *Datastore) importLegacy(ctx context.Context, db int, wrap func(k string) string) (int, error) {
+	cfg := *ds.cfg
+	cfg.DB = db
+
+	legacy, err := cfg.client()
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to create legacy redis client")
+	}
+	defer legacy.Close()
+
+	c, err := with(ctx, ds.client)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+
+	it := iterate(ctx, []*redis.Client{legacy.(*redis.Client)}, "", "*")
+	defer it.Close()
+
+	for it.Next() {
+		//  skip anything already namespaced since DB 0 may be shared
+		k := it.Key()
+		if strings.HasPrefix(k, ds.records) || strings.HasPrefix(k, ds.history) {
+			continue
+		}
+
+		ok, err := c.SetNX(wrap(k), it.Value(), 0).Result()
+		if err != nil {
+			return n, errors.Wrapf(err, "unable to import legacy key %s", k)
+		}
+
+		if ok {
+			n++
 		}
 	}
 
-	return vals, nil
+	return n, it.Err()
 }
@@ -3,15 +3,15 @@
 package redis
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os/exec"
 	"testing"
 	"time"
 
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
 	log "github.com/sirupsen/logrus"
-
-	"github.com/go-redis/redis"
 )
 
 func init() {
@@ -46,7 +46,7 @@ func TestOpen(t *testing.T) {
 	}
 	defer kill(name)
 
-	ds, err := Open(&redis.Options{Addr: fmt.Sprintf("localhost:%s", port)})
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -61,7 +61,7 @@ func TestClose(t *testing.T) {
 	}
 	defer kill(name)
 
-	ds, err := Open(&redis.Options{Addr: fmt.Sprintf("localhost:%s", port)})
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -79,18 +79,25 @@ func TestKeys(t *testing.T) {
 	}
 	defer kill(name)
 
-	ds, err := Open(&redis.Options{Addr: fmt.Sprintf("localhost:%s", port)})
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer ds.Close()
 
-	if keys := ds.Keys(); len(keys) > 0 {
+	ctx := context.Background()
+
+	keys, err := ds.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) > 0 {
 		t.Error("keys should have been empty")
 
 		//	empty, just in case
 		for _, k := range keys {
-			if err := ds.Remove(k); err != nil {
+			if err := ds.Remove(ctx, k); err != nil {
 				t.Fatal(err)
 			}
 		}
@@ -99,12 +106,15 @@ func TestKeys(t *testing.T) {
 	wants := []string{"foo", "bar", "baz"}
 	for _, w := range wants {
 		r := rand.NewSource(time.Now().UnixNano()).Int63()
-		if err := ds.Set(w, fmt.Sprintf("%d", r)); err != nil {
+		if err := ds.Set(ctx, w, []byte(fmt.Sprintf("%d", r))); err != nil {
 			t.Fatal(err)
 		}
 	}
 
-	keys := ds.Keys()
+	keys, err = ds.Keys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
 	if got, want := len(keys), len(wants); want != got {
 		t.Errorf("\nwant %d\ngot %d\n", want, got)
 	}
@@ -131,32 +141,38 @@ func TestSetGet(t *testing.T) {
 	}
 	defer kill(name)
 
-	ds, err := Open(&redis.Options{Addr: fmt.Sprintf("localhost:%s", port)})
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer ds.Close()
 
+	ctx := context.Background()
+
 	key, bar := "foo", "bar"
-	if got := ds.Get(key); len(got) > 0 {
-		t.Error("expected an empty result but returned", got)
+	if got, err := ds.Get(ctx, key); !backend.IsNotFound(err) {
+		t.Errorf("expected a not found error but returned %s with error %v", got, err)
 	}
 
-	if err := ds.Set(key, bar); err != nil {
+	if err := ds.Set(ctx, key, []byte(bar)); err != nil {
 		t.Fatal(err)
 	}
 
-	if got := ds.Get(key); bar != got {
-		t.Errorf("\nwant %s\ngot %s\n", bar, got)
+	if got, err := ds.Get(ctx, key); err != nil || bar != string(got) {
+		t.Errorf("\nwant %s\ngot %s\nerr %v\n", bar, got, err)
 	}
 
 	baz := "baz"
-	if err := ds.Set(key, baz); err != nil {
+	if err := ds.Set(ctx, key, []byte(baz)); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ds.Get(ctx, key)
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	got := ds.Get(key)
-	switch got {
+	switch got := string(raw); got {
 	case bar:
 		t.Error("value remains the same after an update")
 
@@ -176,28 +192,30 @@ func TestRemove(t *testing.T) {
 	}
 	defer kill(name)
 
-	ds, err := Open(&redis.Options{Addr: fmt.Sprintf("localhost:%s", port)})
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer ds.Close()
 
+	ctx := context.Background()
+
 	key, bar := "foo", "bar"
-	if err := ds.Set(key, bar); err != nil {
+	if err := ds.Set(ctx, key, []byte(bar)); err != nil {
 		t.Fatal(err)
 	}
 
 	//	test if set worked
-	if got := ds.Get(key); bar != got {
-		t.Errorf("\nwant %s\ngot %s\n", bar, got)
+	if got, err := ds.Get(ctx, key); err != nil || bar != string(got) {
+		t.Errorf("\nwant %s\ngot %s\nerr %v\n", bar, got, err)
 	}
 
-	if err := ds.Remove(key); err != nil {
+	if err := ds.Remove(ctx, key); err != nil {
 		t.Fatal(err)
 	}
 
-	if got := ds.Get(key); len(got) > 0 || got == bar {
-		t.Errorf("non-empty value of %s was returned after removal", got)
+	if got, err := ds.Get(ctx, key); !backend.IsNotFound(err) {
+		t.Errorf("value of %s was returned after removal with error %v", got, err)
 	}
 }
 
@@ -209,7 +227,7 @@ func TestList(t *testing.T) {
 	}
 	defer kill(name)
 
-	ds, err := Open(&redis.Options{Addr: fmt.Sprintf("localhost:%s", port)})
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -222,18 +240,68 @@ func TestList(t *testing.T) {
 		"796362b8b4289fca4d666ab486487d6699e828f9c098fc1c91566c291ef682f6": "biz",
 	}
 
+	ctx := context.Background()
+
 	//	fill the datastore with sample values
 	for k, v := range wants {
-		if err := ds.Set(k, v); err != nil {
+		if err := ds.Set(ctx, k, []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gots, err := ds.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, vals := range gots {
+		for k, got := range vals {
+			if want, ok := wants[k]; !ok || want != got {
+				t.Errorf("\nwant %s\ngot %s\n---\n", want, got)
+			}
+		}
+	}
+}
+
+func TestIterate(t *testing.T) {
+	name := fmt.Sprintf("redis_%d", time.Now().UnixNano())
+	port := getPort()
+	if err := boot(name, port); err != nil {
+		t.Fatal(err)
+	}
+	defer kill(name)
+
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	ctx := context.Background()
+
+	//	ensure there are more entries than a single SCAN batch
+	wants := make(map[string]string)
+	for i := 0; i < int(scanCount*2)+5; i++ {
+		k, v := fmt.Sprintf("foo.%03d", i), fmt.Sprintf("%d", i)
+		if err := ds.Set(ctx, k, []byte(v)); err != nil {
 			t.Fatal(err)
 		}
+		wants[k] = v
+	}
+
+	if err := ds.Set(ctx, "bar", []byte("baz")); err != nil {
+		t.Fatal(err)
 	}
 
-	gots, err := ds.List()
+	gots, err := backend.Collect(ds.Iterate(ctx, "foo."))
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if want, got := len(wants), len(gots); want != got {
+		t.Errorf("\nwant %d\ngot %d\n", want, got)
+	}
+
 	for _, vals := range gots {
 		for k, got := range vals {
 			if want, ok := wants[k]; !ok || want != got {
@@ -242,3 +310,140 @@ func TestList(t *testing.T) {
 		}
 	}
 }
+
+func TestHistory(t *testing.T) {
+	name := fmt.Sprintf("redis_%d", time.Now().UnixNano())
+	port := getPort()
+	if err := boot(name, port); err != nil {
+		t.Fatal(err)
+	}
+	defer kill(name)
+
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	ctx := context.Background()
+
+	key, bar, baz := "foo", []byte("bar"), []byte("baz")
+	if err := ds.SetIfAbsent(ctx, key, bar, bar); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.SetIfAbsent(ctx, key, baz, baz); !backend.IsExists(err) {
+		t.Errorf("expected an exists error but returned %v", err)
+	}
+
+	if err := ds.CompareAndSwap(ctx, key, baz, bar, nil); !backend.IsConflict(err) {
+		t.Errorf("expected a conflict error for a stale value but returned %v", err)
+	}
+
+	if err := ds.CompareAndSwap(ctx, key, bar, nil, baz); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := ds.Get(ctx, key); !backend.IsNotFound(err) {
+		t.Errorf("value of %s was returned after removal with error %v", got, err)
+	}
+
+	//	both the create and removal should be in the history of the key
+	histo, err := backend.Collect(ds.IterateHistory(ctx, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 2, len(histo); want != got {
+		t.Errorf("\nwant %d\ngot %d\n", want, got)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	name := fmt.Sprintf("redis_%d", time.Now().UnixNano())
+	port := getPort()
+	if err := boot(name, port); err != nil {
+		t.Fatal(err)
+	}
+	defer kill(name)
+
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	ctx := context.Background()
+
+	//	ensure there are more entries than a single SCAN page
+	wants := make(map[string]string)
+	for i := 0; i < 1500; i++ {
+		k, v := fmt.Sprintf("foo.%04d", i), fmt.Sprintf("%d", i)
+		if err := ds.SetIfAbsent(ctx, k, []byte(v), []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+		wants[k] = v
+	}
+
+	records, history := make(map[string]string), make(map[string]string)
+	err = ds.Snapshot(ctx, func(k string, v []byte) error {
+		records[k] = string(v)
+		return nil
+	}, func(k string, v []byte) error {
+		history[backend.HistoryRecordKey(k)] = string(v)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, got := range []map[string]string{records, history} {
+		if want, got := len(wants), len(got); want != got {
+			t.Errorf("\nwant %d\ngot %d\n", want, got)
+		}
+
+		for k, want := range wants {
+			if got[k] != want {
+				t.Errorf("%s\nwant %s\ngot %s\n", k, want, got[k])
+			}
+		}
+	}
+}
+
+func TestInvalidations(t *testing.T) {
+	name := fmt.Sprintf("redis_%d", time.Now().UnixNano())
+	port := getPort()
+	if err := boot(name, port); err != nil {
+		t.Fatal(err)
+	}
+	defer kill(name)
+
+	ds, err := Open(&Config{Addrs: []string{fmt.Sprintf("localhost:%s", port)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ds.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys := make(chan string, 1)
+	go ds.Listen(ctx, func(key string) { keys <- key })
+
+	//  allow the subscription to be established prior to publishing
+	time.Sleep(100 * time.Millisecond)
+
+	if err := ds.Publish(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-keys:
+		if got != "foo" {
+			t.Errorf("\nwant foo\ngot %s\n", got)
+		}
+
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for invalidation")
+	}
+}
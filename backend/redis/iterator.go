@@ -0,0 +1,207 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+//  scanCount is the hint provided to SCAN for the number of keys to return per
+//  call. Redis may return more or less than this.
+const scanCount int64 = 100
+
+//  globEscaper escapes the glob-style pattern characters for a SCAN MATCH
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
+//  iterator walks the keyspace using cursor-based SCAN rather than KEYS, which
+//  blocks redis for the duration of the call. For Redis Cluster, each master
+//  is scanned in turn. Values are retrieved with a pipeline of GETs per batch
+//  of keys returned by SCAN, since an MGET across slots is not allowed in
+//  cluster mode. As per the SCAN guarantees, a key may be returned more than
+//  once and keys added / removed during iteration may or may not be returned.
+type iterator struct {
+	ctx   context.Context
+	nodes []*redis.Client
+	ns    string
+	match string
+
+	node    int
+	cursor  uint64
+	started bool
+	keys    []string
+	vals    [][]byte
+	pos     int
+	err     error
+}
+
+func iterate(ctx context.Context, nodes []*redis.Client, ns, match string) *iterator {
+	return &iterator{
+		ctx:   ctx,
+		nodes: nodes,
+		ns:    ns,
+		match: match,
+		pos:   -1,
+	}
+}
+
+//  nodes returns the clients to be scanned, which is each of the masters for
+//  Redis Cluster or the single client otherwise
+func (ds *Datastore) nodes() ([]*redis.Client, error) {
+	switch c := ds.client.(type) {
+	case *redis.Client:
+		return []*redis.Client{c}, nil
+
+	case *redis.ClusterClient:
+		var (
+			mu    sync.Mutex
+			nodes []*redis.Client
+		)
+
+		err := c.ForEachMaster(func(client *redis.Client) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			nodes = append(nodes, client)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to retrieve cluster masters")
+		}
+
+		return nodes, nil
+	}
+
+	return nil, ErrInvalidDatastore
+}
+
+//  Iterate returns an iterator over the current entries with keys starting
+//  with prefix
+func (ds *Datastore) Iterate(ctx context.Context, prefix string) backend.Iterator {
+	nodes, err := ds.nodes()
+
+	it := iterate(ctx, nodes, ds.records, ds.records+"{"+globEscaper.Replace(prefix)+"*")
+	it.err = err
+
+	return it
+}
+
+//  IterateHistory returns an iterator over the historical entries for the key
+func (ds *Datastore) IterateHistory(ctx context.Context, key string) backend.Iterator {
+	match := ds.history + "*"
+	if len(key) > 0 {
+		match = ds.history + "{" + globEscaper.Replace(key) + "}*"
+	}
+
+	nodes, err := ds.nodes()
+
+	it := iterate(ctx, nodes, ds.history, match)
+	it.err = err
+
+	return it
+}
+
+func (it *iterator) fetch() error {
+	if err := it.ctx.Err(); err != nil {
+		return err
+	}
+
+	c := it.nodes[it.node].WithContext(it.ctx)
+
+	keys, cursor, err := c.Scan(it.cursor, it.match, scanCount).Result()
+	if err != nil {
+		return errors.Wrap(err, "unable to scan keys")
+	}
+	it.cursor, it.started = cursor, true
+	it.keys, it.vals, it.pos = it.keys[:0], it.vals[:0], 0
+
+	if len(keys) < 1 {
+		return nil
+	}
+
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err = c.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, k := range keys {
+			cmds[i] = pipe.Get(k)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return errors.Wrap(err, "unable to retrieve values for keys")
+	}
+
+	for i, cmd := range cmds {
+		v, err := cmd.Bytes()
+		if err != nil {
+			//  the key was removed since being scanned
+			if err == redis.Nil {
+				continue
+			}
+			return errors.Wrapf(err, "unable to retrieve value for key %s", keys[i])
+		}
+
+		it.keys = append(it.keys, unwrap(it.ns, keys[i]))
+		it.vals = append(it.vals, v)
+	}
+
+	return nil
+}
+
+func (it *iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+
+	if it.pos++; it.pos < len(it.keys) {
+		return true
+	}
+
+	//  a SCAN batch may be empty even though the iteration is not complete, so
+	//  continue until either a non-empty batch or the cursor returns to 0 for
+	//  the last of the nodes
+	for it.node < len(it.nodes) {
+		if it.started && it.cursor == 0 {
+			it.node, it.started = it.node+1, false
+			continue
+		}
+
+		if err := it.fetch(); err != nil {
+			it.err = err
+			return false
+		}
+
+		if len(it.keys) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (it *iterator) Key() string {
+	if it.pos < 0 || it.pos >= len(it.keys) {
+		return ""
+	}
+	return it.keys[it.pos]
+}
+
+func (it *iterator) Value() []byte {
+	if it.pos < 0 || it.pos >= len(it.vals) {
+		return nil
+	}
+	return it.vals[it.pos]
+}
+
+func (it *iterator) Err() error {
+	return it.err
+}
+
+func (it *iterator) Close() error {
+	it.keys, it.vals = nil, nil
+	it.node = len(it.nodes)
+	return nil
+}
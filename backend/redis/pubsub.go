@@ -0,0 +1,61 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+//  invalidations is the name of the channel, under the key prefix, used to
+//  broadcast modified keys
+const invalidations string = "invalidations"
+
+//  Publish broadcasts the modified key to all instances listening on the
+//  invalidation channel of the key prefix
+func (ds *Datastore) Publish(ctx context.Context, key string) error {
+	c, err := with(ctx, ds.client)
+	if err != nil {
+		return err
+	}
+	return c.Publish(ds.channel, key).Err()
+}
+
+//  Listen subscribes to the invalidation channel of the key prefix, calling fn
+//  with each key published until the context is cancelled or the subscription
+//  fails. Messages published while not subscribed are lost, so the caller
+//  should assume any key may have been modified when an error is returned.
+func (ds *Datastore) Listen(ctx context.Context, fn func(key string)) error {
+	if ds.client == nil {
+		return ErrInvalidDatastore
+	}
+
+	ps := ds.client.Subscribe(ds.channel)
+	defer ps.Close()
+
+	//  closing the subscription unblocks the receive once cancelled
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			ps.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		msg, err := ps.Receive()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return errors.Wrap(err, "unable to receive invalidation")
+		}
+
+		if m, ok := msg.(*redis.Message); ok {
+			fn(m.Payload)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+)
+
+//  Snapshot walks the records and then the history a page of keys at a time
+//  (see iterator), so redis is only ever held up for a single SCAN and pipeline
+//  of GETs and only a page of values is held in memory. Each value is read
+//  atomically, though the snapshot is not of a single point in time. Records
+//  are written along with their history in a single MULTI / EXEC, and the
+//  records are walked first, so the history written alongside every record
+//  included is also included (unless removed by compaction in the meantime).
+//  Keys returned more than once by SCAN are only included once, the keys
+//  walked being held in memory to do so.
+func (ds *Datastore) Snapshot(ctx context.Context, records, history func(key string, value []byte) error) error {
+	if err := walk(ds.Iterate(ctx, ""), records); err != nil {
+		return err
+	}
+	return walk(ds.IterateHistory(ctx, ""), history)
+}
+
+//  walk calls fn with each of the entries of the iterator, skipping any key
+//  already seen
+func walk(it backend.Iterator, fn func(key string, value []byte) error) error {
+	defer it.Close()
+
+	seen := make(map[string]struct{})
+	for it.Next() {
+		k := it.Key()
+		if _, ok := seen[k]; ok {
+			continue
+		}
+		seen[k] = struct{}{}
+
+		if err := fn(k, it.Value()); err != nil {
+			return err
+		}
+	}
+
+	return it.Err()
+}
@@ -0,0 +1,78 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend/cache"
+)
+
+//  ensure the datastore can be used for cache invalidation
+var _ cache.Invalidator = (*Datastore)(nil)
+
+func TestNamespacing(t *testing.T) {
+	ds := &Datastore{
+		records: "psparkles:mints:",
+		history: "psparkles:buttermints:",
+	}
+
+	key := "6f0f9805-08c6-48f2-b3c4-fe8e7c35ea4a"
+
+	rkey := ds.recordKey(key)
+	if want, got := "psparkles:mints:{"+key+"}", rkey; want != got {
+		t.Errorf("\nwant %s\ngot %s\n", want, got)
+	}
+
+	if want, got := key, unwrap(ds.records, rkey); want != got {
+		t.Errorf("\nwant %s\ngot %s\n", want, got)
+	}
+
+	hkey, err := ds.historyKey(key, []byte("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//	the record and history must share the same hash tag to be in the same
+	//	cluster slot
+	if want := "psparkles:buttermints:{" + key + "}."; !strings.HasPrefix(hkey, want) {
+		t.Errorf("\nwant prefix %s\ngot %s\n", want, hkey)
+	}
+
+	if got := unwrap(ds.history, hkey); !strings.HasPrefix(got, key+".") || strings.ContainsAny(got, "{}") {
+		t.Errorf("unexpected unwrapped historical key %s", got)
+	}
+}
+
+//  entries iterates the keys and values in order
+type entries struct {
+	keys, vals []string
+	pos        int
+}
+
+func (e *entries) Next() bool {
+	e.pos++
+	return e.pos <= len(e.keys)
+}
+
+func (e *entries) Key() string   { return e.keys[e.pos-1] }
+func (e *entries) Value() []byte { return []byte(e.vals[e.pos-1]) }
+func (e *entries) Err() error    { return nil }
+func (e *entries) Close() error  { return nil }
+
+func TestWalk(t *testing.T) {
+	//	SCAN may return a key more than once
+	it := &entries{keys: []string{"a", "b", "a", "c", "b"}, vals: []string{"1", "2", "1", "3", "2"}}
+
+	var got []string
+	err := walk(it, func(k string, v []byte) error {
+		got = append(got, k+"="+string(v))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "a=1 b=2 c=3", strings.Join(got, " "); want != got {
+		t.Errorf("\nwant %s\ngot %s\n", want, got)
+	}
+}
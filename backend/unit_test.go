@@ -9,16 +9,12 @@ import "testing"
 
 func TestKey(t *testing.T) {
 	wants := map[string][][]string{
-		"97df3588b5a3f24babc3851b372f0ba71a9dcdded43b14b9d06961bfc1707d9d34b379d1190316e4d5f8492140a8781d7ee37caa3cc7521bb58d49cf3b659e0e": {{"foo", "bar", "baz"}},
-		"ebf3b019bb7e36bdc0fbc4159345c04af54193ccf43ae4572922f6d4aa94bd5b34b379d1190316e4d5f8492140a8781d7ee37caa3cc7521bb58d49cf3b659e0e": {{"foo", "bar", "baz", "biz"}},
-		"2c60dbf3773104dce76dfbda9b82a729e98a42a7a0b3f9bae5095c7bed752b9034b379d1190316e4d5f8492140a8781d7ee37caa3cc7521bb58d49cf3b659e0e": {
-			{"foo", "bar", "bazz"},
-			{"foo", "bar", "baz", "z"},
-		},
-		"796362b8b4289fca4d666ab486487d6699e828f9c098fc1c91566c291ef682f634b379d1190316e4d5f8492140a8781d7ee37caa3cc7521bb58d49cf3b659e0e": {
-			{"foo", "bar", "baz z"},
-			{"foo", "bar", "baz", " z"},
-		},
+		"04cfed926dc73fbc7a10c944d727c7d2fbfc61e90ca962fb3114bc9ec510236c4740ce259addc25ad7a923d8a80b1dab522eed3840ee236b417ba1c3098e4fd2": {{"foo", "bar", "baz"}},
+		"1399f94e1440e87930e2b704e46379c08ec7aaf07b503ac93c8f0253cd5c3eae4740ce259addc25ad7a923d8a80b1dab522eed3840ee236b417ba1c3098e4fd2": {{"foo", "bar", "baz", "biz"}},
+		"9e7b33b93c4c3a2afa047e841c83cb3c20ac6259751d41fd86119f9fb0e7be054740ce259addc25ad7a923d8a80b1dab522eed3840ee236b417ba1c3098e4fd2": {{"foo", "bar", "bazz"}},
+		"1e507f75b971ff3300bea6219ef9d6c7f4bcecbb404147438788577082ea2f214740ce259addc25ad7a923d8a80b1dab522eed3840ee236b417ba1c3098e4fd2": {{"foo", "bar", "baz", "z"}},
+		"b7b3ba7871ce92fe6a8a020a0b5a50c08d12dbe919c9c9b5e8152ea3756ae70d4740ce259addc25ad7a923d8a80b1dab522eed3840ee236b417ba1c3098e4fd2": {{"foo", "bar", "baz z"}},
+		"16b30f39db089da852c88851c7701fa61c4c1e7bcd2068d05867864e672f28b04740ce259addc25ad7a923d8a80b1dab522eed3840ee236b417ba1c3098e4fd2": {{"foo", "bar", "baz", " z"}},
 	}
 
 	app, env := "test", "testing"
@@ -30,3 +26,47 @@ func TestKey(t *testing.T) {
 		}
 	}
 }
+
+func TestKeySuffix(t *testing.T) {
+	//	the app must be part of the suffix, not just the environment
+	if a, b := KeySuffix("foo", "test"), KeySuffix("bar", "test"); a == b {
+		t.Errorf("different apps in the same environment produced the same suffix %s", a)
+	}
+
+	if a, b := KeySuffix("foo", "test"), KeySuffix("foo", "prod"); a == b {
+		t.Errorf("the same app in different environments produced the same suffix %s", a)
+	}
+}
+
+func TestKeyCollision(t *testing.T) {
+	//	moving bytes between the app and environment must change the suffix
+	if a, b := KeySuffix("ab", "c"), KeySuffix("a", "bc"); a == b {
+		t.Errorf("app ab / env c and app a / env bc produced the same suffix %s", a)
+	}
+
+	if a, b := KeySuffix("", "abc"), KeySuffix("abc", ""); a == b {
+		t.Errorf("an empty app and an empty env produced the same suffix %s", a)
+	}
+
+	//	as must moving bytes between the values
+	if a, b := Key("foo", "test", "ab", "c"), Key("foo", "test", "a", "bc"); a == b {
+		t.Errorf("values ab, c and a, bc produced the same key %s", a)
+	}
+
+	if a, b := Key("foo", "test", "abc"), Key("foo", "test", "abc", ""); a == b {
+		t.Errorf("a trailing empty value produced the same key %s", a)
+	}
+}
+
+func TestHistoryRecordKey(t *testing.T) {
+	key := Key("foo", "test", "6f0f9805-08c6-48f2-b3c4-fe8e7c35ea4a")
+
+	hkey, err := HistoryKey(key, []byte("bar"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := HistoryRecordKey(hkey); got != key {
+		t.Errorf("\nwant %s\ngot %s\n", key, got)
+	}
+}
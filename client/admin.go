@@ -0,0 +1,29 @@
+package client
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/manulife-gwam/peppermint-sparkles/service"
+)
+
+//  Backup streams a backup of the datastore from the secrets service, Token
+//  being the admin token. The caller closes the backup, which should be
+//  verified as it is read (see backup.Transcode) since the stream may be cut
+//  short. Backups are neither retried nor limited by Timeout.
+func (c *Client) Backup(ctx context.Context) (io.ReadCloser, error) {
+	res, err := c.send(ctx, http.MethodGet, service.PathBackup, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if code := res.StatusCode; code != http.StatusOK {
+		defer res.Body.Close()
+
+		b, _ := ioutil.ReadAll(res.Body)
+		return nil, &StatusError{Code: code, Message: string(b)}
+	}
+	return res.Body, nil
+}
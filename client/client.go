@@ -0,0 +1,209 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/sign"
+
+	"github.com/pkg/errors"
+)
+
+//  DefaultBackoff is the wait before the first retry when no backoff is set,
+//  doubling with each retry
+const DefaultBackoff time.Duration = 250 * time.Millisecond
+
+var schemeExp = regexp.MustCompile(`^(?P<scheme>http(s)?):\/\/`)
+
+//  ErrNotFound is returned when there is no active secret (or history) for the
+//  ID, app and environment
+var ErrNotFound = errors.New("no valid secret")
+
+//  StatusError is returned for any other unsuccessful response from the
+//  secrets service
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("secrets service responded with status code %d and message %s", e.Code, e.Message)
+}
+
+//  Client calls the secrets service, encrypting and signing content as it is
+//  sent and verifying and decrypting it as it is retrieved, so the service
+//  only ever sees encrypted content.
+//
+//  	c := &client.Client{
+//  		Addr:       "https://sparkles.example.com",
+//  		Decrypters: crypto.Decrypters{crypto.XChaCha: &xchacha.Crypter{Token: token}},
+//  		Timeout:    10 * time.Second,
+//  		Retries:    3,
+//  	}
+//
+//  	s, err := c.Get(ctx, "app", "prod", id)
+//
+//  The zero value of each field leaves the behaviour off, a Client being safe
+//  for concurrent use as long as its fields are not modified.
+type Client struct {
+	//  Addr is the address of the secrets service, https being assumed if no
+	//  scheme is given
+	Addr string
+
+	//  TLS configures connections to the service, e.g. trusting a private CA.
+	//  It is ignored if HTTPClient is set.
+	TLS *tls.Config
+
+	//  HTTPClient makes the requests if set, e.g. to share connections across
+	//  clients, otherwise http.DefaultClient (or one configured with TLS) does
+	HTTPClient *http.Client
+
+	//  Token is sent as a bearer token to authorize requests, e.g. the admin
+	//  token for backups or by a gateway in front of the service
+	Token string
+
+	//  Timeout limits each attempt at a request
+	Timeout time.Duration
+
+	//  Retries is the number of times a request is retried on a network error
+	//  or a 502, 503 or 504 response, waiting Backoff (or DefaultBackoff)
+	//  before the first retry and doubling the wait each time. Creates, which
+	//  are not idempotent, are never retried.
+	Retries int
+	Backoff time.Duration
+
+	//  User is recorded in the history as the user making changes
+	User string
+
+	//  Crypter encrypts the content of secrets created or updated, content
+	//  being sent as is if nil
+	Crypter crypto.Crypter
+
+	//  Decrypters decrypt the content of secrets retrieved by the algorithm
+	//  they are encrypted with, Crypter being used if nil. Content is returned
+	//  encrypted if neither are set.
+	Decrypters crypto.Decrypters
+
+	//  Signer signs secrets created or updated
+	Signer sign.Signer
+
+	//  Trusted verifies secrets retrieved are signed by one of its keys, before
+	//  they are decrypted
+	Trusted *sign.Trusted
+}
+
+//  url returns the URL of the path on the secrets service
+func (c *Client) url(path string, params url.Values) string {
+	scheme, addr := "https", c.Addr
+	if m := schemeExp.FindStringSubmatch(addr); m != nil {
+		scheme, addr = m[schemeExp.SubexpIndex("scheme")], schemeExp.ReplaceAllString(addr, "")
+	}
+
+	return (&url.URL{
+		Scheme:   scheme,
+		Host:     addr,
+		Path:     path,
+		RawQuery: params.Encode(),
+	}).String()
+}
+
+func (c *Client) httpClient() *http.Client {
+	switch {
+	case c.HTTPClient != nil:
+		return c.HTTPClient
+	case c.TLS != nil:
+		return &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: c.TLS}}
+	default:
+		return http.DefaultClient
+	}
+}
+
+//  do makes the request, retrying if it may be, returning the response body
+//  of a successful response
+func (c *Client) do(ctx context.Context, method, path string, params url.Values, body []byte) ([]byte, error) {
+	wait := c.Backoff
+	if wait <= 0 {
+		wait = DefaultBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+
+		res, retry, err := c.attempt(ctx, method, path, params, r)
+		if err == nil || !retry || method == http.MethodPost || attempt >= c.Retries {
+			return res, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+//  attempt makes the request once, reporting if a failure may be retried
+func (c *Client) attempt(ctx context.Context, method, path string, params url.Values, body io.Reader) ([]byte, bool, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	res, err := c.send(ctx, method, path, params, body)
+	if err != nil {
+		return nil, ctx.Err() == nil || ctx.Err() == context.DeadlineExceeded, err
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, true, errors.Wrap(err, "unable to read secrets service response")
+	}
+
+	switch code := res.StatusCode; {
+	case code >= 200 && code <= 299:
+		return b, false, nil
+	case code == http.StatusNotFound && method == http.MethodGet:
+		return nil, false, ErrNotFound
+	default:
+		retry := code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+		return nil, retry, &StatusError{Code: code, Message: string(b)}
+	}
+}
+
+//  send sends the request, the caller closing the response body
+func (c *Client) send(ctx context.Context, method, path string, params url.Values, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.url(path, params), body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create %s http request", method)
+	}
+	req = req.WithContext(ctx)
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if len(c.Token) > 0 {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.Token))
+	}
+
+	res, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to call secrets service")
+	}
+	return res, nil
+}
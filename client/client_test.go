@@ -0,0 +1,209 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/xchacha"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+	"github.com/manulife-gwam/peppermint-sparkles/service"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+func init() {
+	log.SetLevel(log.ErrorLevel)
+}
+
+func TestClient(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	srv := httptest.NewServer(service.Handle(http.NewServeMux(), &service.Handler{Backend: ds}))
+	defer srv.Close()
+	addr := srv.URL
+
+	tok, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	c := &Client{
+		Addr:    addr,
+		User:    "tester",
+		Crypter: &xchacha.Crypter{Token: []byte(tok), Cost: 10},
+	}
+
+	created, err := c.Create(ctx, &models.Secret{App: "dummy", Env: "test", Content: "notSuperS3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(created.Id) < 1 {
+		t.Fatal("expected an ID to be generated")
+	}
+
+	if want, got := crypto.XChaCha, created.Algorithm; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	if created.Content == "notSuperS3cret" {
+		t.Error("expected the content to be sent encrypted")
+	}
+
+	s, err := c.Get(ctx, "dummy", "test", created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "notSuperS3cret", s.Content; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	//	content is left encrypted without a crypter
+	raw, err := (&Client{Addr: addr}).Get(ctx, "dummy", "test", created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := created.Content, raw.Content; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	s.Content = "stillNotS3cret"
+	if _, err := c.Update(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Rotate(ctx, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Delete(ctx, "dummy", "test", created.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Get(ctx, "dummy", "test", created.Id); err != ErrNotFound {
+		t.Errorf("\nwant %v\ngot  %v\n", ErrNotFound, err)
+	}
+
+	history, err := c.History(ctx, "dummy", "test", created.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ action, content string }{
+		{action: models.CreateAction, content: "notSuperS3cret"},
+		{action: models.UpdateAction, content: "stillNotS3cret"},
+		{action: models.RotateAction, content: "stillNotS3cret"},
+		{action: models.DeleteAction, content: "stillNotS3cret"},
+	}
+
+	if len(history) != len(want) {
+		t.Fatalf("want %d historical entries, got %d", len(want), len(history))
+	}
+
+	for i, h := range history {
+		if want, got := want[i].action, h.Action; want != got {
+			t.Errorf("\nwant %s\ngot  %s\n", want, got)
+		}
+
+		if err := c.Decrypt(h.Secret); err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := want[i].content, h.Content; want != got {
+			t.Errorf("\nwant %s\ngot  %s\n", want, got)
+		}
+	}
+
+	if _, err := c.History(ctx, "other", "test", created.Id); err != ErrNotFound {
+		t.Errorf("\nwant %v\ngot  %v\n", ErrNotFound, err)
+	}
+
+	if _, err := c.Get(ctx, "dummy", "", created.Id); err == nil {
+		t.Error("want an error without an environment")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, got := "Bearer s3cret", r.Header.Get("Authorization"); want != got {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		//	every other call is unavailable
+		if atomic.AddInt32(&calls, 1)%2 == 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"%s","app_name":"dummy","env":"test","content":"notSuperS3cret"}`, uuid.New().String())
+	}))
+	defer srv.Close()
+	addr := srv.URL
+
+	ctx := context.Background()
+	c := &Client{Addr: addr, Token: "s3cret", Retries: 1, Backoff: time.Millisecond}
+
+	if _, err := c.Get(ctx, "dummy", "test", uuid.New().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := int32(2), atomic.LoadInt32(&calls); want != got {
+		t.Errorf("want %d calls, got %d", want, got)
+	}
+
+	//	creates are never retried
+	_, err := c.Create(ctx, &models.Secret{App: "dummy", Env: "test", Content: "notSuperS3cret"})
+	if e, ok := errors.Cause(err).(*StatusError); !ok || e.Code != http.StatusServiceUnavailable {
+		t.Errorf("want a %d status error, got %v", http.StatusServiceUnavailable, err)
+	}
+
+	if want, got := int32(3), atomic.LoadInt32(&calls); want != got {
+		t.Errorf("want %d calls, got %d", want, got)
+	}
+
+	if _, err := (&Client{Addr: addr, Token: "wrong", Retries: 3}).Get(ctx, "dummy", "test", uuid.New().String()); err == nil {
+		t.Error("want an error with the wrong token")
+	}
+
+	if want, got := int32(3), atomic.LoadInt32(&calls); want != got {
+		t.Errorf("want %d calls, got %d", want, got)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer srv.Close()
+	addr := srv.URL
+
+	c := &Client{Addr: addr, Timeout: 10 * time.Millisecond}
+	if _, err := c.Get(context.Background(), "dummy", "test", uuid.New().String()); err == nil {
+		t.Error("want the request to time out")
+	}
+}
@@ -0,0 +1,345 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+	"github.com/manulife-gwam/peppermint-sparkles/service"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+func validate(app, env, id string) error {
+	if len(id) < 1 {
+		return errors.New("a valid secret ID must be provided")
+	}
+
+	if len(app) < 1 {
+		return errors.New("a valid secret app name must be provided")
+	}
+
+	if len(env) < 1 {
+		return errors.New("a valid secret environment must be provided")
+	}
+
+	return nil
+}
+
+func secretPath(id string) string {
+	return fmt.Sprintf("%s/%s", service.PathSecrets, id)
+}
+
+//  Get retrieves the secret, verifying and decrypting it (see Decrypt)
+func (c *Client) Get(ctx context.Context, app, env, id string) (*models.Secret, error) {
+	if err := validate(app, env, id); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		service.AppParam: []string{app},
+		service.EnvParam: []string{env},
+	}
+
+	raw, err := c.do(ctx, http.MethodGet, secretPath(id), params, nil)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "unable to retrieve secret")
+	}
+
+	if len(raw) < 1 {
+		return nil, ErrNotFound
+	}
+
+	//  test / validate if stored content meets the secrets model and also
+	//  to allow for decryption
+	s := &models.Secret{}
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, errors.Wrap(err, "unable to convert string to secrets")
+	}
+
+	if err := c.Decrypt(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+//  Decrypt verifies the secret is signed by a trusted key if Trusted is set,
+//  then decrypts the content in place if there are decrypters. Verifying first
+//  ensures altered content, or content moved from another secret, is never
+//  used.
+func (c *Client) Decrypt(s *models.Secret) error {
+	if c.Trusted != nil {
+		if err := c.Trusted.Verify(s.Signed(), s.Signature); err != nil {
+			return errors.Wrap(err, "unable to verify secret")
+		}
+	}
+
+	d := c.decrypters()
+	if d == nil {
+		return nil
+	}
+
+	res, err := d.Decrypt(s.Algorithm, []byte(s.Content))
+	if err != nil {
+		return errors.Wrap(err, "unable to decrypt secret")
+	}
+	s.Content = string(res)
+	return nil
+}
+
+//  DecryptTo verifies the secret as Decrypt does, writing the content to w as
+//  it is decrypted. The content is only authenticated as it is decrypted, so
+//  what is written must be discarded on error.
+func (c *Client) DecryptTo(w io.Writer, s *models.Secret) error {
+	if c.Trusted != nil {
+		if err := c.Trusted.Verify(s.Signed(), s.Signature); err != nil {
+			return errors.Wrap(err, "unable to verify secret")
+		}
+	}
+
+	d := c.decrypters()
+	if d == nil {
+		return errors.New("no decrypters to decrypt the secret with")
+	}
+
+	if err := d.DecryptStream(s.Algorithm, w, strings.NewReader(s.Content)); err != nil {
+		return errors.Wrap(err, "unable to decrypt secret")
+	}
+	return nil
+}
+
+func (c *Client) decrypters() crypto.Decrypters {
+	switch {
+	case c.Decrypters != nil:
+		return c.Decrypters
+	case c.Crypter != nil:
+		return crypto.Decrypters{crypto.Algorithm(c.Crypter): c.Crypter}
+	default:
+		return nil
+	}
+}
+
+//  Create creates the secret, encrypting and signing the content first, an ID
+//  being generated if not set. The secret is returned as stored.
+func (c *Client) Create(ctx context.Context, s *models.Secret) (*models.Secret, error) {
+	return c.CreateFrom(ctx, s, strings.NewReader(s.Content))
+}
+
+//  CreateFrom creates the secret as Create does, with the content read from r.
+//  Encrypted content is sent to the service as it is encrypted, unless it is
+//  signed, since the signature is of the content as a whole. The service reads
+//  in the secret as a whole, so the content is not streamed end to end.
+func (c *Client) CreateFrom(ctx context.Context, s *models.Secret, r io.Reader) (*models.Secret, error) {
+	sec := *s
+
+	// ensure the secret has an ID set
+	if len(sec.Id) < 1 {
+		sec.Id = uuid.New().String()
+	}
+
+	params := url.Values{
+		service.UserParam: []string{c.User},
+		service.AppParam:  []string{sec.App},
+		service.EnvParam:  []string{sec.Env},
+		service.IdParam:   []string{sec.Id},
+	}
+
+	var (
+		res []byte
+		err error
+	)
+
+	if c.Crypter != nil && c.Signer == nil {
+		sec.Algorithm = crypto.Algorithm(c.Crypter)
+
+		body, berr := secretBody(&sec, func(w io.Writer) error {
+			return c.Crypter.EncryptStream(w, r)
+		})
+		if berr != nil {
+			return nil, berr
+		}
+
+		res, _, err = c.attempt(ctx, http.MethodPost, service.PathSecrets, params, body)
+	} else {
+		if err := c.seal(&sec, r); err != nil {
+			return nil, err
+		}
+
+		res, err = c.do(ctx, http.MethodPost, service.PathSecrets, params, []byte(sec.MustString()))
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to send secret")
+	}
+
+	return parse(res)
+}
+
+//  Update replaces the content of the secret, encrypting and signing it first.
+//  The secret is returned as stored.
+func (c *Client) Update(ctx context.Context, s *models.Secret) (*models.Secret, error) {
+	return c.update(ctx, s, models.UpdateAction)
+}
+
+//  Rotate updates the secret as Update does, the history recording the change
+//  as a rotation, i.e. the same content re-encrypted with new keys
+func (c *Client) Rotate(ctx context.Context, s *models.Secret) (*models.Secret, error) {
+	return c.update(ctx, s, models.RotateAction)
+}
+
+func (c *Client) update(ctx context.Context, s *models.Secret, action string) (*models.Secret, error) {
+	if err := validate(s.App, s.Env, s.Id); err != nil {
+		return nil, err
+	}
+
+	sec := *s
+	if err := c.seal(&sec, strings.NewReader(sec.Content)); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		service.UserParam:   []string{c.User},
+		service.ActionParam: []string{action},
+	}
+
+	res, err := c.do(ctx, http.MethodPut, secretPath(sec.Id), params, []byte(sec.MustString()))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to update secret")
+	}
+
+	return parse(res)
+}
+
+//  seal sets the content of the secret to that read from r, encrypted with the
+//  crypter, if any, then signs it as it is to be stored, tying the content to
+//  the secret's ID, app, and environment
+func (c *Client) seal(s *models.Secret, r io.Reader) error {
+	buf := new(bytes.Buffer)
+	if c.Crypter != nil {
+		// record how the content is encrypted so the right crypter is used to
+		// decrypt
+		s.Algorithm = crypto.Algorithm(c.Crypter)
+
+		if err := c.Crypter.EncryptStream(buf, r); err != nil {
+			return errors.Wrap(err, "unable to encrypt secret content")
+		}
+	} else if _, err := io.Copy(buf, r); err != nil {
+		return errors.Wrap(err, "unable to read secret content")
+	}
+	s.Content = buf.String()
+
+	if c.Signer != nil {
+		// the algorithm is signed, so is recorded as the service detects it
+		// for content encrypted elsewhere
+		if len(s.Algorithm) < 1 {
+			s.Algorithm = crypto.Detect([]byte(s.Content))
+		}
+
+		sig, err := c.Signer.Sign(s.Signed())
+		if err != nil {
+			return errors.Wrap(err, "unable to sign secret")
+		}
+		s.Signature = sig
+	}
+	return nil
+}
+
+//  Delete deletes the secret, its history being kept
+func (c *Client) Delete(ctx context.Context, app, env, id string) error {
+	if err := validate(app, env, id); err != nil {
+		return err
+	}
+
+	params := url.Values{
+		service.UserParam: []string{c.User},
+		service.AppParam:  []string{app},
+		service.EnvParam:  []string{env},
+	}
+
+	if _, err := c.do(ctx, http.MethodDelete, secretPath(id), params, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+//  History retrieves the historical entries of the secret, oldest first, which
+//  remain available once the secret is deleted. The content is left as stored
+//  since it may be encrypted with keys since rotated; Decrypt decrypts an
+//  entry's secret.
+func (c *Client) History(ctx context.Context, app, env, id string) ([]*models.Historical, error) {
+	if err := validate(app, env, id); err != nil {
+		return nil, err
+	}
+
+	params := url.Values{
+		service.AppParam: []string{app},
+		service.EnvParam: []string{env},
+	}
+
+	raw, err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/%s", secretPath(id), service.PathHistory), params, nil)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "unable to retrieve secret history")
+	}
+
+	entries := make([]*models.Historical, 0)
+	if err := json.Unmarshal(raw, &entries); err != nil {
+		return nil, errors.Wrap(err, "unable to parse secret history")
+	}
+	return entries, nil
+}
+
+func parse(raw []byte) (*models.Secret, error) {
+	s, err := models.ParseSecret(string(raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse in service response")
+	}
+	return s, nil
+}
+
+//  secretBody returns the JSON encoded secret, the content being written by
+//  content as the body is read rather than held in memory. The content must
+//  not need escaping, which is the case for encrypted content (base64 or an
+//  envelope).
+func secretBody(s *models.Secret, content func(w io.Writer) error) (io.Reader, error) {
+	s.Content = ""
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode secret")
+	}
+
+	field := []byte(`"content":"`)
+	i := bytes.Index(raw, field)
+	if i < 0 {
+		return nil, errors.New("unable to encode secret")
+	}
+	i += len(field)
+
+	r, w := io.Pipe()
+	go func() {
+		_, err := w.Write(raw[:i])
+		if err == nil {
+			err = content(w)
+		}
+
+		if err == nil {
+			_, err = w.Write(raw[i:])
+		}
+		w.CloseWithError(err)
+	}()
+
+	return r, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	stdctx "context"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	"github.com/manulife-gwam/peppermint-sparkles/backend/encrypted"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	HistoryVersionsFlag = cli.IntFlag{
+		Name:    "history-versions",
+		Usage:   "max number of historical entries kept per secret (0 for no limit)",
+		EnvVars: []string{"PSPARKLES_HISTORY_VERSIONS"},
+	}
+
+	HistoryMaxAgeFlag = cli.DurationFlag{
+		Name:    "history-max-age",
+		Usage:   "max age of historical entries kept per secret, the latest is always kept (0 for no limit)",
+		EnvVars: []string{"PSPARKLES_HISTORY_MAX_AGE"},
+	}
+
+	retentionFlags = []cli.Flag{
+		&HistoryVersionsFlag,
+		&HistoryMaxAgeFlag,
+	}
+
+	MigrateKeys = &cli.Command{
+		Name:  "migrate-keys",
+		Flags: datastoreFlags,
+		Usage: "re-keys records stored by raw ID to the app / env namespaced key",
+		Action: func(context *cli.Context) error {
+			ds, err := openDatastore(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			defer ds.Close()
+
+			n, err := models.RekeyRecords(stdctx.Background(), ds)
+			if err != nil {
+				return cli.Exit(errors.Wrapf(err, "unable to migrate keys after %d entries", n), 1)
+			}
+
+			log.Infof("migrated %d records / historical entries", n)
+			return nil
+		},
+	}
+
+	MigrateSchema = &cli.Command{
+		Name:  "migrate-schema",
+		Flags: datastoreFlags,
+		Usage: "rewrites records and history stored prior to the current schema version or with another codec (see --record-codec)",
+		Action: func(context *cli.Context) error {
+			ds, err := openDatastore(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			defer ds.Close()
+
+			n, err := models.MigrateSchema(stdctx.Background(), ds)
+			if err != nil {
+				return cli.Exit(errors.Wrapf(err, "unable to migrate schema after %d entries", n), 1)
+			}
+
+			log.Infof("rewrote %d records / historical entries at schema version %d with the %s codec", n, models.SchemaVersion, context.String(RecordCodecFlag.Name))
+			return nil
+		},
+	}
+
+	RotateKeys = &cli.Command{
+		Name:  "rotate-keys",
+		Flags: datastoreFlags,
+		Usage: "re-seals stored values with the active master key (see --datastore-key-file)",
+		Action: func(context *cli.Context) error {
+			ds, err := openDatastore(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			defer ds.Close()
+
+			eds, ok := ds.(*encrypted.Datastore)
+			if !ok {
+				return cli.Exit(errors.New("a master key file must be provided"), 1)
+			}
+
+			n, err := eds.Rotate(stdctx.Background())
+			if err != nil {
+				return cli.Exit(errors.Wrapf(err, "unable to rotate keys after %d values", n), 1)
+			}
+
+			log.Infof("re-sealed %d values", n)
+			return nil
+		},
+	}
+
+	Compact = &cli.Command{
+		Name:  "compact",
+		Flags: append(retentionFlags, datastoreFlags...),
+		Usage: "removes the history not retained by the policy and compacts the datastore file (file datastore only)",
+		Action: func(context *cli.Context) error {
+			ds, err := openDatastore(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			n, err := retention(context).Compact(stdctx.Background(), ds)
+			ds.Close()
+
+			if err != nil {
+				return cli.Exit(errors.Wrapf(err, "unable to compact history after %d entries", n), 1)
+			}
+			log.Infof("removed %d historical entries", n)
+
+			if context.String(DatastoreTypeFlag.Name) != backend.File {
+				return nil
+			}
+
+			name := context.String(DatastoreFileFlag.Name)
+			before, after, err := fileds.Compact(name)
+			if err != nil {
+				return cli.Exit(errors.Wrapf(err, "unable to compact datastore file %s", name), 1)
+			}
+
+			log.Infof("compacted %s from %d to %d bytes", name, before, after)
+			return nil
+		},
+	}
+
+	Admin = &cli.Command{
+		Name:  "admin",
+		Usage: "datastore administration tasks (requires direct datastore access)",
+		Subcommands: []*cli.Command{
+			MigrateKeys,
+			MigrateSchema,
+			RotateKeys,
+			Compact,
+		},
+	}
+)
+
+//	retention returns the history retention policy specified by the flags
+func retention(context *cli.Context) *models.Retention {
+	return &models.Retention{
+		Versions: context.Int(HistoryVersionsFlag.Name),
+		MaxAge:   context.Duration(HistoryMaxAgeFlag.Name),
+	}
+}
+
+//	compactHistory enforces the retention policy at each interval
+func compactHistory(ds backend.Datastore, policy *models.Retention, interval time.Duration) {
+	for range time.Tick(interval) {
+		n, err := policy.Compact(stdctx.Background(), ds)
+		if err != nil {
+			log.Error(err, "unable to compact history")
+			continue
+		}
+
+		if n > 0 {
+			log.Infof("removed %d historical entries", n)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	stdctx "context"
+	"io"
+	"os"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend/backup"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	BackupFromFlag = cli.StringFlag{
+		Name:  "from",
+		Usage: "datastore to backup directly rather than via the secrets service, e.g. redis:localhost:6379",
+	}
+
+	BackupOutputFlag = cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "file to write the backup to",
+	}
+
+	BackupInputFlag = cli.StringFlag{
+		Name:    "input",
+		Aliases: []string{"i"},
+		Usage:   "backup file to restore",
+	}
+
+	BackupPassphraseFlag = cli.StringFlag{
+		Name:    "passphrase",
+		Usage:   "passphrase to encrypt / decrypt the backup with",
+		EnvVars: []string{"PSPARKLES_BACKUP_PASSPHRASE"},
+	}
+
+	RestoreToFlag = cli.StringFlag{
+		Name:  "to",
+		Usage: "datastore to restore to, e.g. file:/var/lib/peppermint-sparkles/psparkles.db",
+	}
+
+	Backup = &cli.Command{
+		Name: "backup",
+		Flags: append([]cli.Flag{
+			&AddrFlag,
+			&AdminTokenFlag,
+			&InsecureFlag,
+			&BackupFromFlag,
+			&BackupOutputFlag,
+			&BackupPassphraseFlag,
+		}, redisFlags...),
+		Usage: "writes a snapshot of the datastore from the secrets service (or --from) to a backup file",
+		Action: func(context *cli.Context) error {
+			out := context.String(BackupOutputFlag.Name)
+			if len(out) < 1 {
+				return cli.Exit(errors.New("an output file must be provided"), 1)
+			}
+
+			f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err != nil {
+				return cli.Exit(errors.Wrap(err, "unable to create backup file"), 1)
+			}
+
+			passphrase := []byte(context.String(BackupPassphraseFlag.Name))
+
+			var sum *backup.Summary
+			if from := context.String(BackupFromFlag.Name); len(from) > 0 {
+				sum, err = backupFrom(context, from, f, passphrase)
+			} else {
+				sum, err = download(context, f, passphrase)
+			}
+
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+
+			//	never leave a partial backup behind
+			if err != nil {
+				os.Remove(out)
+				return cli.Exit(err, 1)
+			}
+
+			log.Infof("backed up %d records and %d historical entries to %s", sum.Records, sum.History, out)
+			return nil
+		},
+	}
+
+	RestoreBackup = &cli.Command{
+		Name: "restore-backup",
+		Flags: append([]cli.Flag{
+			&BackupInputFlag,
+			&RestoreToFlag,
+			&BackupPassphraseFlag,
+			&MigrateOverwriteFlag,
+		}, redisFlags...),
+		Usage: "loads a backup file into a datastore",
+		Action: func(context *cli.Context) error {
+			in, to := context.String(BackupInputFlag.Name), context.String(RestoreToFlag.Name)
+			if len(in) < 1 || len(to) < 1 {
+				return cli.Exit(errors.New("both a backup file and a datastore to restore to must be provided"), 1)
+			}
+
+			f, err := os.Open(in)
+			if err != nil {
+				return cli.Exit(errors.Wrap(err, "unable to open backup file"), 1)
+			}
+			defer f.Close()
+
+			ds, err := openSpec(context, to)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			defer ds.Close()
+
+			passphrase := []byte(context.String(BackupPassphraseFlag.Name))
+
+			r, err := backup.Restore(stdctx.Background(), f, passphrase, ds, context.Bool(MigrateOverwriteFlag.Name))
+			if r != nil {
+				log.Infof("restored %d records and %d historical entries, skipped %d already present", r.Records, r.History, r.Skipped)
+				for _, k := range r.Conflicts {
+					log.Warnf("record for key %s differs in the datastore and was not overwritten", k)
+				}
+			}
+
+			if err != nil {
+				return cli.Exit(errors.Wrap(err, "unable to restore backup"), 1)
+			}
+
+			return nil
+		},
+	}
+)
+
+//	backupFrom writes a backup of the datastore directly
+func backupFrom(context *cli.Context, spec string, w io.Writer, passphrase []byte) (*backup.Summary, error) {
+	ds, err := openSpec(context, spec)
+	if err != nil {
+		return nil, err
+	}
+	defer ds.Close()
+
+	return backup.Write(stdctx.Background(), w, ds, passphrase)
+}
+
+//	download streams the backup from the secrets service, verifying it is
+//	complete and encrypting it with the passphrase if provided
+func download(context *cli.Context, w io.Writer, passphrase []byte) (*backup.Summary, error) {
+	addr, token := context.String(AddrFlag.Name), context.String(AdminTokenFlag.Name)
+	if len(addr) < 1 || len(token) < 1 {
+		return nil, errors.New("a secrets service address and admin token must be provided")
+	}
+
+	cl := newClient(addr, context.Bool(InsecureFlag.Name))
+	cl.Token = token
+
+	body, err := cl.Backup(stdctx.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	sum, err := backup.Transcode(body, nil, w, passphrase)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to download backup")
+	}
+
+	return sum, nil
+}
@@ -2,6 +2,11 @@ package main
 
 import (
 	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	"github.com/manulife-gwam/peppermint-sparkles/service"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -24,3 +29,8 @@ func freeport() int {
 
 	return listener.Addr().(*net.TCPAddr).Port
 }
+
+//	serve starts a test server for the datastore, which the caller closes
+func serve(ds backend.Datastore) *httptest.Server {
+	return httptest.NewServer(service.Handle(http.NewServeMux(), &service.Handler{Backend: ds}))
+}
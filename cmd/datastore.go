@@ -0,0 +1,403 @@
+package main
+
+import (
+	stdctx "context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	"github.com/manulife-gwam/peppermint-sparkles/backend/cache"
+	"github.com/manulife-gwam/peppermint-sparkles/backend/encrypted"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	redisds "github.com/manulife-gwam/peppermint-sparkles/backend/redis"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+	"github.com/manulife-gwam/peppermint-sparkles/internal/pcf/vcap"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+
+	log "github.com/sirupsen/logrus"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+//	datastore flags
+var (
+	DatastoreTypeFlag = cli.StringFlag{
+		Name:    "datastore-type",
+		Aliases: []string{"dst"},
+		Value:   backend.File,
+		Usage:   "backend type to be used for storage",
+		EnvVars: []string{"PSPARKLES_DS_TYPE"},
+	}
+
+	DatastoreFileFlag = cli.StringFlag{
+		Name:    "datastore-file",
+		Aliases: []string{"dsf"},
+		Value:   "/var/lib/peppermint-sparkles/psparkles.db",
+		Usage:   "name / location of file for storing secrets",
+		EnvVars: []string{"PSPARKLES_DS_FILE"},
+	}
+
+	DatastoreAddrFlag = cli.StringFlag{
+		Name:    "datastore-addr",
+		Aliases: []string{"dsa"},
+		Value:   "localhost:6379",
+		Usage:   "address for the remote datastore (comma separated for redis sentinel / cluster)",
+		EnvVars: []string{"PSPARKLES_DS_ADDR"},
+	}
+
+	DatastoreKeyFileFlag = cli.StringFlag{
+		Name:    "datastore-key-file",
+		Aliases: []string{"dskf"},
+		Usage:   "master key file for encrypting the stored values at rest (reloaded on SIGHUP)",
+		EnvVars: []string{"PSPARKLES_DS_KEY_FILE"},
+	}
+
+	DatastoreAllowUnsealedFlag = cli.BoolFlag{
+		Name:    "datastore-allow-unsealed",
+		Usage:   "return stored values not sealed with the master keys (written prior to enabling encryption at rest) rather than rejecting them, until re-sealed by admin rotate-keys",
+		EnvVars: []string{"PSPARKLES_DS_ALLOW_UNSEALED"},
+	}
+
+	RecordCodecFlag = cli.StringFlag{
+		Name:    "record-codec",
+		Value:   "json",
+		Usage:   "encoding of stored records, json or binary (values written by either are always readable)",
+		EnvVars: []string{"PSPARKLES_RECORD_CODEC"},
+	}
+
+	RedisModeFlag = cli.StringFlag{
+		Name:    "redis-mode",
+		Value:   redisds.SingleMode,
+		Usage:   "redis connection mode (single, sentinel, or cluster)",
+		EnvVars: []string{"PSPARKLES_REDIS_MODE"},
+	}
+
+	RedisMasterFlag = cli.StringFlag{
+		Name:    "redis-master",
+		Usage:   "name of the sentinel monitored redis master",
+		EnvVars: []string{"PSPARKLES_REDIS_MASTER"},
+	}
+
+	RedisUsernameFlag = cli.StringFlag{
+		Name:    "redis-username",
+		Usage:   "username for redis ACL auth",
+		EnvVars: []string{"PSPARKLES_REDIS_USERNAME"},
+	}
+
+	RedisPasswordFlag = cli.StringFlag{
+		Name:    "redis-password",
+		Usage:   "password for redis auth",
+		EnvVars: []string{"PSPARKLES_REDIS_PASSWORD"},
+	}
+
+	RedisDBFlag = cli.IntFlag{
+		Name:    "redis-db",
+		Usage:   "redis DB to select (ignored for cluster mode)",
+		EnvVars: []string{"PSPARKLES_REDIS_DB"},
+	}
+
+	RedisPrefixFlag = cli.StringFlag{
+		Name:    "redis-prefix",
+		Value:   redisds.DefaultPrefix,
+		Usage:   "prefix to namespace the redis keys",
+		EnvVars: []string{"PSPARKLES_REDIS_PREFIX"},
+	}
+
+	RedisTlsFlag = cli.BoolFlag{
+		Name:    "redis-tls",
+		Usage:   "use TLS for redis connections",
+		EnvVars: []string{"PSPARKLES_REDIS_TLS"},
+	}
+
+	RedisTlsCaFlag = cli.StringFlag{
+		Name:    "redis-tls-ca",
+		Usage:   "CA file for verifying the redis TLS certificate",
+		EnvVars: []string{"PSPARKLES_REDIS_TLS_CA"},
+	}
+
+	RedisTlsCertFlag = cli.StringFlag{
+		Name:    "redis-tls-cert",
+		Usage:   "client TLS certificate file for redis",
+		EnvVars: []string{"PSPARKLES_REDIS_TLS_CERT"},
+	}
+
+	RedisTlsKeyFlag = cli.StringFlag{
+		Name:    "redis-tls-key",
+		Usage:   "client TLS key file for redis",
+		EnvVars: []string{"PSPARKLES_REDIS_TLS_KEY"},
+	}
+
+	RedisTlsServerNameFlag = cli.StringFlag{
+		Name:    "redis-tls-server-name",
+		Usage:   "server name used to verify the redis TLS certificate",
+		EnvVars: []string{"PSPARKLES_REDIS_TLS_SERVER_NAME"},
+	}
+
+	RedisTlsInsecureFlag = cli.BoolFlag{
+		Name:    "redis-tls-insecure",
+		Usage:   "(TLS) skip verification of the redis TLS certificate",
+		EnvVars: []string{"PSPARKLES_REDIS_TLS_INSECURE"},
+	}
+
+	RedisImportLegacyFlag = cli.BoolFlag{
+		Name:    "redis-import-legacy",
+		Usage:   "import records / history from the legacy DB 0 / DB 1 layout on start",
+		EnvVars: []string{"PSPARKLES_REDIS_IMPORT_LEGACY"},
+	}
+
+	//	redisFlags are the redis connection options, applied to any redis
+	//	datastore opened (including those provided as a spec, see openSpec)
+	redisFlags = []cli.Flag{
+		&RedisModeFlag,
+		&RedisMasterFlag,
+		&RedisUsernameFlag,
+		&RedisPasswordFlag,
+		&RedisDBFlag,
+		&RedisPrefixFlag,
+		&RedisTlsFlag,
+		&RedisTlsCaFlag,
+		&RedisTlsCertFlag,
+		&RedisTlsKeyFlag,
+		&RedisTlsServerNameFlag,
+		&RedisTlsInsecureFlag,
+	}
+
+	//	datastoreFlags are the flags required for opening the datastore, shared by
+	//	any command requiring direct access
+	datastoreFlags = append([]cli.Flag{
+		&DatastoreAddrFlag,
+		&DatastoreFileFlag,
+		&DatastoreTypeFlag,
+		&DatastoreKeyFileFlag,
+		&DatastoreAllowUnsealedFlag,
+		&RecordCodecFlag,
+		&RedisImportLegacyFlag,
+	}, redisFlags...)
+)
+
+//	openDatastore opens the datastore of the type specified by the flags,
+//	wrapping it for encryption at rest if a master key file is provided
+func openDatastore(context *cli.Context) (backend.Datastore, error) {
+	ds, err := openBackend(context)
+	if err != nil {
+		return nil, err
+	}
+
+	eds, err := withEncryption(context, ds)
+	if err != nil {
+		ds.Close()
+		return nil, err
+	}
+
+	return eds, nil
+}
+
+//	withEncryption wraps the datastore for encryption at rest if a master key
+//	file is provided
+func withEncryption(context *cli.Context, ds backend.Datastore) (backend.Datastore, error) {
+	kf := context.String(DatastoreKeyFileFlag.Name)
+	if len(kf) < 1 {
+		return ds, nil
+	}
+
+	keys, err := kms.LoadKeyring(kf)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load datastore master keys")
+	}
+
+	log.Debugf("encrypting datastore values with master key %s", keys.Active())
+
+	eds := encrypted.Wrap(ds, keys)
+	if context.Bool(DatastoreAllowUnsealedFlag.Name) {
+		log.Warn("returning stored values not sealed with the master keys, run admin rotate-keys to re-seal them")
+		eds.AllowUnsealed(true)
+	}
+	return eds, nil
+}
+
+//	withCache wraps the datastore with a read-through cache if a cache size is
+//	provided. If the backend supports it (i.e. redis), modified records are
+//	broadcast to invalidate the caches of all instances sharing the backend.
+func withCache(context *cli.Context, ds, be backend.Datastore) backend.Datastore {
+	size := context.Int(CacheSizeFlag.Name)
+	if size < 1 {
+		return ds
+	}
+
+	cfg := &cache.Config{
+		Size: size,
+		TTL:  context.Duration(CacheTtlFlag.Name),
+	}
+
+	if inv, ok := be.(cache.Invalidator); ok {
+		cfg.Invalidator = inv
+	}
+
+	log.Debugf("caching up to %d records for %s", cfg.Size, cfg.TTL)
+	return cache.Wrap(ds, cfg)
+}
+
+//	reloadKeyring swaps in the master keys read from the key file each time a
+//	SIGHUP is received
+func reloadKeyring(name string, ds *encrypted.Datastore) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+
+	for range sig {
+		keys, err := kms.LoadKeyring(name)
+		if err != nil {
+			log.Error(err, "unable to reload datastore master keys")
+			continue
+		}
+
+		ds.SetKeyring(keys)
+		log.Infof("reloaded datastore master keys, now sealing with %s", keys.Active())
+	}
+}
+
+//	openBackend opens the datastore of the type specified by the flags, setting
+//	the codec records are written with
+func openBackend(context *cli.Context) (backend.Datastore, error) {
+	codec, err := models.CodecByName(context.String(RecordCodecFlag.Name))
+	if err != nil {
+		return nil, err
+	}
+	models.SetCodec(codec)
+
+	switch dst := context.String(DatastoreTypeFlag.Name); dst {
+	case backend.Redis:
+		cfg, err := redisConfig(context, context.String(DatastoreAddrFlag.Name))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to configure redis datastore")
+		}
+
+		//	check if running in PCF pull the vcap services if available
+		services, err := vcap.GetServices()
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to retrieve vcap services")
+		}
+
+		if services != nil {
+			if i := services.Tagged(backend.Redis); i != nil {
+				creds := i.Credentials
+				cfg.Addrs = []string{fmt.Sprintf("%s:%d", creds["host"].(string), int(creds["port"].(float64)))}
+				cfg.Password = creds["password"].(string)
+			}
+		}
+
+		ds, err := redisds.Open(cfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to open connection to datastore")
+		}
+
+		if context.Bool(RedisImportLegacyFlag.Name) {
+			n, err := ds.ImportLegacy(stdctx.Background())
+			if err != nil {
+				ds.Close()
+				return nil, errors.Wrap(err, "unable to import legacy redis layout")
+			}
+			log.Infof("imported %d legacy redis entries", n)
+		}
+
+		return ds, nil
+
+	case backend.File:
+		return openFile(context.String(DatastoreFileFlag.Name))
+
+	default:
+		return nil, errors.Errorf("%s is not a supported datastore type", dst)
+	}
+}
+
+//	openSpec opens the datastore described by the spec, which is the datastore
+//	type followed by the file name or (comma separated) redis addresses, e.g.:
+//
+//		file:/var/lib/peppermint-sparkles/psparkles.db
+//		redis:localhost:6379
+//
+//	Any redis options (e.g. mode, TLS, etc.) are taken from the redis flags.
+func openSpec(context *cli.Context, spec string) (backend.Datastore, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || len(parts[1]) < 1 {
+		return nil, errors.Errorf("%s is not a valid datastore, expected <type>:<file or address>", spec)
+	}
+
+	switch dst, target := parts[0], parts[1]; dst {
+	case backend.Redis:
+		cfg, err := redisConfig(context, target)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to configure redis datastore")
+		}
+
+		ds, err := redisds.Open(cfg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to open connection to datastore %s", spec)
+		}
+		return ds, nil
+
+	case backend.File:
+		return openFile(target)
+
+	default:
+		return nil, errors.Errorf("%s is not a supported datastore type", dst)
+	}
+}
+
+//	fileTimeout is how long to wait for the datastore file to be released by
+//	another process (e.g. a running server) before failing with
+//	fileds.ErrInUse, rather than waiting indefinitely
+const fileTimeout time.Duration = time.Second
+
+func openFile(name string) (backend.Datastore, error) {
+
+	//	FIXME ... include / handle additional bolt options
+	opts := *bolt.DefaultOptions
+	opts.Timeout = fileTimeout
+
+	ds, err := fileds.Open(name, &opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open connection to datastore")
+	}
+	return ds, nil
+}
+
+//	redisConfig builds the redis datastore config for the (comma separated)
+//	addresses from the flags
+func redisConfig(context *cli.Context, addrs string) (*redisds.Config, error) {
+	cfg := &redisds.Config{
+		Mode:       context.String(RedisModeFlag.Name),
+		MasterName: context.String(RedisMasterFlag.Name),
+		Username:   context.String(RedisUsernameFlag.Name),
+		Password:   context.String(RedisPasswordFlag.Name),
+		DB:         context.Int(RedisDBFlag.Name),
+		Prefix:     context.String(RedisPrefixFlag.Name),
+	}
+
+	for _, addr := range strings.Split(addrs, ",") {
+		if addr = strings.TrimSpace(addr); len(addr) > 0 {
+			cfg.Addrs = append(cfg.Addrs, addr)
+		}
+	}
+
+	if context.Bool(RedisTlsFlag.Name) {
+		t, err := redisds.TLSConfig(
+			context.String(RedisTlsCaFlag.Name),
+			context.String(RedisTlsCertFlag.Name),
+			context.String(RedisTlsKeyFlag.Name),
+			context.String(RedisTlsServerNameFlag.Name),
+			context.Bool(RedisTlsInsecureFlag.Name),
+		)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to configure redis TLS")
+		}
+		cfg.TLS = t
+	}
+
+	return cfg, nil
+}
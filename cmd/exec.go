@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	Exec = &cli.Command{
+		Name:      "exec",
+		Usage:     "runs a command with the keys of secrets as environment variables",
+		ArgsUsage: "-- <command> [arguments...]",
+		Flags: []cli.Flag{
+			&AddrFlag,
+			&AppNameFlag,
+			&AppEnvFlag,
+			&SecretIdsFlag,
+			&TokenFlag,
+			&SharesFlag,
+			&IdentityFlag,
+			&IdentityPassphraseFlag,
+			&KMSFlag,
+			&VerifyFlag,
+			&TrustedKeysFlag,
+			&EnvPrefixFlag,
+			&EnvMapFlag,
+			&InsecureFlag,
+		},
+		Action: func(context *cli.Context) error {
+			addr, args := context.String(AddrFlag.Name), context.Args().Slice()
+			if len(addr) < 1 || len(args) < 1 {
+				cli.ShowCommandHelpAndExit(context, context.Command.FullName(), 1)
+				return nil
+			}
+
+			ids := list(context.StringSlice(SecretIdsFlag.Name))
+			if len(ids) < 1 {
+				return cli.Exit(errors.New("at least 1 secret ID must be specified"), 1)
+			}
+
+			//	the keys are only required for secrets which are encrypted
+			d, err := readDecrypters(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			trusted, err := trustedKeys(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			mapping, err := parseMapping(list(context.StringSlice(EnvMapFlag.Name)))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			cl := newClient(addr, context.Bool(InsecureFlag.Name))
+			cl.Trusted = trusted
+
+			app, env, prefix := context.String(AppNameFlag.Name), context.String(AppEnvFlag.Name), context.String(EnvPrefixFlag.Name)
+
+			vars, used := make(map[string]string), make(map[string]bool)
+			for _, id := range ids {
+				content, err := fetch(cl, d, app, env, id)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+
+				v, err := environ(content, prefix, mapping, used)
+				if err != nil {
+					return cli.Exit(errors.Wrapf(err, "unable to read in secret %s", id), 1)
+				}
+
+				for name, value := range v {
+					vars[name] = value
+				}
+			}
+
+			for key := range mapping {
+				if !used[key] {
+					log.Warnf("mapped key %s is not in any of the secrets", key)
+				}
+			}
+
+			code, err := run(args, merge(os.Environ(), vars))
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			if code != 0 {
+				return cli.Exit("", code)
+			}
+			return nil
+		},
+	}
+)
+
+//	list splits the comma separated values, dropping empty values
+func list(values []string) []string {
+	res := make([]string, 0)
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				res = append(res, item)
+			}
+		}
+	}
+	return res
+}
+
+//	parseMapping parses the key=NAME mappings of keys to environment variable
+//	names
+func parseMapping(values []string) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, v := range values {
+		i := strings.IndexByte(v, '=')
+		if i < 1 || i == len(v)-1 {
+			return nil, errors.Errorf("mapping %q must be key=NAME", v)
+		}
+		mapping[v[:i]] = v[i+1:]
+	}
+	return mapping, nil
+}
+
+//	environ returns the environment variables for the keys of the content, a
+//	JSON object, named by the mapping, or else by the key with the prefix (see
+//	value for how values are set). The keys mapped are marked as used.
+func environ(content, prefix string, mapping map[string]string, used map[string]bool) (map[string]string, error) {
+	obj := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(content), &obj); err != nil {
+		return nil, errors.New("content must be a JSON object of keys to values, and decrypted if encrypted")
+	}
+
+	vars := make(map[string]string)
+	for key, raw := range obj {
+		name, ok := mapping[key]
+		if ok {
+			used[key] = true
+		} else {
+			name = prefix + key
+		}
+
+		if len(name) < 1 || strings.ContainsAny(name, "=\x00") {
+			return nil, errors.Errorf("key %q is not a valid environment variable name, map it to one with --%s", key, EnvMapFlag.Name)
+		}
+
+		v, err := value(raw)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read value of key %q", key)
+		}
+		vars[name] = v
+	}
+	return vars, nil
+}
+
+//	value returns the JSON value as text, strings as is, null as empty, and
+//	any other value as JSON
+func value(raw json.RawMessage) (string, error) {
+	switch {
+	case bytes.Equal(raw, []byte("null")):
+		return "", nil
+
+	case len(raw) > 0 && raw[0] == '"':
+		var str string
+		if err := json.Unmarshal(raw, &str); err != nil {
+			return "", err
+		}
+		return str, nil
+
+	default:
+		buf := new(bytes.Buffer)
+		if err := json.Compact(buf, raw); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+}
+
+//	merge returns the environment with the variables set, replacing any
+//	inherited variables of the same name
+func merge(environment []string, vars map[string]string) []string {
+	res := make([]string, 0, len(environment)+len(vars))
+	for _, kv := range environment {
+		if i := strings.IndexByte(kv, '='); i > 0 {
+			if _, ok := vars[kv[:i]]; ok {
+				continue
+			}
+		}
+		res = append(res, kv)
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		res = append(res, name+"="+vars[name])
+	}
+	return res
+}
+
+//	run runs the command with the environment, connected to the standard
+//	streams, returning its exit code. Signals received are forwarded to the
+//	command so it can shut down gracefully.
+func run(args, env []string) (int, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = env
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(sigs)
+
+	if err := cmd.Start(); err != nil {
+		return 0, errors.Wrap(err, "unable to start command")
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := cmd.Wait(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok && exit.ExitCode() >= 0 {
+			return exit.ExitCode(), nil
+		}
+		return 0, errors.Wrap(err, "unable to run command")
+	}
+	return 0, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/xchacha"
+	"github.com/manulife-gwam/peppermint-sparkles/service"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+func TestEnviron(t *testing.T) {
+	mapping, err := parseMapping(list([]string{"password=DB_PASSWORD, url=DB_URL", "port=DB_PORT"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := make(map[string]bool)
+	content := `{"user":"admin","password":"s3cret","port":5432,"tls":true,"hosts":["a", "b"],"empty":null}`
+
+	vars, err := environ(content, "APP_", mapping, used)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"APP_user":    "admin",
+		"DB_PASSWORD": "s3cret",
+		"DB_PORT":     "5432",
+		"APP_tls":     "true",
+		"APP_hosts":   `["a","b"]`,
+		"APP_empty":   "",
+	}
+
+	if len(vars) != len(want) {
+		t.Errorf("want %d variables, got %d", len(want), len(vars))
+	}
+
+	for name, value := range want {
+		if got, ok := vars[name]; !ok || got != value {
+			t.Errorf("%s\nwant %s\ngot  %s\n", name, value, got)
+		}
+	}
+
+	if !used["password"] || !used["port"] || used["url"] {
+		t.Errorf("want password and port marked as used, got %v", used)
+	}
+
+	for _, content := range []string{"notJSON", `["a"]`, `{"a=b":"c"}`} {
+		if _, err := environ(content, "", mapping, used); err == nil {
+			t.Errorf("want an error for content %s", content)
+		}
+	}
+
+	for _, m := range []string{"password", "=DB_PASSWORD", "password="} {
+		if _, err := parseMapping([]string{m}); err == nil {
+			t.Errorf("want an error for mapping %s", m)
+		}
+	}
+
+	env := merge([]string{"HOME=/root", "DB_PORT=1", "PATH=/bin"}, map[string]string{"DB_PORT": "5432", "APP_user": "admin"})
+	if want, got := fmt.Sprint([]string{"HOME=/root", "PATH=/bin", "APP_user=admin", "DB_PORT=5432"}), fmt.Sprint(env); want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+}
+
+func TestExec(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	srv := serve(ds)
+	defer srv.Close()
+
+	tok, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := srv.URL
+	c := &xchacha.Crypter{Token: []byte(tok), Cost: 10}
+
+	s, err := set(c, nil, false, "tester", `{"app_name":"dummy","env":"test","content":"{\"user\":\"admin\",\"password\":\"s3cret\"}"}`, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := &url.Values{
+		service.AppParam: []string{"dummy"},
+		service.EnvParam: []string{"test"},
+	}
+
+	res, err := get(crypto.Decrypters{crypto.XChaCha: c}, nil, false, addr, s.Id, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vars, err := environ(res.Content, "APP_", map[string]string{"password": "DB_PASSWORD"}, make(map[string]bool))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//	the exit code of the command is returned
+	code, err := run([]string{"sh", "-c", `[ "$APP_user" = admin ] && [ "$DB_PASSWORD" = s3cret ] && [ -n "$PATH" ] && exit 3`}, merge(os.Environ(), vars))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 3, code; want != got {
+		t.Errorf("want exit code %d, got %d", want, got)
+	}
+
+	if _, err := run([]string{"does-not-exist"}, nil); err == nil {
+		t.Error("want an error running a missing command")
+	}
+}
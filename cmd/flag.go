@@ -1,6 +1,12 @@
 package main
 
-import "gopkg.in/urfave/cli.v2"
+import (
+	"strings"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	"gopkg.in/urfave/cli.v2"
+)
 
 var (
 	AppNameFlag = cli.StringFlag{
@@ -21,6 +27,38 @@ var (
 		Usage:   "generated ID of secret",
 	}
 
+	SecretIdsFlag = cli.StringSliceFlag{
+		Name:    "secret-id",
+		Aliases: []string{"id", "sid"},
+		Usage:   "generated IDs of secrets, the keys of later secrets overriding those of earlier ones (comma separated or repeatable)",
+	}
+
+	EnvPrefixFlag = cli.StringFlag{
+		Name:  "prefix",
+		Usage: "prefix added to the environment variable name of each key (e.g. APP_)",
+	}
+
+	EnvMapFlag = cli.StringSliceFlag{
+		Name:  "map",
+		Usage: "environment variable name of a key, as key=NAME, used as is rather than prefixed (comma separated or repeatable)",
+	}
+
+	TemplateFlag = cli.StringFlag{
+		Name:  "template",
+		Usage: "filepath of the Go text/template to render with the values of secrets",
+	}
+
+	OutFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "filepath to write the rendered template to, replaced only once rendered in full, rather than displaying it",
+	}
+
+	ModeFlag = cli.StringFlag{
+		Name:  "mode",
+		Value: "0600",
+		Usage: "octal file permissions of the rendered output file",
+	}
+
 	SecretFlag = cli.StringFlag{
 		Name:    "secret",
 		Aliases: []string{"s"},
@@ -33,6 +71,17 @@ var (
 		Usage:   "filepath to secret",
 	}
 
+	ContentFileFlag = cli.StringFlag{
+		Name:  "content-file",
+		Usage: "filepath to the content of the secret (e.g. a keystore or certificate), streamed as it is encrypted, with the app name, environment, and ID given by flags",
+	}
+
+	OutputFlag = cli.StringFlag{
+		Name:    "output",
+		Aliases: []string{"o"},
+		Usage:   "filepath to write the decrypted content of the secret to, streamed as it is decrypted, rather than displaying it",
+	}
+
 	EncryptFlag = cli.BoolFlag{
 		Name:  "encrypt",
 		Value: true,
@@ -50,6 +99,115 @@ var (
 		Usage:   "token used to encrypt / decrypt secrets",
 	}
 
+	TokenTypeFlag = cli.StringFlag{
+		Name:    "token-type",
+		Value:   crypto.RandomToken,
+		Usage:   "type of token generated if not provided, random (256 bit) or diceware (a passphrase of --token-words words)",
+		EnvVars: []string{"PSPARKLES_TOKEN_TYPE"},
+	}
+
+	TokenWordsFlag = cli.IntFlag{
+		Name:  "token-words",
+		Value: crypto.DefaultWords,
+		Usage: "number of words in a generated diceware passphrase, each adding ~12.9 bits",
+	}
+
+	AllowWeakTokenFlag = cli.BoolFlag{
+		Name:  "allow-weak-token",
+		Usage: "allow encrypting with a provided token estimated to be weak",
+	}
+
+	KDFFlag = cli.StringFlag{
+		Name:    "kdf",
+		Usage:   "KDF deriving the key from the token, as [name][,cost=N][,t=N,m=KiB,p=N], e.g. argon2id,t=3,m=65536,p=4 (xchacha20poly1305) or cost=20 (log2 of the pgp S2K count or scrypt work factor)",
+		EnvVars: []string{"PSPARKLES_KDF"},
+	}
+
+	SplitFlag = cli.StringFlag{
+		Name:  "split",
+		Usage: "split the generated token into M shares, any N of which recombine it, as N/M (e.g. 3/5)",
+	}
+
+	SharesDirFlag = cli.StringFlag{
+		Name:  "shares-dir",
+		Usage: "directory to write each token share to a separate file rather than displaying them",
+	}
+
+	SharesFlag = cli.StringSliceFlag{
+		Name:  "shares",
+		Usage: "token shares, or files containing them, to recombine the token from (comma separated or repeatable)",
+	}
+
+	OldTokenFlag = cli.StringFlag{
+		Name:  "old-token",
+		Usage: "token the secrets are currently encrypted with",
+	}
+
+	NewTokenFlag = cli.StringFlag{
+		Name:  "new-token",
+		Usage: "token to re-encrypt secrets with, generated if not provided",
+	}
+
+	ManifestFlag = cli.StringFlag{
+		Name:  "manifest",
+		Usage: "filepath to a manifest of secrets to rotate, one per line as either <id> or <app> <env> <id>",
+	}
+
+	AlgorithmFlag = cli.StringFlag{
+		Name:    "algorithm",
+		Value:   crypto.PGP,
+		Usage:   "algorithm to encrypt secrets with (" + strings.Join(crypto.Registered(), ", ") + ")",
+		EnvVars: []string{"PSPARKLES_ALGORITHM"},
+	}
+
+	KMSFlag = cli.StringFlag{
+		Name:    "kms",
+		Usage:   "key-management provider to wrap per secret data keys with rather than a token, e.g. file:/etc/sparkles/kms.json (implies --algorithm kms)",
+		EnvVars: []string{"PSPARKLES_KMS"},
+	}
+
+	RecipientFlag = cli.StringSliceFlag{
+		Name:    "recipient",
+		Aliases: []string{"r"},
+		Usage:   "public key to encrypt secrets to rather than a token, either an OpenPGP keyring file (pgp) or an age1... key or recipients file (age) (repeatable)",
+	}
+
+	IdentityFlag = cli.StringFlag{
+		Name:    "identity",
+		Aliases: []string{"i"},
+		Usage:   "OpenPGP private keyring or age identity file to decrypt secrets encrypted to a recipient",
+		EnvVars: []string{"PSPARKLES_IDENTITY"},
+	}
+
+	IdentityPassphraseFlag = cli.StringFlag{
+		Name:    "identity-passphrase",
+		Usage:   "passphrase unlocking the identity private keys",
+		EnvVars: []string{"PSPARKLES_IDENTITY_PASSPHRASE"},
+	}
+
+	SigningKeyFlag = cli.StringFlag{
+		Name:    "signing-key",
+		Usage:   "PEM encoded ed25519 private key or OpenPGP private keyring to sign secrets with",
+		EnvVars: []string{"PSPARKLES_SIGNING_KEY"},
+	}
+
+	SigningPassphraseFlag = cli.StringFlag{
+		Name:    "signing-passphrase",
+		Usage:   "passphrase unlocking the OpenPGP signing key",
+		EnvVars: []string{"PSPARKLES_SIGNING_PASSPHRASE"},
+	}
+
+	VerifyFlag = cli.BoolFlag{
+		Name:  "verify",
+		Usage: "verify secrets are signed by a trusted key, rejecting those which are not",
+	}
+
+	TrustedKeysFlag = cli.StringSliceFlag{
+		Name:    "trusted-keys",
+		Usage:   "files of PEM encoded ed25519 public keys or OpenPGP keyrings to verify signatures against (comma separated or repeatable)",
+		EnvVars: []string{"PSPARKLES_TRUSTED_KEYS"},
+	}
+
 	AddrFlag = cli.StringFlag{
 		Name:    "addr",
 		Usage:   "secrets service address",
@@ -62,4 +220,10 @@ var (
 		Value: false,
 		Usage: "(TLS) this option explicitly allows to perform \"insecure\" SSL connections",
 	}
+
+	AdminTokenFlag = cli.StringFlag{
+		Name:    "admin-token",
+		Usage:   "bearer token for the admin endpoints (e.g. backup), which are disabled on the server if not set",
+		EnvVars: []string{"PSPARKLES_ADMIN_TOKEN"},
+	}
 )
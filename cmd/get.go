@@ -1,12 +1,16 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	stdctx "context"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+	"github.com/manulife-gwam/peppermint-sparkles/client"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/sign"
 	"github.com/manulife-gwam/peppermint-sparkles/models"
 	"github.com/manulife-gwam/peppermint-sparkles/service"
 
@@ -24,7 +28,14 @@ var (
 			&AppEnvFlag,
 			&SecretIdFlag,
 			&DecryptFlag,
+			&OutputFlag,
 			&TokenFlag,
+			&SharesFlag,
+			&IdentityFlag,
+			&IdentityPassphraseFlag,
+			&KMSFlag,
+			&VerifyFlag,
+			&TrustedKeysFlag,
 			&InsecureFlag,
 		},
 		Usage: "retrieves secrets",
@@ -35,11 +46,23 @@ var (
 				return nil
 			}
 
-			token := context.String(TokenFlag.Name)
-			decrypt := context.Bool(DecryptFlag.Name)
+			//	the crypter is picked by the algorithm the secret is encrypted with
+			var d crypto.Decrypters
+			if context.Bool(DecryptFlag.Name) {
+				dec, err := readDecrypters(context)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+
+				if dec == nil {
+					return cli.Exit(errors.New("decrypt token, shares, identity, or key-management provider must be specified in order to decrypt"), 1)
+				}
+				d = dec
+			}
 
-			if decrypt && len(token) < 1 {
-				return cli.Exit(errors.New("decrypt token must be specified in order to decrypt"), 1)
+			trusted, err := trustedKeys(context)
+			if err != nil {
+				return cli.Exit(err, 1)
 			}
 
 			params := &url.Values{
@@ -49,57 +72,126 @@ var (
 
 			insecure := context.Bool(InsecureFlag.Name)
 
-			s, err := get(decrypt, insecure, token, addr, context.String(SecretIdFlag.Name), params)
+			//	content written to the output is decrypted as it is written, rather
+			//	than once retrieved
+			output := context.String(OutputFlag.Name)
+			if len(output) > 0 && d == nil {
+				return cli.Exit(errors.New("output requires decrypting the secret"), 1)
+			}
+
+			onGet := d
+			if len(output) > 0 {
+				onGet = nil
+			}
+
+			s, err := get(onGet, trusted, insecure, addr, context.String(SecretIdFlag.Name), params)
 			if err != nil {
 				return cli.Exit(errors.Wrap(err, "unable to retrieve secert"), 1)
 			}
 
+			if len(output) > 0 {
+				if err := writeContent(d, s, output); err != nil {
+					return cli.Exit(errors.Wrap(err, "unable to write secret content"), 1)
+				}
+
+				log.Infof("content written to %s", output)
+				s.Content = ""
+			}
+
 			log.Infof("\n%s\n", s.MustString())
 			return nil
 		},
 	}
 )
 
-func get(decrypt, insecure bool, token, addr, id string, params *url.Values) (*models.Secret, error) {
-	if len(id) < 1 {
-		return nil, errors.New("a valid secret ID must be provided")
+//	readDecrypters returns the decrypters for the token, or the shares it is
+//	recombined from, the identity, and the key-management provider specified,
+//	or nil if none are
+func readDecrypters(context *cli.Context) (crypto.Decrypters, error) {
+	token, identity, kms := context.String(TokenFlag.Name), context.String(IdentityFlag.Name), context.String(KMSFlag.Name)
+
+	//	the token may be recombined from the shares it was split into
+	if shares := context.StringSlice(SharesFlag.Name); len(shares) > 0 {
+		if len(token) > 0 {
+			return nil, errors.New("only 1 of token or shares is allowed")
+		}
+
+		t, err := combineShares(shares)
+		if err != nil {
+			return nil, err
+		}
+		token = t
 	}
 
-	if len(params.Get(service.AppParam)) < 1 {
-		return nil, errors.New("a valid secret app name must be provided")
+	if len(token) < 1 && len(identity) < 1 && len(kms) < 1 {
+		return nil, nil
 	}
 
-	if len(params.Get(service.EnvParam)) < 1 {
-		return nil, errors.New("a valid secret environment must be provided")
+	d, err := crypto.NewDecrypters(&crypto.Keys{
+		Token:              []byte(token),
+		Identity:           identity,
+		IdentityPassphrase: []byte(context.String(IdentityPassphraseFlag.Name)),
+		KMS:                kms,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the token, identity, or key-management provider")
 	}
+	return d, nil
+}
 
-	raw, err := retrieve(asURL(addr, fmt.Sprintf("%s/%s", service.PathSecrets, id), params.Encode()), insecure)
+//	get retrieves the secret from the secrets service, verifying it is signed
+//	by a trusted key if provided, then decrypting the content with the crypter
+//	for the algorithm it is encrypted with if decrypters are provided
+func get(d crypto.Decrypters, trusted *sign.Trusted, insecure bool, addr, id string, params *url.Values) (*models.Secret, error) {
+	cl := newClient(addr, insecure)
+	cl.Decrypters, cl.Trusted = d, trusted
+
+	return cl.Get(stdctx.Background(), params.Get(service.AppParam), params.Get(service.EnvParam), id)
+}
+
+//	fetch retrieves the secret, returning the content decrypted if it is
+//	encrypted. Secrets stored without encryption are used as is, so decrypters
+//	are only required for those which are encrypted.
+func fetch(cl *client.Client, d crypto.Decrypters, app, env, id string) (string, error) {
+	s, err := cl.Get(stdctx.Background(), app, env, id)
 	if err != nil {
-		if err.Error() == "no valid secret" {
-			return nil, err
-		}
-		return nil, errors.Wrap(err, "unable to retrieve secret")
+		return "", errors.Wrapf(err, "unable to retrieve secret %s", id)
 	}
 
-	if len(raw) < 1 {
-		return nil, errors.New("no valid secret")
+	if len(s.Algorithm) < 1 && len(crypto.Detect([]byte(s.Content))) < 1 {
+		return s.Content, nil
 	}
 
-	//  test / validate if stored content meets the secrets model and also
-	//  to allow for decryption
-	s := &models.Secret{}
-	if err := json.Unmarshal([]byte(raw), &s); err != nil {
-		return nil, errors.Wrap(err, "unable to convert string to secrets")
+	if d == nil {
+		return "", errors.Errorf("secret %s is encrypted, so a token, shares, identity, or key-management provider must be specified", id)
 	}
 
-	if decrypt {
-		c := pgp.Crypter{Token: []byte(token)}
-		res, err := c.Decrypt([]byte(s.Content))
-		if err != nil {
-			return nil, errors.Wrap(err, "unable to decrypt secret")
-		}
-		s.Content = string(res)
+	txt, err := d.Decrypt(s.Algorithm, []byte(s.Content))
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to decrypt secret %s", id)
+	}
+	return string(txt), nil
+}
+
+//	writeContent decrypts the content of the secret as it is written to the
+//	file. The content is written to a temporary file in the same directory,
+//	only replacing the file once decrypted in full, since content is only
+//	authenticated as it is decrypted.
+func writeContent(d crypto.Decrypters, s *models.Secret, name string) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		return errors.Wrap(err, "unable to create output file")
+	}
+	defer os.Remove(f.Name())
+
+	if err := (&client.Client{Decrypters: d}).DecryptTo(f, s); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "unable to write output file")
 	}
 
-	return s, nil
+	return os.Rename(f.Name(), name)
 }
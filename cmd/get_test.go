@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -12,7 +13,10 @@ import (
 
 	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
 	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/age"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
 	"github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/xchacha"
 	"github.com/manulife-gwam/peppermint-sparkles/models"
 	"github.com/manulife-gwam/peppermint-sparkles/service"
 
@@ -64,7 +68,7 @@ func TestGet(t *testing.T) {
 		Status:    models.ActiveStatus,
 	}
 
-	if err := rec.Write(ds); err != nil {
+	if err := rec.Write(context.Background(), ds); err != nil {
 		t.Fatal(err)
 	}
 
@@ -87,7 +91,7 @@ func TestGet(t *testing.T) {
 		service.EnvParam: []string{env},
 	}
 
-	res, err := get(true, false, tok, fmt.Sprintf("http://localhost:%d", port), id, params)
+	res, err := get(crypto.Decrypters{crypto.PGP: &pgp.Crypter{Token: []byte(tok)}}, nil, false, fmt.Sprintf("http://localhost:%d", port), id, params)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -152,7 +156,7 @@ func TestGetInsecure(t *testing.T) {
 		Status:    models.ActiveStatus,
 	}
 
-	if err := rec.Write(ds); err != nil {
+	if err := rec.Write(context.Background(), ds); err != nil {
 		t.Fatal(err)
 	}
 
@@ -178,11 +182,11 @@ func TestGetInsecure(t *testing.T) {
 		service.EnvParam: []string{env},
 	}
 
-	if _, err := get(true, false, tok, fmt.Sprintf("https://localhost:%d", port), id, params); err != nil && !strings.HasSuffix(err.Error(), "x509: certificate signed by unknown authority") {
+	if _, err := get(crypto.Decrypters{crypto.PGP: &pgp.Crypter{Token: []byte(tok)}}, nil, false, fmt.Sprintf("https://localhost:%d", port), id, params); err != nil && !strings.HasSuffix(err.Error(), "x509: certificate signed by unknown authority") {
 		t.Fatal(err)
 	}
 
-	res, err := get(true, true, tok, fmt.Sprintf("https://localhost:%d", port), id, params)
+	res, err := get(crypto.Decrypters{crypto.PGP: &pgp.Crypter{Token: []byte(tok)}}, nil, true, fmt.Sprintf("https://localhost:%d", port), id, params)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -203,3 +207,83 @@ func TestGetInsecure(t *testing.T) {
 		t.Errorf("\nwant %s\ngot  %s\n", want, got)
 	}
 }
+
+func TestGetAlgorithm(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	srv := serve(ds)
+	defer srv.Close()
+
+	tok, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := srv.URL
+	app, env, content := "dummy", "test", "notSuperS3cret"
+	raw := fmt.Sprintf(`{"app_name":"%s","env":"%s","content":"%s"}`, app, env, content)
+
+	master, err := kms.NewFile("k1", map[string][]byte{"k1": make([]byte, kms.KeySize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := crypto.Decrypters{
+		crypto.PGP:     &pgp.Crypter{Token: []byte(tok)},
+		crypto.Age:     &age.Crypter{Passphrase: []byte(tok)},
+		crypto.XChaCha: &xchacha.Crypter{Token: []byte(tok)},
+		crypto.KMS:     &kms.Crypter{Provider: master, Scheme: "file"},
+	}
+
+	params := &url.Values{
+		service.AppParam: []string{app},
+		service.EnvParam: []string{env},
+	}
+
+	for _, c := range []crypto.Crypter{
+		&pgp.Crypter{Token: []byte(tok)},
+		&age.Crypter{Passphrase: []byte(tok), WorkFactor: 10},
+		&xchacha.Crypter{Token: []byte(tok), Cost: 10},
+		&kms.Crypter{Provider: master, Scheme: "file"},
+	} {
+		s, err := set(c, nil, false, "tester", raw, addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := crypto.Algorithm(c), s.Algorithm; want != got {
+			t.Errorf("\nwant %s\ngot  %s\n", want, got)
+		}
+
+		res, err := get(d, nil, false, addr, s.Id, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := content, res.Content; want != got {
+			t.Errorf("\nwant %s\ngot  %s\n", want, got)
+		}
+
+		//	only crypters for the other algorithms are available
+		other := crypto.Decrypters{}
+		for alg, c := range d {
+			if alg != s.Algorithm {
+				other[alg] = c
+			}
+		}
+
+		if _, err := get(other, nil, false, addr, s.Id, params); err == nil {
+			t.Errorf("expected %s secret to require a %s decrypter", s.Algorithm, s.Algorithm)
+		}
+	}
+}
@@ -3,6 +3,12 @@ package main
 import (
 	"os"
 
+	//	the algorithms available to encrypt / decrypt secrets with
+	_ "github.com/manulife-gwam/peppermint-sparkles/crypto/age"
+	_ "github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+	_ "github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+	_ "github.com/manulife-gwam/peppermint-sparkles/crypto/xchacha"
+
 	"gopkg.in/urfave/cli.v2"
 )
 
@@ -17,7 +23,14 @@ func main() {
 			Get,
 			Set,
 			Remove,
+			Rotate,
+			Exec,
+			Render,
 			Serve,
+			Admin,
+			Migrate,
+			Backup,
+			RestoreBackup,
 		},
 	}
 
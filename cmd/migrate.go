@@ -0,0 +1,94 @@
+package main
+
+import (
+	stdctx "context"
+	"fmt"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend/mirror"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	MigrateFromFlag = cli.StringFlag{
+		Name:  "from",
+		Usage: "datastore to copy from, e.g. file:/var/lib/peppermint-sparkles/psparkles.db",
+	}
+
+	MigrateToFlag = cli.StringFlag{
+		Name:  "to",
+		Usage: "datastore to copy to, e.g. redis:localhost:6379",
+	}
+
+	MigrateOverwriteFlag = cli.BoolFlag{
+		Name:  "overwrite",
+		Usage: "overwrite records in the destination which differ from the source",
+	}
+
+	MigrateVerifyOnlyFlag = cli.BoolFlag{
+		Name:  "verify-only",
+		Usage: "only verify the destination contains the source records and history",
+	}
+
+	Migrate = &cli.Command{
+		Name: "migrate",
+		Flags: append([]cli.Flag{
+			&MigrateFromFlag,
+			&MigrateToFlag,
+			&MigrateOverwriteFlag,
+			&MigrateVerifyOnlyFlag,
+		}, redisFlags...),
+		Usage: "copies and verifies the records and history from one datastore to another",
+		Action: func(context *cli.Context) error {
+			from, to := context.String(MigrateFromFlag.Name), context.String(MigrateToFlag.Name)
+			if len(from) < 1 || len(to) < 1 {
+				return cli.Exit(errors.New("both a datastore to copy from and to must be provided"), 1)
+			}
+
+			src, err := openSpec(context, from)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			defer src.Close()
+
+			dst, err := openSpec(context, to)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+			defer dst.Close()
+
+			ctx := stdctx.Background()
+
+			if !context.Bool(MigrateVerifyOnlyFlag.Name) {
+				r, err := mirror.Copy(ctx, src, dst, context.Bool(MigrateOverwriteFlag.Name))
+				if err != nil {
+					return cli.Exit(errors.Wrap(err, "unable to copy datastore"), 1)
+				}
+
+				log.Infof("copied %d records and %d historical entries, skipped %d already present", r.Records, r.History, r.Skipped)
+				for _, k := range r.Conflicts {
+					log.Warnf("record for key %s differs in the destination and was not overwritten", k)
+				}
+			}
+
+			mismatched, err := mirror.Verify(ctx, src, dst)
+			if err != nil {
+				return cli.Exit(errors.Wrap(err, "unable to verify datastore"), 1)
+			}
+
+			for _, k := range mismatched {
+				log.Errorf("entry for key %s is missing or differs in the destination", k)
+			}
+
+			if len(mismatched) > 0 {
+				return cli.Exit(fmt.Sprintf("verification failed for %d entries", len(mismatched)), 1)
+			}
+
+			log.Info("verified all records and history are present in the destination")
+			return nil
+		},
+	}
+)
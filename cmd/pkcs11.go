@@ -0,0 +1,9 @@
+//  +build pkcs11
+
+package main
+
+import (
+	//	the pkcs11 key-management provider, only built with the pkcs11 tag since
+	//	loading PKCS #11 modules requires cgo
+	_ "github.com/manulife-gwam/peppermint-sparkles/crypto/kms/pkcs11"
+)
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	stdctx "context"
 	"net/url"
 	"os/user"
 
@@ -50,21 +50,8 @@ var (
 )
 
 func rm(insecure bool, id, addr string, params *url.Values) error {
-	if len(id) < 1 {
-		return errors.New("a valid secret ID must be provided")
-	}
-
-	if len(params.Get(service.AppParam)) < 1 {
-		return errors.New("a valid secret app name must be provided")
-	}
-
-	if len(params.Get(service.EnvParam)) < 1 {
-		return errors.New("a valid secret environment must be provided")
-	}
-
-	if _, err := del(asURL(addr, fmt.Sprintf("%s/%s", service.PathSecrets, id), params.Encode()), insecure); err != nil {
-		return err
-	}
+	cl := newClient(addr, insecure)
+	cl.User = params.Get(service.UserParam)
 
-	return nil
+	return cl.Delete(stdctx.Background(), params.Get(service.AppParam), params.Get(service.EnvParam), id)
 }
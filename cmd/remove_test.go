@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -49,7 +50,7 @@ func TestRm(t *testing.T) {
 		Status:    models.ActiveStatus,
 	}
 
-	if err := rec.Write(ds); err != nil {
+	if err := rec.Write(context.Background(), ds); err != nil {
 		t.Fatal(err)
 	}
 
@@ -109,7 +110,7 @@ func TestRmInsecure(t *testing.T) {
 		Status:    models.ActiveStatus,
 	}
 
-	if err := rec.Write(ds); err != nil {
+	if err := rec.Write(context.Background(), ds); err != nil {
 		t.Fatal(err)
 	}
 
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/manulife-gwam/peppermint-sparkles/client"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	Render = &cli.Command{
+		Name:  "render",
+		Usage: "renders a config file template with the values of secrets",
+		Flags: []cli.Flag{
+			&AddrFlag,
+			&AppNameFlag,
+			&AppEnvFlag,
+			&TemplateFlag,
+			&OutFlag,
+			&ModeFlag,
+			&TokenFlag,
+			&SharesFlag,
+			&IdentityFlag,
+			&IdentityPassphraseFlag,
+			&KMSFlag,
+			&VerifyFlag,
+			&TrustedKeysFlag,
+			&InsecureFlag,
+		},
+		Action: func(context *cli.Context) error {
+			addr, tmpl := context.String(AddrFlag.Name), context.String(TemplateFlag.Name)
+			if len(addr) < 1 || len(tmpl) < 1 {
+				cli.ShowCommandHelpAndExit(context, context.Command.FullName(), 1)
+				return nil
+			}
+
+			mode, err := strconv.ParseUint(context.String(ModeFlag.Name), 8, 32)
+			if err != nil {
+				return cli.Exit(errors.Errorf("mode %s must be octal file permissions (e.g. 0600)", context.String(ModeFlag.Name)), 1)
+			}
+
+			//	the keys are only required for secrets which are encrypted
+			d, err := readDecrypters(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			trusted, err := trustedKeys(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			cl := newClient(addr, context.Bool(InsecureFlag.Name))
+			cl.Trusted = trusted
+
+			r := &renderer{
+				client:     cl,
+				decrypters: d,
+				app:        context.String(AppNameFlag.Name),
+				env:        context.String(AppEnvFlag.Name),
+			}
+
+			//	rendered in full before writing, so a secret which cannot be
+			//	retrieved never leaves a partially rendered file behind
+			buf := new(bytes.Buffer)
+			if err := r.render(buf, tmpl); err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			out := context.String(OutFlag.Name)
+			if len(out) < 1 {
+				_, err := io.Copy(os.Stdout, buf)
+				return err
+			}
+
+			if err := writeFile(out, buf.Bytes(), os.FileMode(mode)); err != nil {
+				return cli.Exit(err, 1)
+			}
+			return nil
+		},
+	}
+)
+
+//	renderer renders templates with the content of secrets, retrieving each
+//	secret at most once
+type renderer struct {
+	client     *client.Client
+	decrypters crypto.Decrypters
+	app, env   string
+	secrets    map[string]string
+}
+
+//	render renders the template file to the writer. Templates may call
+//
+//		secret "id"                  the content of the secret of the app and environment
+//		secret "app" "env" "id"      the content of the secret of another app or environment
+//		field "path" <content>       the value of a field of JSON content, nested fields separated by dots
+//		quote <value>                the value as a double quoted string (valid in JSON and YAML)
+//
+//	e.g. password: {{ secret "id" | field "db.password" | quote }}
+func (r *renderer) render(w io.Writer, name string) error {
+	t, err := template.New(filepath.Base(name)).
+		Funcs(template.FuncMap{
+			"secret": r.secret,
+			"field":  field,
+			"quote":  quote,
+		}).
+		Option("missingkey=error").
+		ParseFiles(name)
+	if err != nil {
+		return errors.Wrap(err, "unable to read template")
+	}
+
+	if err := t.Execute(w, nil); err != nil {
+		return errors.Wrap(err, "unable to render template")
+	}
+	return nil
+}
+
+//	secret returns the content of the secret, by ID or by app, environment,
+//	and ID, decrypted if encrypted
+func (r *renderer) secret(args ...string) (string, error) {
+	app, env := r.app, r.env
+	switch len(args) {
+	case 1:
+		if len(app) < 1 || len(env) < 1 {
+			return "", errors.Errorf("secret %s requires an app and environment, either as arguments or flags", args[0])
+		}
+	case 3:
+		app, env = args[0], args[1]
+	default:
+		return "", errors.New(`secret takes an ID, or an app, environment, and ID (e.g. secret "app" "env" "id")`)
+	}
+	id := args[len(args)-1]
+
+	key := strings.Join([]string{app, env, id}, "/")
+	if content, ok := r.secrets[key]; ok {
+		return content, nil
+	}
+
+	content, err := fetch(r.client, r.decrypters, app, env, id)
+	if err != nil {
+		return "", err
+	}
+
+	if r.secrets == nil {
+		r.secrets = make(map[string]string)
+	}
+	r.secrets[key] = content
+	return content, nil
+}
+
+//	field returns the value (see value) of the field of the JSON content at
+//	the path, nested fields and array indices separated by dots
+func field(path, content string) (string, error) {
+	raw := json.RawMessage(content)
+	for _, name := range strings.Split(path, ".") {
+		if i, err := strconv.Atoi(name); err == nil {
+			var arr []json.RawMessage
+			if err := json.Unmarshal(raw, &arr); err == nil {
+				if i < 0 || i >= len(arr) {
+					return "", errors.Errorf("field %s is out of range", path)
+				}
+				raw = arr[i]
+				continue
+			}
+		}
+
+		obj := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(raw, &obj); err != nil {
+			return "", errors.Errorf("field %s is not within a JSON object", path)
+		}
+
+		v, ok := obj[name]
+		if !ok {
+			return "", errors.Errorf("field %s does not exist", path)
+		}
+		raw = v
+	}
+
+	v, err := value(raw)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to read field %s", path)
+	}
+	return v, nil
+}
+
+//	quote returns the value as a double quoted JSON string, which is also a
+//	valid YAML string
+func quote(v string) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+//	writeFile writes the content to the file with the permissions, replacing
+//	it only once written in full
+func writeFile(name string, content []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		return errors.Wrap(err, "unable to create output file")
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(mode); err != nil {
+		f.Close()
+		return errors.Wrap(err, "unable to set output file permissions")
+	}
+
+	if _, err := f.Write(content); err != nil {
+		f.Close()
+		return errors.Wrap(err, "unable to write output file")
+	}
+
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "unable to write output file")
+	}
+
+	return os.Rename(f.Name(), name)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/xchacha"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+func TestField(t *testing.T) {
+	content := `{"db":{"user":"admin","password":"s3cr\"et","port":5432,"hosts":["a","b"]},"empty":null}`
+
+	tests := []struct{ path, want string }{
+		{path: "db.user", want: "admin"},
+		{path: "db.password", want: `s3cr"et`},
+		{path: "db.port", want: "5432"},
+		{path: "db.hosts", want: `["a","b"]`},
+		{path: "db.hosts.1", want: "b"},
+		{path: "empty", want: ""},
+	}
+
+	for _, test := range tests {
+		got, err := field(test.path, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != test.want {
+			t.Errorf("%s\nwant %s\ngot  %s\n", test.path, test.want, got)
+		}
+	}
+
+	for _, path := range []string{"missing", "db.user.name", "db.hosts.2"} {
+		if _, err := field(path, content); err == nil {
+			t.Errorf("want an error for field %s", path)
+		}
+	}
+
+	quoted, err := quote(`s3cr"et`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := `"s3cr\"et"`, quoted; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	srv := serve(ds)
+	defer srv.Close()
+
+	tok, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := srv.URL
+	c := &xchacha.Crypter{Token: []byte(tok), Cost: 10}
+
+	db, err := set(c, nil, false, "tester", `{"app_name":"dummy","env":"test","content":"{\"user\":\"admin\",\"password\":\"s3cret\"}"}`, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//	secrets stored without encryption are used as is
+	npm, err := set(nil, nil, false, "tester", `{"app_name":"shared","env":"test","content":"npmT0ken"}`, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpl := filepath.Join(dir, "application.yml.tmpl")
+	text := fmt.Sprintf(`user: {{ secret "%[1]s" | field "user" }}
+password: {{ secret "%[1]s" | field "password" | quote }}
+npm: {{ secret "shared" "test" "%[2]s" }}
+`, db.Id, npm.Id)
+
+	if err := ioutil.WriteFile(tmpl, []byte(text), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &renderer{
+		client:     newClient(addr, false),
+		decrypters: crypto.Decrypters{crypto.XChaCha: c},
+		app:        "dummy",
+		env:        "test",
+	}
+
+	buf := new(bytes.Buffer)
+	if err := r.render(buf, tmpl); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "user: admin\npassword: \"s3cret\"\nnpm: npmT0ken\n", buf.String(); want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	if want, got := 2, len(r.secrets); want != got {
+		t.Errorf("want %d secrets retrieved, got %d", want, got)
+	}
+
+	out := filepath.Join(dir, "application.yml")
+	if err := writeFile(out, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := os.FileMode(0600), info.Mode().Perm(); want != got {
+		t.Errorf("\nwant %v\ngot  %v\n", want, got)
+	}
+
+	//	encrypted secrets require keys
+	if _, err := (&renderer{client: newClient(addr, false), app: "dummy", env: "test"}).secret(db.Id); err == nil {
+		t.Error("want an error without keys for an encrypted secret")
+	}
+
+	if err := ioutil.WriteFile(tmpl, []byte(`{{ secret "dummy" "test" }}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := r.render(new(bytes.Buffer), tmpl); err == nil {
+		t.Error("want an error for the wrong number of arguments")
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	stdctx "context"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/sign"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+	"github.com/manulife-gwam/peppermint-sparkles/service"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+var (
+	Rotate = &cli.Command{
+		Name: "rotate",
+		Flags: []cli.Flag{
+			&AddrFlag,
+			&AppNameFlag,
+			&AppEnvFlag,
+			&SecretIdFlag,
+			&ManifestFlag,
+			&OldTokenFlag,
+			&NewTokenFlag,
+			&TokenTypeFlag,
+			&TokenWordsFlag,
+			&AllowWeakTokenFlag,
+			&KDFFlag,
+			&AlgorithmFlag,
+			&KMSFlag,
+			&SigningKeyFlag,
+			&SigningPassphraseFlag,
+			&VerifyFlag,
+			&TrustedKeysFlag,
+			&InsecureFlag,
+		},
+		Usage: "re-encrypts secrets with a new token",
+		Action: func(context *cli.Context) error {
+			addr := context.String(AddrFlag.Name)
+			if len(addr) < 1 {
+				cli.ShowCommandHelpAndExit(context, context.Command.FullName(), 1)
+				return nil
+			}
+
+			app, env := context.String(AppNameFlag.Name), context.String(AppEnvFlag.Name)
+
+			id, manifest := context.String(SecretIdFlag.Name), context.String(ManifestFlag.Name)
+			if len(id) > 0 && len(manifest) > 0 {
+				return cli.Exit(errors.New("only 1 of secret ID or manifest is allowed"), 1)
+			}
+
+			targets := []*target{{app: app, env: env, id: id}}
+			if len(manifest) > 0 {
+				t, err := readManifest(manifest, app, env)
+				if err != nil {
+					return cli.Exit(errors.Wrap(err, "unable to read manifest"), 1)
+				}
+				targets = t
+			}
+
+			old, next, kms := context.String(OldTokenFlag.Name), context.String(NewTokenFlag.Name), context.String(KMSFlag.Name)
+			if len(old) < 1 && len(kms) < 1 {
+				return cli.Exit(errors.New("old token or key-management provider must be specified in order to decrypt"), 1)
+			}
+
+			if len(next) > 0 && next == old {
+				return cli.Exit(errors.New("new token must differ from the old token"), 1)
+			}
+
+			d, err := crypto.NewDecrypters(&crypto.Keys{Token: []byte(old), KMS: kms})
+			if err != nil {
+				return cli.Exit(errors.Wrap(err, "unable to read the old token or key-management provider"), 1)
+			}
+
+			//	secrets are re-encrypted with the algorithm they are encrypted with
+			//	unless another is specified
+			var alg string
+			if context.IsSet(AlgorithmFlag.Name) {
+				alg = context.String(AlgorithmFlag.Name)
+			}
+
+			//	attempt to generate a token if one not provided, the same token being
+			//	used for each secret rotated
+			if len(next) < 1 {
+				t, err := generateToken(context)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+				next = t
+			} else if err := checkToken(context, next); err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			kdf, err := kdfParams(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			signer, err := signingKey(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			trusted, err := trustedKeys(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			u, err := user.Current()
+			if err != nil {
+				return cli.Exit(errors.Wrap(err, "unable to retrieve current, logged-in user"), 1)
+			}
+
+			insecure := context.Bool(InsecureFlag.Name)
+
+			//	rotate as many of the secrets as possible, reporting those which
+			//	could not be rather than stopping at the first
+			failed, tokenized := 0, false
+			for _, t := range targets {
+				params := &url.Values{
+					service.AppParam: []string{t.app},
+					service.EnvParam: []string{t.env},
+				}
+
+				s, err := rotate(d, trusted, signer, alg, &crypto.Keys{Token: []byte(next), KMS: kms, KDF: kdf}, insecure, u.Username, addr, t.id, params)
+				if err != nil {
+					log.Errorf("unable to rotate secret %s: %v", t.id, err)
+					failed++
+					continue
+				}
+
+				tokenized = tokenized || s.Algorithm != crypto.KMS
+				log.Infof("rotated secret %s with %s", s.Id, s.Algorithm)
+			}
+
+			//	ensure to display encryption token, since it may have been generated
+			if tokenized {
+				log.Infof("token: %s", next)
+			}
+
+			if failed > 0 {
+				return cli.Exit(errors.Errorf("unable to rotate %d of %d secrets", failed, len(targets)), 1)
+			}
+
+			return nil
+		},
+	}
+)
+
+//	target is a secret to be rotated
+type target struct {
+	app, env, id string
+}
+
+//	readManifest reads in the secrets to rotate, one per line as either the ID,
+//	using the app and environment provided, or the app, environment and ID.
+//	Blank lines and those starting with # are skipped.
+func readManifest(name, app, env string) ([]*target, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to open manifest")
+	}
+	defer f.Close()
+
+	targets, n := make([]*target, 0), 0
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch fields := strings.Fields(line); len(fields) {
+		case 1:
+			targets = append(targets, &target{app: app, env: env, id: fields[0]})
+		case 3:
+			targets = append(targets, &target{app: fields[0], env: fields[1], id: fields[2]})
+		default:
+			return nil, errors.Errorf("line %d must be either <id> or <app> <env> <id>", n)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to read manifest")
+	}
+
+	if len(targets) < 1 {
+		return nil, errors.New("manifest does not list any secrets")
+	}
+
+	return targets, nil
+}
+
+//	rotate retrieves, verifies if trusted keys are provided, and decrypts the
+//	secret, re-encrypting it with the next keys using the algorithm, or that it
+//	is encrypted with if not provided, and updates the secret, the secrets
+//	service recording it as a rotation. The secret is re-signed by the signer,
+//	the previous signature no longer matching the content.
+func rotate(d crypto.Decrypters, trusted *sign.Trusted, signer sign.Signer, alg string, next *crypto.Keys, insecure bool, usr, addr, id string, params *url.Values) (*models.Secret, error) {
+	cl := newClient(addr, insecure)
+	cl.User, cl.Decrypters, cl.Trusted = usr, d, trusted
+
+	s, err := cl.Get(stdctx.Background(), params.Get(service.AppParam), params.Get(service.EnvParam), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(alg) < 1 {
+		alg = s.Algorithm
+	}
+
+	//	secrets recorded prior to the algorithm were encrypted with PGP
+	if len(alg) < 1 {
+		alg = crypto.PGP
+	}
+
+	c, err := crypto.New(alg, next)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to encrypt with %s", alg)
+	}
+
+	if signer == nil && len(s.Signature) > 0 {
+		log.Warnf("secret %s was signed but no signing key was provided, so it is no longer signed", s.Id)
+		s.Signature = ""
+	}
+
+	//	the secret is re-signed by the signer as it is re-encrypted
+	cl.Crypter, cl.Signer = c, signer
+	return cl.Rotate(stdctx.Background(), s)
+}
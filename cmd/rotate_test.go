@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+	"github.com/manulife-gwam/peppermint-sparkles/service"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+func TestRotate(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	old, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, app, env, content := uuid.New().String(), "dummy", "test", "notSuperS3cret"
+
+	cypher, err := (&pgp.Crypter{Token: []byte(old)}).Encrypt([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sample := fmt.Sprintf(`{"id":"%s","app_name":"%s","env":"%s","content":"%s"}`, id, app, env, string(cypher))
+	src, err := models.ParseSecret(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UnixNano()
+	rec := &models.Record{
+		Secret:    src,
+		Created:   now,
+		CreatedBy: "tester",
+		Updated:   now,
+		UpdatedBy: "tester",
+		Status:    models.ActiveStatus,
+	}
+
+	if err := rec.Create(context.Background(), ds); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := serve(ds)
+	defer srv.Close()
+
+	addr := srv.URL
+	params := &url.Values{
+		service.AppParam: []string{app},
+		service.EnvParam: []string{env},
+	}
+
+	s, err := rotate(crypto.Decrypters{crypto.PGP: &pgp.Crypter{Token: []byte(old)}}, nil, nil, "", &crypto.Keys{Token: []byte(next)}, false, "rotator", addr, id, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := crypto.PGP, s.Algorithm; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	res, err := get(crypto.Decrypters{crypto.PGP: &pgp.Crypter{Token: []byte(next)}}, nil, false, addr, id, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := content, res.Content; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	if _, err := get(crypto.Decrypters{crypto.PGP: &pgp.Crypter{Token: []byte(old)}}, nil, false, addr, id, params); err == nil {
+		t.Error("want the old token to no longer decrypt the secret")
+	}
+
+	//	history should contain the rotation along with the create
+	rotations := make([]*models.Historical, 0)
+
+	it := ds.IterateHistory(context.Background(), rec.Key())
+	for it.Next() {
+		h, err := models.ParseHistorical(string(it.Value()))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if h.Action == models.RotateAction {
+			rotations = append(rotations, h)
+		}
+	}
+	it.Close()
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rotations) != 1 {
+		t.Fatalf("want 1 rotation in the history, got %d", len(rotations))
+	}
+
+	if want, got := "rotator", rotations[0].UpdatedBy; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	f, err := ioutil.TempFile("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	manifest := `# secrets to rotate
+first
+
+other prod second
+`
+	if _, err := f.WriteString(manifest); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	targets, err := readManifest(f.Name(), "dummy", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []target{{app: "dummy", env: "test", id: "first"}, {app: "other", env: "prod", id: "second"}}
+	if len(targets) != len(want) {
+		t.Fatalf("want %d targets, got %d", len(want), len(targets))
+	}
+
+	for i := range want {
+		if want, got := want[i], *targets[i]; want != got {
+			t.Errorf("\nwant %+v\ngot  %+v\n", want, got)
+		}
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte("dummy second\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readManifest(f.Name(), "dummy", "test"); err == nil {
+		t.Error("want an error for a malformed line")
+	}
+}
@@ -7,17 +7,12 @@ import (
 	"os"
 	"time"
 
-	"github.com/manulife-gwam/peppermint-sparkles/backend"
-	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
-	redisds "github.com/manulife-gwam/peppermint-sparkles/backend/redis"
-	"github.com/manulife-gwam/peppermint-sparkles/internal/pcf/vcap"
+	"github.com/manulife-gwam/peppermint-sparkles/backend/encrypted"
+	"github.com/manulife-gwam/peppermint-sparkles/backend/mirror"
 	"github.com/manulife-gwam/peppermint-sparkles/service"
 
 	log "github.com/sirupsen/logrus"
 
-	bolt "github.com/coreos/bbolt"
-	"github.com/go-redis/redis"
-	"github.com/pkg/errors"
 	"gopkg.in/urfave/cli.v2"
 )
 
@@ -50,86 +45,99 @@ var (
 		EnvVars: []string{"PSPARKLES_TLS_KEY"},
 	}
 
-	DatastoreTypeFlag = cli.StringFlag{
-		Name:    "datastore-type",
-		Aliases: []string{"dst"},
-		Value:   backend.File,
-		Usage:   "backend type to be used for storage",
-		EnvVars: []string{"PSPARKLES_DS_TYPE"},
+	DatastoreTimeoutFlag = cli.DurationFlag{
+		Name:    "datastore-timeout",
+		Aliases: []string{"dsto"},
+		Value:   5 * time.Second,
+		Usage:   "max duration allowed for datastore calls per request (0 for none)",
+		EnvVars: []string{"PSPARKLES_DS_TIMEOUT"},
 	}
 
-	DatastoreFileFlag = cli.StringFlag{
-		Name:    "datastore-file",
-		Aliases: []string{"dsf"},
-		Value:   "/var/lib/peppermint-sparkles/psparkles.db",
-		Usage:   "name / location of file for storing secrets",
-		EnvVars: []string{"PSPARKLES_DS_FILE"},
+	CacheSizeFlag = cli.IntFlag{
+		Name:    "cache-size",
+		Usage:   "max number of records to cache in memory (0 disables caching)",
+		EnvVars: []string{"PSPARKLES_CACHE_SIZE"},
 	}
 
-	DatastoreAddrFlag = cli.StringFlag{
-		Name:    "datastore-addr",
-		Aliases: []string{"dsa"},
-		Value:   "localhost:6379",
-		Usage:   "address for the remote datastore",
-		EnvVars: []string{"PSPARKLES_DS_ADDR"},
+	CacheTtlFlag = cli.DurationFlag{
+		Name:    "cache-ttl",
+		Value:   30 * time.Second,
+		Usage:   "max duration a record is cached",
+		EnvVars: []string{"PSPARKLES_CACHE_TTL"},
+	}
+
+	MirrorToFlag = cli.StringFlag{
+		Name:    "mirror-to",
+		Usage:   "secondary datastore to mirror all writes to, e.g. redis:localhost:6379 (see migrate)",
+		EnvVars: []string{"PSPARKLES_MIRROR_TO"},
+	}
+
+	CompactIntervalFlag = cli.DurationFlag{
+		Name:    "compact-interval",
+		Value:   time.Hour,
+		Usage:   "interval at which history not retained by the policy is removed",
+		EnvVars: []string{"PSPARKLES_COMPACT_INTERVAL"},
 	}
 
 	Serve = &cli.Command{
 		Name:    "server",
 		Aliases: []string{"serve"},
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&StdListenPortFlag,
 			&TlsListenPortFlag,
 			&TlsCertFlag,
 			&TlsKeyFlag,
-			&DatastoreAddrFlag,
-			&DatastoreFileFlag,
-			&DatastoreTypeFlag,
-		},
+			&DatastoreTimeoutFlag,
+			&CacheSizeFlag,
+			&CacheTtlFlag,
+			&MirrorToFlag,
+			&AdminTokenFlag,
+			&CompactIntervalFlag,
+		}, append(retentionFlags, datastoreFlags...)...),
 		Usage: "start the server",
 
 		Action: func(context *cli.Context) error {
-			var (
-				ds  backend.Datastore
-				err error
-			)
-
-			dst := context.String(DatastoreTypeFlag.Name)
-
-			switch dst {
-			case backend.Redis:
-				opts := &redis.Options{Addr: context.String(DatastoreAddrFlag.Name)}
+			be, err := openBackend(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
 
-				//	check if running in PCF pull the vcap services if available
-				services, err := vcap.GetServices()
+			//	values are mirrored as stored (i.e. encrypted at rest)
+			primary := be
+			if spec := context.String(MirrorToFlag.Name); len(spec) > 0 {
+				secondary, err := openSpec(context, spec)
 				if err != nil {
-					return cli.Exit(errors.Wrap(err, "unable to retrieve vcap services"), 1)
+					primary.Close()
+					return cli.Exit(err, 1)
 				}
 
-				if services != nil {
-					if i := services.Tagged(dst); i != nil {
-						creds := i.Credentials
-						opts = &redis.Options{
-							Addr:     fmt.Sprintf("%s:%d", creds["host"].(string), int(creds["port"].(float64))),
-							Password: creds["password"].(string),
-						}
-					}
-				}
+				log.Infof("mirroring writes to %s", spec)
+				be = mirror.New(primary, secondary)
+			}
 
-				if ds, err = redisds.Open(opts); err != nil {
-					return cli.Exit(errors.Wrap(err, "unable to open connection to datastore"), 1)
-				}
+			ds, err := withEncryption(context, be)
+			if err != nil {
+				be.Close()
+				return cli.Exit(err, 1)
+			}
+
+			//	reload the master keys on SIGHUP to allow for rotating without
+			//	a restart
+			if eds, ok := ds.(*encrypted.Datastore); ok {
+				go reloadKeyring(context.String(DatastoreKeyFileFlag.Name), eds)
+			}
 
-			case backend.File:
+			ds = withCache(context, ds, primary)
 
-				//	FIXME ... include / handle additional bolt options (e.g. timeout, etc)
-				fname := context.String(DatastoreFileFlag.Name)
-				if ds, err = fileds.Open(fname, bolt.DefaultOptions); err != nil {
-					return cli.Exit(errors.Wrap(err, "unable to open connection to datastore"), 1)
+			//	history is compacted through the decrypting datastore since
+			//	entries are ordered by their contents
+			if policy := retention(context); policy.Enabled() {
+				interval := context.Duration(CompactIntervalFlag.Name)
+				if interval <= 0 {
+					ds.Close()
+					return cli.Exit("the compact interval must be positive", 1)
 				}
-
-			default:
-				return cli.Exit(errors.Errorf("%s is not a supported datastore type", dst), 1)
+				go compactHistory(ds, policy, interval)
 			}
 
 			defer ds.Close()
@@ -138,7 +146,19 @@ var (
 			mux := http.NewServeMux()
 
 			//	attach current service handler
-			mux = service.Handle(mux, &service.Handler{Backend: ds})
+			mux = service.Handle(mux, &service.Handler{
+				Backend: ds,
+				Timeout: context.Duration(DatastoreTimeoutFlag.Name),
+			})
+
+			//	backups are made of the primary as stored (i.e. encrypted at
+			//	rest and without caching)
+			if token := context.String(AdminTokenFlag.Name); len(token) > 0 {
+				mux = service.HandleAdmin(mux, &service.AdminHandler{
+					Backend: primary,
+					Token:   token,
+				})
+			}
 
 			//	start HTTPS listener in a seperate go routine since it is a blocking func
 			go func() {
@@ -199,3 +219,4 @@ var (
 		},
 	}
 )
+
@@ -2,19 +2,19 @@ package main
 
 import (
 	"bufio"
+	stdctx "context"
 	"io"
 	"io/ioutil"
-	"net/url"
+	"math"
 	"os"
 	"os/user"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/manulife-gwam/peppermint-sparkles/crypto"
-	"github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/sign"
 	"github.com/manulife-gwam/peppermint-sparkles/models"
-	"github.com/manulife-gwam/peppermint-sparkles/service"
 
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	cli "gopkg.in/urfave/cli.v2"
 )
@@ -27,8 +27,22 @@ var (
 			&AddrFlag,
 			&SecretFlag,
 			&SecretFileFlag,
+			&ContentFileFlag,
+			&AppNameFlag,
+			&AppEnvFlag,
 			&EncryptFlag,
+			&AlgorithmFlag,
 			&TokenFlag,
+			&TokenTypeFlag,
+			&TokenWordsFlag,
+			&AllowWeakTokenFlag,
+			&KDFFlag,
+			&SplitFlag,
+			&SharesDirFlag,
+			&RecipientFlag,
+			&KMSFlag,
+			&SigningKeyFlag,
+			&SigningPassphraseFlag,
 			&SecretIdFlag,
 			&InsecureFlag,
 		},
@@ -41,11 +55,37 @@ var (
 				return nil
 			}
 
-			raw, f := context.String(SecretFlag.Name), context.String(SecretFileFlag.Name)
-			if len(raw) > 0 && len(f) > 0 {
+			raw, f, content := context.String(SecretFlag.Name), context.String(SecretFileFlag.Name), context.String(ContentFileFlag.Name)
+			if (len(raw) > 0 && len(f) > 0) || (len(content) > 0 && len(raw)+len(f) > 0) {
 				return cli.Exit(errors.New("only 1 input method is allowed"), 1)
 			}
 
+			//	the content file is encrypted as it is sent rather than read in,
+			//	the rest of the secret being given by flags
+			var secret *models.Secret
+			if len(content) > 0 {
+				info, err := os.Stat(content)
+				if err != nil {
+					return cli.Exit(errors.Wrap(err, "unable to access content file"), 1)
+				}
+
+				//	the service reads in the secret as a whole, so the content is
+				//	limited as the secret is
+				if info.Size() > int64(MaxData) {
+					return cli.Exit(errors.Errorf("content must be less than %dMB", MaxData/int(math.Pow10(6))), 1)
+				}
+
+				secret = &models.Secret{
+					Id:  context.String(SecretIdFlag.Name),
+					App: context.String(AppNameFlag.Name),
+					Env: context.String(AppEnvFlag.Name),
+				}
+
+				if len(secret.App) < 1 || len(secret.Env) < 1 {
+					return cli.Exit(errors.New("app name and environment must be specified with a content file"), 1)
+				}
+			}
+
 			//	raw should not have anything if this is true
 			if len(f) > 0 {
 				info, err := os.Stat(f)
@@ -67,7 +107,7 @@ var (
 
 			//	if raw is still empty at this point, attempt to read in piped data
 			tick := 0
-			for len(raw) < 1 {
+			for len(raw) < 1 && secret == nil {
 				if tick > 0 {
 					return cli.Exit(errors.New("a valid secret must be specified"), 1)
 				}
@@ -88,16 +128,79 @@ var (
 
 			encrypt := context.Bool(EncryptFlag.Name)
 			token := context.String(TokenFlag.Name)
+			recipients := context.StringSlice(RecipientFlag.Name)
+
+			kms := context.String(KMSFlag.Name)
+
+			alg := context.String(AlgorithmFlag.Name)
+			if len(kms) > 0 && !context.IsSet(AlgorithmFlag.Name) {
+				alg = crypto.KMS
+			}
+
+			//	a token is used unless encrypting to recipients or with a data key
+			//	wrapped by the key-management provider
+			tokenized := encrypt && len(recipients) < 1 && alg != crypto.KMS
+
+			//	the token is split into shares rather than displayed, so there is
+			//	no single token holder
+			var threshold, parts int
+			split := context.String(SplitFlag.Name)
+			if len(split) > 0 {
+				if !tokenized {
+					return cli.Exit(errors.New("split requires encrypting with a token, not recipients or a key-management provider"), 1)
+				}
+
+				if len(token) > 0 {
+					return cli.Exit(errors.New("token is generated when split, so cannot be specified"), 1)
+				}
+
+				t, p, err := parseSplit(split)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+				threshold, parts = t, p
+			}
+
+			var c crypto.Crypter
 			if encrypt {
-				if len(token) < 1 {
+				if tokenized && len(token) < 1 {
 					//	attempt to generate a token if one not provided, erroring and exiting
 					//	if unable. This attempts to prevent encrypting with empty string
-					t, err := crypto.NewToken()
+					t, err := generateToken(context)
 					if err != nil {
-						return cli.Exit(errors.Wrap(err, "unable to generate encryption token"), 1)
+						return cli.Exit(err, 1)
 					}
 					token = t
+				} else if tokenized {
+					if err := checkToken(context, token); err != nil {
+						return cli.Exit(err, 1)
+					}
+				}
+
+				kdf, err := kdfParams(context)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+
+				cr, err := crypto.New(alg, &crypto.Keys{Token: []byte(token), Recipients: recipients, KMS: kms, KDF: kdf})
+				if err != nil {
+					return cli.Exit(errors.Wrapf(err, "unable to encrypt with %s", alg), 1)
 				}
+				c = cr
+			}
+
+			signer, err := signingKey(context)
+			if err != nil {
+				return cli.Exit(err, 1)
+			}
+
+			var shares []string
+			if len(split) > 0 {
+				sh, err := splitToken(token, threshold, parts)
+				if err != nil {
+					return cli.Exit(err, 1)
+				}
+				shares = sh
 			}
 
 			// get current logged in user
@@ -108,15 +211,30 @@ var (
 
 			insecure := context.Bool(InsecureFlag.Name)
 
-			s, err := set(encrypt, insecure, token, u.Username, raw, addr)
+			var s *models.Secret
+			if secret != nil {
+				s, err = setFile(c, signer, insecure, u.Username, addr, secret, content)
+			} else {
+				s, err = set(c, signer, insecure, u.Username, raw, addr)
+			}
+
 			if err != nil {
 				return cli.Exit(errors.Wrap(err, "unable to set secret"), 1)
 			}
 
-			//	ensure to display encryption token, since it may have been generated
-			if encrypt {
+			//	ensure to display encryption token, since it may have been generated,
+			//	or its shares
+			switch {
+			case len(shares) > 0:
+				display(shares, threshold, context.String(SharesDirFlag.Name), s.Id)
+			case tokenized:
 				log.Infof("token: %s", token)
 			}
+
+			//	content files are typically too large to be displayed
+			if secret != nil {
+				s.Content = ""
+			}
 			log.Infof("secret:\n%s", s.MustString())
 
 			return nil
@@ -124,6 +242,21 @@ var (
 	}
 )
 
+//	display writes the token shares to files in the directory if provided,
+//	displaying them if not or if unable to, since the secret is already set
+func display(shares []string, threshold int, dir, id string) {
+	if len(dir) > 0 {
+		names, err := writeShares(dir, id, shares)
+		if err == nil {
+			log.Infof("token shares (any %d of %d recombine the token):\n%s", threshold, len(shares), strings.Join(names, "\n"))
+			return
+		}
+		log.Errorf("unable to write token shares, displaying them instead: %v", err)
+	}
+
+	log.Infof("token shares (any %d of %d recombine the token):\n%s", threshold, len(shares), strings.Join(shares, "\n"))
+}
+
 func pipe() (string, error) {
 	fi, err := os.Stdin.Stat()
 	if err != nil {
@@ -150,46 +283,33 @@ func pipe() (string, error) {
 	return string(res), nil
 }
 
-func set(encrypt, insecure bool, token, usr, raw, addr string) (*models.Secret, error) {
+//	set sends the secret to the secrets service, encrypting the content first
+//	if a crypter is provided, then signing it if a signer is provided
+func set(c crypto.Crypter, signer sign.Signer, insecure bool, usr, raw, addr string) (*models.Secret, error) {
 	s, err := models.ParseSecret(raw)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to parse secret")
 	}
 
-	// ensure the secret has an ID set
-	if len(s.Id) < 1 {
-		s.Id = uuid.New().String()
-	}
-
-	if encrypt {
-		c := &pgp.Crypter{Token: []byte(token)}
-
-		// encrypt the content of the secret
-		cypher, err := c.Encrypt([]byte(s.Content))
-		if err != nil {
-			return nil, errors.Wrap(err, "unable to encrypt secret content")
-		}
-
-		// set the content to the encrypted text
-		s.Content = string(cypher)
-	}
-
-	params := url.Values{
-		service.UserParam: []string{usr},
-		service.AppParam:  []string{s.App},
-		service.EnvParam:  []string{s.Env},
-		service.IdParam:   []string{s.Id},
-	}
+	return store(c, signer, insecure, usr, addr, s, strings.NewReader(s.Content))
+}
 
-	res, err := send(asURL(addr, service.PathSecrets, params.Encode()), s.MustString(), insecure)
+//	setFile sends the secret with the content read from the file, as set does
+func setFile(c crypto.Crypter, signer sign.Signer, insecure bool, usr, addr string, s *models.Secret, name string) (*models.Secret, error) {
+	f, err := os.Open(name)
 	if err != nil {
-		return nil, errors.Wrap(err, "unable to send secret")
+		return nil, errors.Wrap(err, "unable to open content file")
 	}
+	defer f.Close()
 
-	in, err := models.ParseSecret(string(res))
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to parse in service response")
-	}
+	return store(c, signer, insecure, usr, addr, s, f)
+}
+
+//	store sends the secret with the content read from r to the secrets
+//	service, encrypted with the crypter and signed by the signer if provided
+func store(c crypto.Crypter, signer sign.Signer, insecure bool, usr, addr string, s *models.Secret, r io.Reader) (*models.Secret, error) {
+	cl := newClient(addr, insecure)
+	cl.User, cl.Crypter, cl.Signer = usr, c, signer
 
-	return in, nil
+	return cl.CreateFrom(stdctx.Background(), s, r)
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
@@ -11,6 +14,9 @@ import (
 	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
 	"github.com/manulife-gwam/peppermint-sparkles/crypto"
 	"github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/sign"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/xchacha"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
 	"github.com/manulife-gwam/peppermint-sparkles/service"
 
 	bolt "github.com/coreos/bbolt"
@@ -53,7 +59,7 @@ func TestSet(t *testing.T) {
 	raw := fmt.Sprintf(`{"app_name":"%s","env":"%s","content":"%s"}`, app, env, content)
 	addr := fmt.Sprintf("http://localhost:%d", port)
 
-	s, err := set(true, false, tok, "tester", raw, addr)
+	s, err := set(&pgp.Crypter{Token: []byte(tok)}, nil, false, "tester", raw, addr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -118,11 +124,11 @@ func TestSetInsecure(t *testing.T) {
 	raw := fmt.Sprintf(`{"app_name":"%s","env":"%s","content":"%s"}`, app, env, content)
 	addr := fmt.Sprintf("https://localhost:%d", port)
 
-	if _, err := set(true, false, tok, "tester", raw, addr); err != nil && !strings.HasSuffix(err.Error(), "x509: certificate signed by unknown authority") {
+	if _, err := set(&pgp.Crypter{Token: []byte(tok)}, nil, false, "tester", raw, addr); err != nil && !strings.HasSuffix(err.Error(), "x509: certificate signed by unknown authority") {
 		t.Fatal(err)
 	}
 
-	s, err := set(true, true, tok, "tester", raw, addr)
+	s, err := set(&pgp.Crypter{Token: []byte(tok)}, nil, true, "tester", raw, addr)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -203,8 +209,110 @@ func TestInvalidSet(t *testing.T) {
 	}
 
 	for _, s := range samples {
-		if _, err := set(true, false, tok, "tester", s.value, addr); err != nil && strings.TrimSpace(err.Error()) != s.message {
+		if _, err := set(&pgp.Crypter{Token: []byte(tok)}, nil, false, "tester", s.value, addr); err != nil && strings.TrimSpace(err.Error()) != s.message {
 			t.Errorf("\nwant %s\ngot  %s\n", s.message, err.Error())
 		}
 	}
 }
+
+func TestSetFile(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	srv := serve(ds)
+	defer srv.Close()
+
+	tok, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//	binary content spanning several chunks, including bytes which would
+	//	need escaping in JSON
+	content := make([]byte, 3*crypto.ChunkSize+7)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	name := fmt.Sprintf("test_%s.bin", uuid.New().String())
+	if err := ioutil.WriteFile(name, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(name)
+
+	out := fmt.Sprintf("test_%s.out", uuid.New().String())
+	defer os.Remove(out)
+
+	addr := srv.URL
+	params := &url.Values{
+		service.AppParam: []string{"dummy"},
+		service.EnvParam: []string{"test"},
+	}
+
+	signer, trusted := signingKeys(t)
+
+	wrong := crypto.Decrypters{
+		crypto.PGP:     &pgp.Crypter{Token: []byte("wrong")},
+		crypto.XChaCha: &xchacha.Crypter{Token: []byte("wrong")},
+	}
+
+	for _, tc := range []struct {
+		c      crypto.Crypter
+		signer sign.Signer
+	}{
+		{c: &pgp.Crypter{Token: []byte(tok)}},
+		{c: &xchacha.Crypter{Token: []byte(tok), Cost: 10}},
+		{c: &xchacha.Crypter{Token: []byte(tok), Cost: 10}, signer: signer},
+	} {
+		s, err := setFile(tc.c, tc.signer, false, "tester", addr, &models.Secret{App: "dummy", Env: "test"}, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := crypto.Algorithm(tc.c), s.Algorithm; want != got {
+			t.Errorf("\nwant %s\ngot  %s\n", want, got)
+		}
+
+		var verify *sign.Trusted
+		if tc.signer != nil {
+			verify = trusted
+		}
+
+		res, err := get(nil, verify, false, addr, s.Id, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := crypto.Decrypters{crypto.Algorithm(tc.c): tc.c}
+		if err := writeContent(d, res, out); err != nil {
+			t.Fatal(err)
+		}
+
+		raw, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(raw, content) {
+			t.Errorf("%s: content written does not match", s.Algorithm)
+		}
+
+		//	the output is left as is if the content cannot be decrypted
+		if err := writeContent(wrong, res, out); err == nil {
+			t.Errorf("%s: expected the wrong token to fail", s.Algorithm)
+		}
+
+		if raw, err := ioutil.ReadFile(out); err != nil || !bytes.Equal(raw, content) {
+			t.Errorf("%s: expected the output to be left as is", s.Algorithm)
+		}
+	}
+}
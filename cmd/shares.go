@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/shamir"
+
+	"github.com/pkg/errors"
+)
+
+//	parseSplit parses the N/M split of a token into M shares, any N of which
+//	recombine it
+func parseSplit(spec string) (int, int, error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) != 2 {
+		return 0, 0, errors.Errorf("split %q must be N/M", spec)
+	}
+
+	threshold, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "split %q must be N/M", spec)
+	}
+
+	shares, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "split %q must be N/M", spec)
+	}
+
+	return threshold, shares, nil
+}
+
+//	splitToken splits the token into the shares, encoded as base64
+func splitToken(token string, threshold, shares int) ([]string, error) {
+	raw, err := shamir.Split([]byte(token), shares, threshold)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to split token")
+	}
+
+	out := make([]string, len(raw))
+	for i, share := range raw {
+		out[i] = base64.StdEncoding.EncodeToString(share)
+	}
+	return out, nil
+}
+
+//	combineShares recombines the token from the shares, each either the share
+//	or a file containing it (as written by writeShares), and which may be
+//	comma separated
+func combineShares(values []string) (string, error) {
+	in := make([]string, 0, len(values))
+	for _, v := range values {
+		in = append(in, strings.Split(v, ",")...)
+	}
+
+	raw := make([][]byte, len(in))
+	for i, share := range in {
+		if b, err := ioutil.ReadFile(share); err == nil {
+			share = string(b)
+		}
+
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(share))
+		if err != nil {
+			return "", errors.Wrapf(err, "share %d is neither a valid share nor a file containing one", i+1)
+		}
+		raw[i] = b
+	}
+
+	token, err := shamir.Combine(raw)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to recombine token")
+	}
+	return string(token), nil
+}
+
+//	writeShares writes each share to a separate file in the directory, named
+//	by the secret ID and share number, returning the file names
+func writeShares(dir, id string, shares []string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(err, "unable to create shares directory")
+	}
+
+	names := make([]string, len(shares))
+	for i, share := range shares {
+		names[i] = filepath.Join(dir, fmt.Sprintf("%s.share-%d", id, i+1))
+
+		if err := ioutil.WriteFile(names[i], []byte(share+"\n"), 0600); err != nil {
+			return nil, errors.Wrapf(err, "unable to write share %d", i+1)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+)
+
+func TestParseSplit(t *testing.T) {
+	tests := []struct {
+		spec              string
+		threshold, shares int
+		valid             bool
+	}{
+		{spec: "3/5", threshold: 3, shares: 5, valid: true},
+		{spec: " 2 / 3 ", threshold: 2, shares: 3, valid: true},
+		{spec: "3"},
+		{spec: "3/5/7"},
+		{spec: "three/5"},
+		{spec: "3/"},
+	}
+
+	for _, tc := range tests {
+		threshold, shares, err := parseSplit(tc.spec)
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("%q: want valid %t, got %v", tc.spec, tc.valid, err)
+			continue
+		}
+
+		if threshold != tc.threshold || shares != tc.shares {
+			t.Errorf("%q: want %d/%d, got %d/%d", tc.spec, tc.threshold, tc.shares, threshold, shares)
+		}
+	}
+}
+
+func TestShares(t *testing.T) {
+	token, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shares, err := splitToken(token, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "shares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names, err := writeShares(dir, "id", shares)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//	shares may be given directly or as the files written
+	for _, in := range [][]string{shares[:2], shares[1:], {names[0], shares[2]}, names[1:], {shares[0] + "," + names[2]}} {
+		res, err := combineShares(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res != token {
+			t.Errorf("\nwant %s\ngot  %s\n", token, res)
+		}
+	}
+
+	if _, err := combineShares(shares[:1]); err == nil {
+		t.Error("want an error for too few shares")
+	}
+
+	if _, err := combineShares([]string{shares[0], "not a share!"}); err == nil {
+		t.Error("want an error for an invalid share")
+	}
+}
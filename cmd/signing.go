@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/sign"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+//	signingKey returns the signer for the signing key specified, if any
+func signingKey(context *cli.Context) (sign.Signer, error) {
+	name := context.String(SigningKeyFlag.Name)
+	if len(name) < 1 {
+		return nil, nil
+	}
+
+	s, err := sign.LoadSigner(name, []byte(context.String(SigningPassphraseFlag.Name)))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read in signing key")
+	}
+	return s, nil
+}
+
+//	trustedKeys returns the keys to verify signatures against if verifying,
+//	which may be comma separated
+func trustedKeys(context *cli.Context) (*sign.Trusted, error) {
+	if !context.Bool(VerifyFlag.Name) {
+		return nil, nil
+	}
+
+	names := make([]string, 0)
+	for _, v := range context.StringSlice(TrustedKeysFlag.Name) {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				names = append(names, name)
+			}
+		}
+	}
+
+	if len(names) < 1 {
+		return nil, errors.Errorf("trusted keys must be specified in order to verify")
+	}
+
+	t, err := sign.LoadTrusted(names...)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read in trusted keys")
+	}
+	return t, nil
+}
+
+//	signSecret signs the secret, as it is to be stored, with the signer
+func signSecret(signer sign.Signer, s *models.Secret) error {
+	sig, err := signer.Sign(s.Signed())
+	if err != nil {
+		return errors.Wrap(err, "unable to sign secret")
+	}
+	s.Signature = sig
+	return nil
+}
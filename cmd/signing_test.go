@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/sign"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+	"github.com/manulife-gwam/peppermint-sparkles/service"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+//	signingKeys writes a PEM encoded ed25519 private key and public key,
+//	returning the signer and the keys trusting it
+func signingKeys(t *testing.T) (sign.Signer, *sign.Trusted) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawPriv, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawPub, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privName, pubName := fmt.Sprintf("test_%s.pem", uuid.New().String()), fmt.Sprintf("test_%s.pub", uuid.New().String())
+	defer os.Remove(privName)
+	defer os.Remove(pubName)
+
+	if err := ioutil.WriteFile(privName, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rawPriv}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(pubName, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rawPub}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := sign.LoadSigner(privName, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trusted, err := sign.LoadTrusted(pubName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer, trusted
+}
+
+func TestSigned(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	srv := serve(ds)
+	defer srv.Close()
+
+	tok, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, trusted := signingKeys(t)
+	_, untrusted := signingKeys(t)
+
+	addr := srv.URL
+	app, env := "dummy", "test"
+	params := &url.Values{
+		service.AppParam: []string{app},
+		service.EnvParam: []string{env},
+	}
+
+	c := &pgp.Crypter{Token: []byte(tok)}
+	d := crypto.Decrypters{crypto.PGP: c}
+
+	signed, err := set(c, signer, false, "tester", fmt.Sprintf(`{"app_name":"%s","env":"%s","content":"notSuperS3cret"}`, app, env), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(signed.Signature) < 1 {
+		t.Fatal("expected the secret to be signed")
+	}
+
+	res, err := get(d, trusted, false, addr, signed.Id, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "notSuperS3cret", res.Content; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	if _, err := get(d, untrusted, false, addr, signed.Id, params); errors.Cause(err) != sign.ErrUntrusted {
+		t.Errorf("\nwant %v\ngot  %v\n", sign.ErrUntrusted, err)
+	}
+
+	unsigned, err := set(c, nil, false, "tester", fmt.Sprintf(`{"app_name":"%s","env":"%s","content":"alsoNotS3cret"}`, app, env), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := get(d, trusted, false, addr, unsigned.Id, params); errors.Cause(err) != sign.ErrUnsigned {
+		t.Errorf("\nwant %v\ngot  %v\n", sign.ErrUnsigned, err)
+	}
+
+	//	content swapped in from another secret, keeping the signature, no longer
+	//	matches
+	swapped := *signed
+	swapped.Content = unsigned.Content
+	mallory := newClient(addr, false)
+	mallory.User = "mallory"
+
+	if _, err := mallory.Update(context.Background(), &swapped); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := get(d, trusted, false, addr, signed.Id, params); errors.Cause(err) != sign.ErrInvalidSignature {
+		t.Errorf("\nwant %v\ngot  %v\n", sign.ErrInvalidSignature, err)
+	}
+
+	//	content encrypted elsewhere is signed with the algorithm the service
+	//	records for it
+	cypher, err := c.Encrypt([]byte("encryptedElsewhere"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := (&models.Secret{App: app, Env: env, Content: string(cypher)}).MustString()
+	elsewhere, err := set(nil, signer, false, "tester", raw, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := crypto.PGP, elsewhere.Algorithm; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	res, err = get(d, trusted, false, addr, elsewhere.Id, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "encryptedElsewhere", res.Content; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	//	rotating re-signs the secret with the new content
+	next, err := crypto.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rotate(d, trusted, signer, "", &crypto.Keys{Token: []byte(next)}, false, "rotator", addr, unsigned.Id, params); errors.Cause(err) != sign.ErrUnsigned {
+		t.Errorf("\nwant %v\ngot  %v\n", sign.ErrUnsigned, err)
+	}
+
+	if _, err := rotate(d, nil, signer, "", &crypto.Keys{Token: []byte(next)}, false, "rotator", addr, unsigned.Id, params); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = get(crypto.Decrypters{crypto.PGP: &pgp.Crypter{Token: []byte(next)}}, trusted, false, addr, unsigned.Id, params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "alsoNotS3cret", res.Content; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+}
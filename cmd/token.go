@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	"github.com/pkg/errors"
+	"gopkg.in/urfave/cli.v2"
+)
+
+//	generateToken generates a token of the type specified
+func generateToken(context *cli.Context) (string, error) {
+	t, err := crypto.GenerateToken(context.String(TokenTypeFlag.Name), context.Int(TokenWordsFlag.Name))
+	if err != nil {
+		return "", errors.Wrap(err, "unable to generate encryption token")
+	}
+	return t, nil
+}
+
+//	checkToken checks the token provided is strong enough to encrypt with,
+//	unless weak tokens are allowed
+func checkToken(context *cli.Context, token string) error {
+	if context.Bool(AllowWeakTokenFlag.Name) {
+		return nil
+	}
+
+	if err := crypto.CheckToken(token); err != nil {
+		return errors.Wrapf(err, "use a generated token or --%s", AllowWeakTokenFlag.Name)
+	}
+	return nil
+}
+
+//	kdfParams returns the KDF parameters specified, if any
+func kdfParams(context *cli.Context) (*crypto.KDFParams, error) {
+	spec := context.String(KDFFlag.Name)
+	if len(spec) < 1 {
+		return nil, nil
+	}
+
+	params, err := crypto.ParseKDF(spec)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid KDF parameters")
+	}
+	return params, nil
+}
@@ -0,0 +1,150 @@
+package age
+
+import (
+	"encoding/base64"
+	"io"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	fage "filippo.io/age"
+	"github.com/pkg/errors"
+)
+
+//  intro is the version line starting every age file
+const intro string = "age-encryption.org/v1"
+
+const (
+	//  DefaultWorkFactor is the log2 of the scrypt cost used by default,
+	//  taking around a second to derive the key
+	DefaultWorkFactor int = 18
+
+	//  maxWorkFactor caps the cost accepted when decrypting, to bound the time
+	//  and memory a crafted secret can consume
+	maxWorkFactor int = 22
+)
+
+var (
+	ErrNoRecipients = errors.New("at least one recipient or a passphrase is required")
+	ErrNoIdentity   = errors.New("no identity able to decrypt the secret")
+	ErrIncorrect    = errors.New("incorrect passphrase")
+)
+
+//  Crypter encrypts in the age format (https://age-encryption.org), either to
+//  one or more X25519 public keys (recipients) or with a passphrase. The output
+//  is the base64 encoded binary age file, so may be decrypted by the age tool:
+//
+//  	base64 -d | age -d -i key.txt
+type Crypter struct {
+	//  Recipients are the public keys to encrypt to, if set the passphrase is
+	//  not used to encrypt
+	Recipients []*X25519Recipient
+
+	//  Identities are the private keys to decrypt with
+	Identities []*X25519Identity
+
+	//  Passphrase encrypts (when no recipients are set) and decrypts with a
+	//  key derived by scrypt
+	Passphrase []byte
+
+	//  WorkFactor is the log2 of the scrypt cost when encrypting with the
+	//  passphrase, DefaultWorkFactor if unset
+	WorkFactor int
+}
+
+//  Algorithm returns the algorithm recorded in secrets encrypted by the crypter
+func (c *Crypter) Algorithm() string {
+	return crypto.Age
+}
+
+func (c *Crypter) Encrypt(text []byte) ([]byte, error) {
+	return crypto.Encrypt(c, text)
+}
+
+func (c *Crypter) Decrypt(cypher []byte) ([]byte, error) {
+	return crypto.Decrypt(c, cypher)
+}
+
+//  EncryptStream encrypts the text to every recipient, or with the passphrase
+func (c *Crypter) EncryptStream(dst io.Writer, src io.Reader) error {
+	recipients := make([]fage.Recipient, 0, len(c.Recipients))
+	for _, r := range c.Recipients {
+		recipients = append(recipients, r)
+	}
+
+	if len(recipients) < 1 && len(c.Passphrase) > 0 {
+		factor := c.WorkFactor
+		if factor < 1 {
+			factor = DefaultWorkFactor
+		}
+
+		if factor > maxWorkFactor {
+			return errors.Errorf("scrypt work factor %d exceeds the maximum of %d", factor, maxWorkFactor)
+		}
+
+		r, err := fage.NewScryptRecipient(string(c.Passphrase))
+		if err != nil {
+			return err
+		}
+		r.SetWorkFactor(factor)
+		recipients = append(recipients, r)
+	}
+
+	if len(recipients) < 1 {
+		return ErrNoRecipients
+	}
+
+	b64 := base64.NewEncoder(base64.StdEncoding, dst)
+	w, err := fage.Encrypt(b64, recipients...)
+	if err != nil {
+		return errors.Wrap(err, "unable to encrypt")
+	}
+
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "unable to encrypt")
+	}
+	return b64.Close()
+}
+
+//  DecryptStream decrypts the cypher with whichever identity it was encrypted
+//  to, or the passphrase
+func (c *Crypter) DecryptStream(dst io.Writer, src io.Reader) error {
+	identities := make([]fage.Identity, 0, len(c.Identities)+1)
+	for _, i := range c.Identities {
+		identities = append(identities, i)
+	}
+
+	if len(c.Passphrase) > 0 {
+		i, err := fage.NewScryptIdentity(string(c.Passphrase))
+		if err != nil {
+			return err
+		}
+		i.SetMaxWorkFactor(maxWorkFactor)
+		identities = append(identities, i)
+	}
+
+	if len(identities) < 1 {
+		return ErrNoIdentity
+	}
+
+	r, err := fage.Decrypt(base64.NewDecoder(base64.StdEncoding, src), identities...)
+	if _, ok := err.(*fage.NoIdentityMatchError); ok {
+		//  with only a passphrase, the passphrase is wrong
+		if len(c.Identities) < 1 {
+			return ErrIncorrect
+		}
+		return ErrNoIdentity
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "unable to decrypt")
+	}
+
+	if _, err := io.Copy(dst, r); err != nil {
+		return errors.Wrap(err, "unable to decrypt")
+	}
+	return nil
+}
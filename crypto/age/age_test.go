@@ -0,0 +1,286 @@
+package age
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	fage "filippo.io/age"
+)
+
+//  the age testkit identity, a secret of 0x42 bytes
+const (
+	testIdentity  = "AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX"
+	testRecipient = "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj"
+)
+
+func TestKeys(t *testing.T) {
+	id, err := ParseX25519Identity(testIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if id.String() != testIdentity {
+		t.Errorf("expected identity %s, got %s", testIdentity, id.String())
+	}
+
+	if r := id.Recipient().String(); r != testRecipient {
+		t.Errorf("expected recipient %s, got %s", testRecipient, r)
+	}
+
+	if _, err := ParseX25519Recipient(testIdentity); err == nil {
+		t.Error("expected an identity to be rejected as a recipient")
+	}
+
+	ids, err := ParseIdentities(strings.NewReader("# created: today\n# public key: " + testRecipient + "\n\n" + testIdentity + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 1 || ids[0].String() != testIdentity {
+		t.Errorf("unexpected identities %v", ids)
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	text := []byte("Good news, everyone!")
+
+	alice, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := ParseX25519Identity(testIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	eve, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := &Crypter{Recipients: []*X25519Recipient{alice.Recipient(), bob.Recipient()}}
+	cypher, err := enc.Encrypt(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(string(cypher))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(raw, []byte(intro+"\n-> X25519 ")) {
+		t.Errorf("unexpected header\n%s", raw)
+	}
+
+	if alg := crypto.Detect(cypher); alg != crypto.Age {
+		t.Errorf("want %s detected, got %q", crypto.Age, alg)
+	}
+
+	for _, id := range []*X25519Identity{alice, bob} {
+		res, err := (&Crypter{Identities: []*X25519Identity{eve, id}}).Decrypt(cypher)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(res, text) {
+			t.Errorf("expected %q, got %q", text, res)
+		}
+	}
+
+	if _, err := (&Crypter{Identities: []*X25519Identity{eve}}).Decrypt(cypher); err != ErrNoIdentity {
+		t.Errorf("expected ErrNoIdentity, got %v", err)
+	}
+
+	if _, err := enc.Decrypt(cypher); err != ErrNoIdentity {
+		t.Errorf("expected ErrNoIdentity without identities, got %v", err)
+	}
+
+	if _, err := (&Crypter{}).Encrypt(text); err != ErrNoRecipients {
+		t.Errorf("expected ErrNoRecipients, got %v", err)
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	text := []byte("Shut up and take my money!")
+
+	c := &Crypter{Passphrase: []byte("correct horse"), WorkFactor: 10}
+	cypher, err := c.Encrypt(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Decrypt(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, text) {
+		t.Errorf("expected %q, got %q", text, res)
+	}
+
+	if _, err := (&Crypter{Passphrase: []byte("battery staple")}).Decrypt(cypher); err != ErrIncorrect {
+		t.Errorf("expected ErrIncorrect, got %v", err)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	id, err := GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Crypter{Recipients: []*X25519Recipient{id.Recipient()}, Identities: []*X25519Identity{id}}
+
+	//  empty, exactly one chunk, and spanning chunks with a partial final chunk
+	for _, size := range []int{0, crypto.ChunkSize, 2*crypto.ChunkSize + 7} {
+		text := bytes.Repeat([]byte{'x'}, size)
+
+		cypher, err := c.Encrypt(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := c.Decrypt(cypher)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(res, text) {
+			t.Errorf("%d bytes: text does not match", size)
+		}
+
+		//  dropping the final chunk must not go unnoticed
+		if size > crypto.ChunkSize {
+			raw := decode(t, cypher)
+			if _, err := c.Decrypt(encode(raw[:len(raw)-7-16])); err == nil {
+				t.Errorf("%d bytes: expected truncation to be detected", size)
+			}
+		}
+	}
+
+	cypher, err := c.Encrypt([]byte("tampered"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := decode(t, cypher)
+
+	//  flip a bit of the header stanza body
+	i := bytes.IndexByte(raw, '\n')
+	i = bytes.IndexByte(raw[i+1:], '\n') + i + 2
+	raw[i] ^= 0x01
+	if _, err := c.Decrypt(encode(raw)); err == nil {
+		t.Error("expected a tampered header to fail")
+	}
+}
+
+//  TestInterop checks secrets decrypt with the age implementation
+//  (filippo.io/age, as used by the age tool) once base64 decoded, and that age
+//  files it writes decrypt once base64 encoded
+func TestInterop(t *testing.T) {
+	id, err := ParseX25519Identity(testIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passphrase := "correct horse battery staple"
+	scryptRecipient, err := fage.NewScryptRecipient(passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scryptRecipient.SetWorkFactor(10)
+
+	scryptIdentity, err := fage.NewScryptIdentity(passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		crypter   *Crypter
+		recipient fage.Recipient
+		identity  fage.Identity
+	}{
+		{
+			name:      "X25519",
+			crypter:   &Crypter{Recipients: []*X25519Recipient{id.Recipient()}, Identities: []*X25519Identity{id}},
+			recipient: id.Recipient(),
+			identity:  id,
+		},
+		{
+			name:      "scrypt",
+			crypter:   &Crypter{Passphrase: []byte(passphrase), WorkFactor: 10},
+			recipient: scryptRecipient,
+			identity:  scryptIdentity,
+		},
+	}
+
+	for _, test := range tests {
+		for _, size := range []int{0, 1, crypto.ChunkSize, 3*crypto.ChunkSize + 1} {
+			text := make([]byte, size)
+			if _, err := rand.Read(text); err != nil {
+				t.Fatal(err)
+			}
+
+			cypher, err := test.crypter.Encrypt(text)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := fage.Decrypt(bytes.NewReader(decode(t, cypher)), test.identity)
+			if err != nil {
+				t.Fatalf("%s, %d bytes: %v", test.name, size, err)
+			}
+
+			res, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("%s, %d bytes: %v", test.name, size, err)
+			}
+
+			if !bytes.Equal(res, text) {
+				t.Errorf("%s, %d bytes: text decrypted by age does not match", test.name, size)
+			}
+
+			buf := new(bytes.Buffer)
+			w, err := fage.Encrypt(buf, test.recipient)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := w.Write(text); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			res, err = test.crypter.Decrypt(encode(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("%s, %d bytes: %v", test.name, size, err)
+			}
+
+			if !bytes.Equal(res, text) {
+				t.Errorf("%s, %d bytes: text encrypted by age does not match", test.name, size)
+			}
+		}
+	}
+}
+
+func decode(t *testing.T, cypher []byte) []byte {
+	raw, err := base64.StdEncoding.DecodeString(string(cypher))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func encode(raw []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(raw))
+}
@@ -0,0 +1,52 @@
+package age
+
+import (
+	"bytes"
+	"encoding/base64"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	"github.com/pkg/errors"
+)
+
+//  prefix is the start of the content, the base64 encoded version line
+var prefix []byte = []byte(base64.StdEncoding.EncodeToString([]byte(intro)))
+
+func init() {
+	crypto.Register(&crypto.Implementation{
+		Name: crypto.Age,
+		New: func(k *crypto.Keys) (crypto.Crypter, error) {
+			if len(k.Recipients) > 0 {
+				recipients, err := ReadRecipients(k.Recipients...)
+				if err != nil {
+					return nil, err
+				}
+				return &Crypter{Recipients: recipients}, nil
+			}
+
+			c := &Crypter{Passphrase: k.Token}
+			if k.KDF != nil {
+				if len(k.KDF.Name) > 0 && k.KDF.Name != crypto.Scrypt {
+					return nil, errors.Errorf("%s does not support the %s KDF", crypto.Age, k.KDF.Name)
+				}
+				c.WorkFactor = k.KDF.Cost
+			}
+
+			if len(k.Identity) > 0 {
+				ids, err := ReadIdentities(k.Identity)
+				if err != nil && len(k.Token) < 1 {
+					return nil, err
+				}
+				c.Identities = ids
+			}
+
+			if len(c.Identities) < 1 && len(c.Passphrase) < 1 {
+				return nil, crypto.ErrNoKeys
+			}
+			return c, nil
+		},
+		Detect: func(content []byte) bool {
+			return bytes.HasPrefix(content, prefix)
+		},
+	})
+}
@@ -0,0 +1,137 @@
+package age
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+
+	fage "filippo.io/age"
+	"github.com/pkg/errors"
+)
+
+const recipientHRP string = "age"
+
+//  X25519Recipient is an age public key, encoded as age1...
+type X25519Recipient = fage.X25519Recipient
+
+//  X25519Identity is an age private key, encoded as AGE-SECRET-KEY-1...
+type X25519Identity = fage.X25519Identity
+
+//  ParseX25519Recipient parses an age1... public key
+func ParseX25519Recipient(s string) (*X25519Recipient, error) {
+	return fage.ParseX25519Recipient(s)
+}
+
+//  ParseX25519Identity parses an AGE-SECRET-KEY-1... private key
+func ParseX25519Identity(s string) (*X25519Identity, error) {
+	return fage.ParseX25519Identity(s)
+}
+
+//  GenerateX25519Identity generates a new random private key
+func GenerateX25519Identity() (*X25519Identity, error) {
+	id, err := fage.GenerateX25519Identity()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to generate private key")
+	}
+	return id, nil
+}
+
+//  ParseIdentities parses the private keys of an age identity file, one per
+//  line, ignoring blank lines and # comments
+func ParseIdentities(r io.Reader) ([]*X25519Identity, error) {
+	ids := make([]*X25519Identity, 0)
+	err := eachLine(r, func(line string) error {
+		id, err := ParseX25519Identity(line)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) < 1 {
+		return nil, errors.New("no identities found")
+	}
+	return ids, nil
+}
+
+//  ParseRecipients parses the public keys of an age recipients file, one per
+//  line, ignoring blank lines and # comments
+func ParseRecipients(r io.Reader) ([]*X25519Recipient, error) {
+	recipients := make([]*X25519Recipient, 0)
+	err := eachLine(r, func(line string) error {
+		rc, err := ParseX25519Recipient(line)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, rc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(recipients) < 1 {
+		return nil, errors.New("no recipients found")
+	}
+	return recipients, nil
+}
+
+//  ReadIdentities reads the private keys from an age identity file
+func ReadIdentities(name string) ([]*X25519Identity, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseIdentities(f)
+}
+
+//  ReadRecipients reads the public keys given either directly (age1...) or as
+//  the name of an age recipients file
+func ReadRecipients(names ...string) ([]*X25519Recipient, error) {
+	recipients := make([]*X25519Recipient, 0)
+	for _, name := range names {
+		if strings.HasPrefix(name, recipientHRP+"1") {
+			r, err := ParseX25519Recipient(name)
+			if err != nil {
+				return nil, err
+			}
+			recipients = append(recipients, r)
+			continue
+		}
+
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := ParseRecipients(f)
+		f.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read recipients file %s", name)
+		}
+		recipients = append(recipients, r...)
+	}
+	return recipients, nil
+}
+
+func eachLine(r io.Reader, fn func(line string) error) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
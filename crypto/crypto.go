@@ -1,22 +1,92 @@
 package crypto
 
 import (
-	"encoding/base64"
+	"bufio"
+	"io"
 
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
 )
 
+//  Algorithms recorded in secrets, selecting the crypter to decrypt with (see
+//  Register). Secrets without one were encrypted with PGP.
+const (
+	PGP     string = "pgp"
+	Age     string = "age"
+	XChaCha string = "xchacha20poly1305"
+	KMS     string = "kms"
+)
+
 type Crypter interface {
 	Encrypt(text []byte) ([]byte, error)
 	Decrypt(cypher []byte) ([]byte, error)
+
+	//  EncryptStream encrypts the text read from src, writing the same cypher
+	//  Encrypt returns to dst, without holding either in memory
+	EncryptStream(dst io.Writer, src io.Reader) error
+
+	//  DecryptStream decrypts the cypher read from src, writing the text to
+	//  dst. Should an error be returned, any text written must be discarded.
+	DecryptStream(dst io.Writer, src io.Reader) error
 }
 
-func NewToken() (string, error) {
-	token := uuid.New().String()
-	if len(token) < 1 {
-		return "", errors.New("UUID produced empty string")
+//  Algorithm returns the algorithm recorded in secrets encrypted by the
+//  crypter, PGP unless the crypter reports otherwise
+func Algorithm(c Crypter) string {
+	if a, ok := c.(interface{ Algorithm() string }); ok {
+		return a.Algorithm()
 	}
+	return PGP
+}
+
+//  Decrypters are the crypters available to decrypt with, by algorithm
+type Decrypters map[string]Crypter
+
+//  For returns the crypter to decrypt secrets recorded with the algorithm
+func (d Decrypters) For(algorithm string) (Crypter, error) {
+	if len(algorithm) < 1 {
+		algorithm = PGP
+	}
+
+	c, ok := d[algorithm]
+	if !ok {
+		return nil, errors.Errorf("no token or keys provided to decrypt %s secrets", algorithm)
+	}
+	return c, nil
+}
 
-	return base64.StdEncoding.EncodeToString([]byte(token)), nil
+//  Decrypt decrypts the content with the crypter for the algorithm detected
+//  from the content (see Detect), falling back to the algorithm recorded
+func (d Decrypters) Decrypt(recorded string, content []byte) ([]byte, error) {
+	algorithm := recorded
+	if detected := Detect(content); len(detected) > 0 {
+		algorithm = detected
+	}
+
+	c, err := d.For(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return c.Decrypt(content)
+}
+
+//  DecryptStream decrypts the content read from src with the crypter for the
+//  algorithm detected from the start of the content (see Detect), falling back
+//  to the algorithm recorded, writing the text to dst
+func (d Decrypters) DecryptStream(recorded string, dst io.Writer, src io.Reader) error {
+	in := bufio.NewReaderSize(src, maxHeaderSize)
+
+	//  the header is all that is needed to detect the algorithm, and fewer
+	//  bytes are returned when the content is shorter
+	start, _ := in.Peek(maxHeaderSize)
+
+	algorithm := recorded
+	if detected := Detect(start); len(detected) > 0 {
+		algorithm = detected
+	}
+
+	c, err := d.For(algorithm)
+	if err != nil {
+		return err
+	}
+	return c.DecryptStream(dst, in)
 }
@@ -0,0 +1,255 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+//  EnvelopeVersion is the version of the envelope format written. Version 1
+//  ciphertext is sealed as a whole, while version 2 ciphertext is sealed in
+//  chunks (see SealStream) so may be streamed.
+const EnvelopeVersion int = 2
+
+//  maxHeaderSize bounds the encoded header read when streaming
+const maxHeaderSize int = 64 * 1024
+
+var b64 *base64.Encoding = base64.RawURLEncoding
+
+//  Envelope is the self describing form of encrypted content, recording the
+//  algorithm and parameters required to decrypt it. It is encoded as three
+//  base64url segments, similar to a JWE:
+//
+//  	<header>.<nonce>.<ciphertext>
+//
+//  where the header is the JSON encoded algorithm, KDF parameters, key ID, and
+//  wrapped key:
+//
+//  	{"v":1,"alg":"xchacha20poly1305","kdf":{"name":"scrypt","salt":"...","cost":15,"r":8,"p":1}}
+//
+//  The encoded header should be authenticated as additional data (see AAD), so
+//  the parameters cannot be altered. The ciphertext of chunked envelopes
+//  follows the nonce (see WriteHeader and ReadEnvelope) so the content may be
+//  streamed. Content encrypted prior to the envelope
+//  (e.g. PGP) is not enveloped, the algorithm being detected instead (see
+//  Detect).
+type Envelope struct {
+	Version   int    `json:"v"`
+	Algorithm string `json:"alg"`
+	KDF       *KDF   `json:"kdf,omitempty"`
+
+	//  KeyID identifies the key the content is encrypted with, if any
+	KeyID string `json:"kid,omitempty"`
+
+	//  WrappedKey is the key the content is encrypted with, itself encrypted
+	//  with the key identified by the KeyID, if any
+	WrappedKey []byte `json:"wk,omitempty"`
+
+	Nonce      []byte `json:"-"`
+	Ciphertext []byte `json:"-"`
+
+	//  header is the encoded header as parsed, or once first encoded
+	header []byte
+}
+
+//  KDF are the parameters of the key derivation function deriving the key from
+//  a token or passphrase
+type KDF struct {
+	Name string `json:"name"`
+	Salt []byte `json:"salt,omitempty"`
+
+	//  Cost is the log2 of the work factor, e.g. N for scrypt
+	Cost int `json:"cost,omitempty"`
+
+	BlockSize   int `json:"r,omitempty"`
+	Parallelism int `json:"p,omitempty"`
+
+	//  Time and Memory (in KiB) are the passes and memory of argon2id
+	Time   int `json:"t,omitempty"`
+	Memory int `json:"m,omitempty"`
+}
+
+//  NewEnvelope returns an envelope for the algorithm at the current version
+func NewEnvelope(algorithm string) *Envelope {
+	return &Envelope{Version: EnvelopeVersion, Algorithm: algorithm}
+}
+
+//  Chunked reports if the ciphertext is sealed in chunks (see ChunkNonce)
+//  rather than as a whole
+func (e *Envelope) Chunked() bool {
+	return e.Version >= 2
+}
+
+//  ChunkNonce returns the nonce of a chunk of the ciphertext, the envelope
+//  nonce with the big endian counter XORed into the 8 bytes preceding the
+//  final byte, and the final byte XORed with 1 for the final chunk
+func (e *Envelope) ChunkNonce(counter uint64, last bool) []byte {
+	nonce := append([]byte(nil), e.Nonce...)
+
+	var c [8]byte
+	binary.BigEndian.PutUint64(c[:], counter)
+	for i := range c {
+		nonce[len(nonce)-9+i] ^= c[i]
+	}
+
+	if last {
+		nonce[len(nonce)-1] ^= 1
+	}
+	return nonce
+}
+
+//  AAD returns the encoded header, to be authenticated along with the
+//  ciphertext. The header must not be changed once called.
+func (e *Envelope) AAD() ([]byte, error) {
+	if e.header != nil {
+		return e.header, nil
+	}
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to encode envelope header")
+	}
+
+	e.header = make([]byte, b64.EncodedLen(len(raw)))
+	b64.Encode(e.header, raw)
+	return e.header, nil
+}
+
+//  Marshal returns the encoded envelope
+func (e *Envelope) Marshal() ([]byte, error) {
+	header, err := e.AAD()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(header)+b64.EncodedLen(len(e.Nonce))+b64.EncodedLen(len(e.Ciphertext))+2)
+	out = append(out, header...)
+	out = append(out, '.')
+	out = append(out, b64.EncodeToString(e.Nonce)...)
+	out = append(out, '.')
+	out = append(out, b64.EncodeToString(e.Ciphertext)...)
+	return out, nil
+}
+
+//  WriteHeader writes the encoded header and nonce of the envelope, returning
+//  the writer of the ciphertext which encodes it to w. The ciphertext writer
+//  must be closed once written.
+func (e *Envelope) WriteHeader(w io.Writer) (io.WriteCloser, error) {
+	header, err := e.AAD()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(header)+b64.EncodedLen(len(e.Nonce))+2)
+	out = append(out, header...)
+	out = append(out, '.')
+	out = append(out, b64.EncodeToString(e.Nonce)...)
+	out = append(out, '.')
+
+	if _, err := w.Write(out); err != nil {
+		return nil, err
+	}
+	return base64.NewEncoder(b64, w), nil
+}
+
+//  ParseEnvelope parses the encoded envelope
+func ParseEnvelope(content []byte) (*Envelope, error) {
+	parts := bytes.Split(content, []byte("."))
+	if len(parts) != 3 {
+		return nil, errors.New("content is not an envelope")
+	}
+
+	e, err := parseHeader(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Nonce, err = b64.DecodeString(string(parts[1])); err != nil {
+		return nil, errors.Wrap(err, "malformed envelope nonce")
+	}
+
+	if e.Ciphertext, err = b64.DecodeString(string(parts[2])); err != nil {
+		return nil, errors.Wrap(err, "malformed envelope ciphertext")
+	}
+
+	return e, nil
+}
+
+//  ReadEnvelope reads the encoded header and nonce of the envelope, returning
+//  the reader of the ciphertext which follows, decoded
+func ReadEnvelope(r io.Reader) (*Envelope, io.Reader, error) {
+	in := bufio.NewReader(r)
+
+	header, err := readSegment(in)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "content is not an envelope")
+	}
+
+	e, err := parseHeader(header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce, err := readSegment(in)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "content is not an envelope")
+	}
+
+	if e.Nonce, err = b64.DecodeString(string(nonce)); err != nil {
+		return nil, nil, errors.Wrap(err, "malformed envelope nonce")
+	}
+
+	return e, base64.NewDecoder(b64, in), nil
+}
+
+//  readSegment reads up to and excluding the next '.', no more than
+//  maxHeaderSize
+func readSegment(in *bufio.Reader) ([]byte, error) {
+	segment := make([]byte, 0)
+	for len(segment) <= maxHeaderSize {
+		b, err := in.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+
+		if b == '.' {
+			return segment, nil
+		}
+		segment = append(segment, b)
+	}
+	return nil, errors.New("envelope header is too large")
+}
+
+//  parseHeader parses the encoded header, which is retained to be
+//  authenticated as parsed
+func parseHeader(header []byte) (*Envelope, error) {
+	raw := make([]byte, b64.DecodedLen(len(header)))
+	n, err := b64.Decode(raw, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "malformed envelope header")
+	}
+
+	e := &Envelope{}
+	if err := json.Unmarshal(raw[:n], e); err != nil {
+		return nil, errors.Wrap(err, "malformed envelope header")
+	}
+
+	if e.Version < 1 || e.Version > EnvelopeVersion {
+		return nil, errors.Errorf("envelope version %d is not supported", e.Version)
+	}
+
+	if len(e.Algorithm) < 1 {
+		return nil, errors.New("envelope does not specify the algorithm")
+	}
+
+	e.header = header
+	return e, nil
+}
@@ -0,0 +1,73 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEnvelope(t *testing.T) {
+	e := NewEnvelope("test")
+	e.KDF = &KDF{Name: "scrypt", Salt: []byte("salt"), Cost: 10, BlockSize: 8, Parallelism: 1}
+	e.KeyID = "key-1"
+	e.Nonce = []byte("nonce")
+	e.Ciphertext = []byte("ciphertext")
+
+	aad, err := e.AAD()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseEnvelope(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Algorithm != "test" || got.KeyID != "key-1" || got.KDF == nil || got.KDF.Cost != 10 || !bytes.Equal(got.KDF.Salt, []byte("salt")) {
+		t.Errorf("unexpected header %+v", got)
+	}
+
+	if !bytes.Equal(got.Nonce, e.Nonce) || !bytes.Equal(got.Ciphertext, e.Ciphertext) {
+		t.Errorf("unexpected nonce %q or ciphertext %q", got.Nonce, got.Ciphertext)
+	}
+
+	//  the header is authenticated as parsed, not as re-encoded
+	gotAAD, err := got.AAD()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(aad, gotAAD) {
+		t.Errorf("want AAD %s\ngot  %s", aad, gotAAD)
+	}
+
+	if alg := Detect(raw); alg != "test" {
+		t.Errorf("want algorithm test detected, got %q", alg)
+	}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	tests := map[string]string{
+		"legacy":       "LS0tLS1CRUdJTiBQR1AgTUVTU0FHRS0tLS0t",
+		"plaintext":    "notSuperS3cret",
+		"segments":     "a.b",
+		"header":       "!!!.AA.AA",
+		"version":      "eyJ2IjozLCJhbGciOiJ0ZXN0In0.AA.AA",
+		"no algorithm": "eyJ2IjoxfQ.AA.AA",
+		"nonce":        "eyJ2IjoxLCJhbGciOiJ0ZXN0In0.!!.AA",
+	}
+
+	for name, content := range tests {
+		if _, err := ParseEnvelope([]byte(content)); err == nil {
+			t.Errorf("%s: expected %q to be rejected", name, content)
+		}
+	}
+
+	if _, err := ParseEnvelope([]byte("eyJ2IjoxLCJhbGciOiJ0ZXN0In0..")); err != nil {
+		t.Errorf("expected an empty nonce and ciphertext to be accepted, got %v", err)
+	}
+}
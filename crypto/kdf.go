@@ -0,0 +1,78 @@
+package crypto
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//  KDFs deriving keys from tokens
+const (
+	Scrypt   string = "scrypt"
+	Argon2id string = "argon2id"
+	S2K      string = "s2k"
+)
+
+//  KDFParams tune the derivation of the key from the token when encrypting,
+//  the algorithm's default being used for any unset. The parameters used are
+//  recorded with the content, so none are needed to decrypt.
+type KDFParams struct {
+	//  Name selects the KDF for algorithms supporting more than one, e.g.
+	//  scrypt or argon2id for xchacha20poly1305
+	Name string
+
+	//  Cost is the log2 of the work factor, the N of scrypt (also for age) or
+	//  the iteration count of the PGP S2K
+	Cost int
+
+	//  Time, Memory (in KiB), and Parallelism are the argon2id parameters
+	Time        int
+	Memory      int
+	Parallelism int
+}
+
+//  ParseKDF parses the KDF parameters from a spec of the KDF name and / or
+//  comma separated parameters, cost, t (time), m (memory in KiB), and p
+//  (parallelism), e.g.
+//
+//  	scrypt,cost=17
+//  	argon2id,t=3,m=65536,p=4
+//  	cost=20
+func ParseKDF(spec string) (*KDFParams, error) {
+	params := &KDFParams{}
+	for i, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+
+		eq := strings.IndexByte(field, '=')
+		if eq < 0 {
+			if i > 0 || len(field) < 1 {
+				return nil, errors.Errorf("KDF parameter %q must be <name>=<value>", field)
+			}
+			params.Name = field
+			continue
+		}
+
+		name, value := field[:eq], field[eq+1:]
+
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return nil, errors.Errorf("KDF parameter %s must be a positive integer", name)
+		}
+
+		switch name {
+		case "cost":
+			params.Cost = n
+		case "t":
+			params.Time = n
+		case "m":
+			params.Memory = n
+		case "p":
+			params.Parallelism = n
+		default:
+			return nil, errors.Errorf("unknown KDF parameter %q, must be cost, t, m, or p", name)
+		}
+	}
+
+	return params, nil
+}
@@ -0,0 +1,35 @@
+package crypto
+
+import (
+	"testing"
+)
+
+func TestParseKDF(t *testing.T) {
+	tests := []struct {
+		spec  string
+		want  KDFParams
+		valid bool
+	}{
+		{spec: "scrypt", want: KDFParams{Name: Scrypt}, valid: true},
+		{spec: "scrypt,cost=17", want: KDFParams{Name: Scrypt, Cost: 17}, valid: true},
+		{spec: "argon2id, t=3, m=65536, p=4", want: KDFParams{Name: Argon2id, Time: 3, Memory: 65536, Parallelism: 4}, valid: true},
+		{spec: "cost=20", want: KDFParams{Cost: 20}, valid: true},
+		{spec: ""},
+		{spec: "cost=20,scrypt"},
+		{spec: "scrypt,cost=high"},
+		{spec: "scrypt,cost=-1"},
+		{spec: "scrypt,r=8"},
+	}
+
+	for _, tc := range tests {
+		got, err := ParseKDF(tc.spec)
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("%q: want valid %t, got %v", tc.spec, tc.valid, err)
+			continue
+		}
+
+		if tc.valid && *got != tc.want {
+			t.Errorf("%q:\nwant %+v\ngot  %+v\n", tc.spec, tc.want, *got)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package kms
+
+import (
+	"context"
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	Register("file", func(location string) (Provider, error) {
+		return LoadFile(location)
+	})
+}
+
+//  File is a local provider wrapping data keys with AES-256-GCM under keys
+//  read from a key file (see Keyring), the same format as the datastore master
+//  key file. Data keys are wrapped with the active key, retired keys being kept
+//  to unwrap data keys wrapped prior to a rotation.
+type File struct {
+	keys *Keyring
+}
+
+//  LoadFile reads in and parses the key file
+func LoadFile(name string) (*File, error) {
+	kr, err := LoadKeyring(name)
+	if err != nil {
+		return nil, err
+	}
+	return &File{keys: kr}, nil
+}
+
+//  NewFile creates a provider from the keys, wrapping with the key for the
+//  active ID
+func NewFile(active string, keys map[string][]byte) (*File, error) {
+	kr, err := NewKeyring(active, keys)
+	if err != nil {
+		return nil, err
+	}
+	return &File{keys: kr}, nil
+}
+
+//  Wrap seals the data key with the active key, the nonce prefixing the result
+//  and the key ID authenticated as additional data
+func (f *File) Wrap(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	active := f.keys.Active()
+	gcm, _ := f.keys.Key(active)
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, errors.Wrap(err, "unable to generate nonce")
+	}
+
+	return active, gcm.Seal(nonce, nonce, dataKey, []byte(active)), nil
+}
+
+func (f *File) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	gcm, ok := f.keys.Key(keyID)
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownKey, "key %s", keyID)
+	}
+
+	if len(wrapped) < gcm.NonceSize() {
+		return nil, errors.New("wrapped data key is too short")
+	}
+
+	dataKey, err := gcm.Open(nil, wrapped[:gcm.NonceSize()], wrapped[gcm.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to unwrap data key with key %s", keyID)
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,117 @@
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//  KeySize is the required size (in bytes) of a key file key, selecting
+//  AES-256
+const KeySize int = 32
+
+//  Keyring holds AES-256-GCM keys by key ID, along with the ID of the active
+//  key used for sealing. Keys no longer active are retained for opening what
+//  was sealed prior to a rotation. The file provider and the encrypted
+//  datastore (as its master keys) both read their keys into a keyring.
+type Keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+//  keyFile is the format of the key file, e.g.:
+//
+//  	{
+//  	  "active": "2019-02",
+//  	  "keys": {
+//  	    "2019-01": "<base64 encoded 32 byte key>",
+//  	    "2019-02": "<base64 encoded 32 byte key>"
+//  	  }
+//  	}
+type keyFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+//  LoadKeyring reads in and parses the key file
+func LoadKeyring(name string) (*Keyring, error) {
+	raw, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read in key file")
+	}
+
+	return ParseKeyring(raw)
+}
+
+//  ParseKeyring parses the raw key file content
+func ParseKeyring(raw []byte) (*Keyring, error) {
+	kf := &keyFile{}
+	if err := json.Unmarshal(raw, &kf); err != nil {
+		return nil, errors.Wrap(err, "unable to parse key file")
+	}
+
+	keys := make(map[string][]byte)
+	for id, k := range kf.Keys {
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to decode key %s", id)
+		}
+		keys[id] = key
+	}
+
+	return NewKeyring(kf.Active, keys)
+}
+
+//  NewKeyring creates a keyring from the provided keys, using the key for the
+//  active ID to seal. Key IDs may not contain ':' since they prefix the values
+//  sealed by the encrypted datastore, delimited by a ':'.
+func NewKeyring(active string, keys map[string][]byte) (*Keyring, error) {
+	kr := &Keyring{
+		active: active,
+		keys:   make(map[string]cipher.AEAD),
+	}
+
+	for id, key := range keys {
+		if len(id) < 1 || len(id) > 255 || strings.Contains(id, ":") {
+			return nil, errors.Errorf("key ID %q must be 1 - 255 characters and not contain ':'", id)
+		}
+
+		if len(key) != KeySize {
+			return nil, errors.Errorf("key %s must be %d bytes", id, KeySize)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create cipher for key %s", id)
+		}
+
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create GCM for key %s", id)
+		}
+
+		kr.keys[id] = gcm
+	}
+
+	if _, ok := kr.keys[active]; !ok {
+		return nil, errors.Errorf("active key %q does not exist", active)
+	}
+
+	return kr, nil
+}
+
+//  Active returns the ID of the key used for sealing
+func (kr *Keyring) Active() string {
+	return kr.active
+}
+
+//  Key returns the AEAD of the key for the ID, or false if not in the keyring
+func (kr *Keyring) Key(id string) (cipher.AEAD, bool) {
+	gcm, ok := kr.keys[id]
+	return gcm, ok
+}
@@ -0,0 +1,231 @@
+package kms
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+//  DataKeySize is the size (in bytes) of the random key each secret is
+//  encrypted with
+const DataKeySize int = chacha20poly1305.KeySize
+
+//  ErrUnknownKey is returned when a data key was wrapped with a key the
+//  provider does not have (e.g. a retired key was removed)
+var ErrUnknownKey = errors.New("data key wrapped with unknown key")
+
+//  Provider wraps (encrypts) and unwraps the data keys with keys it manages,
+//  e.g. a local key file, Vault Transit, or a cloud KMS. The keys themselves
+//  need never leave the provider.
+type Provider interface {
+	//  Wrap wraps the data key with the current key, returning the ID of the
+	//  key used
+	Wrap(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+
+	//  Unwrap unwraps the data key wrapped with the key
+	Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+//  Opener returns the provider at the location, the remainder of the provider
+//  URI following the scheme
+type Opener func(location string) (Provider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = make(map[string]Opener)
+)
+
+//  Register makes the provider available by the URI scheme (see Open). It
+//  panics if the scheme is already registered.
+func Register(scheme string, open Opener) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if _, ok := providers[scheme]; ok {
+		panic("kms: provider " + scheme + " registered twice")
+	}
+	providers[scheme] = open
+}
+
+//  Open returns the provider for the URI, <scheme>:<location>, e.g.
+//  file:/etc/sparkles/kms.json
+func Open(uri string) (Provider, error) {
+	scheme, location := split(uri)
+
+	providersMu.RLock()
+	open, ok := providers[scheme]
+	providersMu.RUnlock()
+
+	if !ok {
+		return nil, errors.Errorf("unknown key-management provider %q", scheme)
+	}
+
+	p, err := open(location)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open %s key-management provider", scheme)
+	}
+	return p, nil
+}
+
+func split(uri string) (string, string) {
+	i := strings.IndexByte(uri, ':')
+	if i < 0 {
+		return uri, ""
+	}
+	return uri[:i], uri[i+1:]
+}
+
+func init() {
+	crypto.Register(&crypto.Implementation{
+		Name: crypto.KMS,
+		New: func(k *crypto.Keys) (crypto.Crypter, error) {
+			if len(k.KMS) < 1 {
+				return nil, crypto.ErrNoKeys
+			}
+
+			p, err := Open(k.KMS)
+			if err != nil {
+				return nil, err
+			}
+
+			scheme, _ := split(k.KMS)
+			return &Crypter{Provider: p, Scheme: scheme}, nil
+		},
+	})
+}
+
+//  Crypter encrypts each secret with a random data key using
+//  XChaCha20-Poly1305, the data key being wrapped by the provider. The output
+//  is an envelope (see crypto.Envelope) with the wrapped data key and the ID of
+//  the key wrapping it, as <scheme>:<key ID>.
+//
+//  Unlike a token, the data key can always be recovered by those with access
+//  to the provider's keys.
+type Crypter struct {
+	Provider Provider
+
+	//  Scheme identifies the provider in the key ID recorded
+	Scheme string
+}
+
+//  Algorithm returns the algorithm recorded in secrets encrypted by the crypter
+func (c *Crypter) Algorithm() string {
+	return crypto.KMS
+}
+
+func (c *Crypter) Encrypt(text []byte) ([]byte, error) {
+	return crypto.Encrypt(c, text)
+}
+
+func (c *Crypter) Decrypt(cypher []byte) ([]byte, error) {
+	return crypto.Decrypt(c, cypher)
+}
+
+//  EncryptStream encrypts the text in chunks (see crypto.SealStream) with a
+//  new data key
+func (c *Crypter) EncryptStream(dst io.Writer, src io.Reader) error {
+	dataKey := make([]byte, DataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return errors.Wrap(err, "unable to generate data key")
+	}
+
+	id, wrapped, err := c.Provider.Wrap(context.Background(), dataKey)
+	if err != nil {
+		return errors.Wrap(err, "unable to wrap data key")
+	}
+
+	e := crypto.NewEnvelope(crypto.KMS)
+	e.KeyID = c.Scheme + ":" + id
+	e.WrappedKey = wrapped
+
+	e.Nonce = make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return errors.Wrap(err, "unable to generate nonce")
+	}
+
+	aead, err := chacha20poly1305.NewX(dataKey)
+	if err != nil {
+		return err
+	}
+
+	aad, err := e.AAD()
+	if err != nil {
+		return err
+	}
+
+	w, err := e.WriteHeader(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := crypto.SealStream(w, src, aead, e.ChunkNonce, aad); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+//  DecryptStream unwraps the data key of the envelope, streaming chunked
+//  ciphertext
+func (c *Crypter) DecryptStream(dst io.Writer, src io.Reader) error {
+	e, ciphertext, err := crypto.ReadEnvelope(src)
+	if err != nil {
+		return err
+	}
+
+	if e.Algorithm != crypto.KMS {
+		return errors.Errorf("content is encrypted with %s", e.Algorithm)
+	}
+
+	scheme, id := split(e.KeyID)
+	if scheme != c.Scheme {
+		return errors.Errorf("data key is wrapped by the %s provider rather than %s", scheme, c.Scheme)
+	}
+
+	if len(e.Nonce) != chacha20poly1305.NonceSizeX {
+		return errors.New("malformed nonce")
+	}
+
+	dataKey, err := c.Provider.Unwrap(context.Background(), id, e.WrappedKey)
+	if err != nil {
+		return errors.Wrap(err, "unable to unwrap data key")
+	}
+
+	aead, err := chacha20poly1305.NewX(dataKey)
+	if err != nil {
+		return err
+	}
+
+	aad, err := e.AAD()
+	if err != nil {
+		return err
+	}
+
+	if e.Chunked() {
+		if err := crypto.OpenStream(dst, ciphertext, aead, e.ChunkNonce, aad); err != nil {
+			return errors.Wrap(err, "unable to decrypt content")
+		}
+		return nil
+	}
+
+	//  ciphertext sealed as a whole is read in whole
+	sealed, err := ioutil.ReadAll(ciphertext)
+	if err != nil {
+		return errors.Wrap(err, "malformed envelope ciphertext")
+	}
+
+	text, err := aead.Open(nil, e.Nonce, sealed, aad)
+	if err != nil {
+		return errors.Wrap(err, "unable to decrypt content")
+	}
+
+	_, err = dst.Write(text)
+	return err
+}
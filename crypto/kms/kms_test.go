@@ -0,0 +1,155 @@
+package kms
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	"github.com/pkg/errors"
+)
+
+func key(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestCrypter(t *testing.T) {
+	text := []byte("I'm going to build my own theme park!")
+
+	old, err := NewFile("2019-01", map[string][]byte{"2019-01": key(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Crypter{Provider: old, Scheme: "file"}
+	cypher, err := c.Encrypt(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alg := crypto.Detect(cypher); alg != crypto.KMS {
+		t.Errorf("want %s detected, got %q", crypto.KMS, alg)
+	}
+
+	e, err := crypto.ParseEnvelope(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "file:2019-01", e.KeyID; want != got {
+		t.Errorf("want key ID %s, got %s", want, got)
+	}
+
+	//  after a rotation, data keys wrapped with the retired key still unwrap
+	rotated, err := NewFile("2019-02", map[string][]byte{"2019-01": key(1), "2019-02": key(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := (&Crypter{Provider: rotated, Scheme: "file"}).Decrypt(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, text) {
+		t.Errorf("want %q, got %q", text, res)
+	}
+
+	retired, err := NewFile("2019-02", map[string][]byte{"2019-02": key(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&Crypter{Provider: retired, Scheme: "file"}).Decrypt(cypher); errors.Cause(err) != ErrUnknownKey {
+		t.Errorf("want ErrUnknownKey, got %v", err)
+	}
+
+	if _, err := (&Crypter{Provider: old, Scheme: "vault"}).Decrypt(cypher); err == nil {
+		t.Error("expected a different provider to be rejected")
+	}
+
+	//  the wrapped key is authenticated with the content
+	e2 := crypto.NewEnvelope(e.Algorithm)
+	e2.KeyID, e2.WrappedKey, e2.Nonce, e2.Ciphertext = e.KeyID, e.WrappedKey, e.Nonce, e.Ciphertext
+	e2.WrappedKey[len(e2.WrappedKey)-1] ^= 0x01
+
+	tampered, err := e2.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Decrypt(tampered); err == nil {
+		t.Error("expected a tampered wrapped key to fail")
+	}
+}
+
+func TestOpen(t *testing.T) {
+	f, err := ioutil.TempFile("", "kms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	fmt.Fprintf(f, `{"active":"k1","keys":{"k1":"%s"}}`, base64.StdEncoding.EncodeToString(key(3)))
+	f.Close()
+
+	c, err := crypto.New(crypto.KMS, &crypto.Keys{KMS: "file:" + f.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cypher, err := c.Encrypt([]byte("text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := crypto.NewDecrypters(&crypto.Keys{KMS: "file:" + f.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := d.Decrypt("", cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res) != "text" {
+		t.Errorf("want text, got %q", res)
+	}
+
+	if _, err := crypto.New(crypto.KMS, &crypto.Keys{}); err != crypto.ErrNoKeys {
+		t.Errorf("want ErrNoKeys, got %v", err)
+	}
+
+	if _, err := Open("vault:transit/sparkles"); err == nil {
+		t.Error("expected an unregistered provider to be rejected")
+	}
+
+	if _, err := NewFile("missing", map[string][]byte{"k1": key(1)}); err == nil {
+		t.Error("expected a missing active key to be rejected")
+	}
+
+	if _, err := NewFile("k1", map[string][]byte{"k1": key(1)[:16]}); err == nil {
+		t.Error("expected a short key to be rejected")
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	samples := map[string]bool{
+		`{"active":"k1","keys":{"k1":"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}}`:   true,
+		`{"active":"k2","keys":{"k1":"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}}`:   false,
+		`{"active":"k1","keys":{"k1":"c2hvcnQ="}}`:                                       false,
+		`{"active":"k:1","keys":{"k:1":"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="}}`: false,
+		`{"active":"k1","keys":{"k1":"not base64"}}`:                                     false,
+	}
+
+	for raw, valid := range samples {
+		if _, err := ParseKeyring([]byte(raw)); (err == nil) != valid {
+			t.Errorf("want valid %t for %s, got error %v", valid, raw, err)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+//  +build integration
+
+package pkcs11
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/pkg/errors"
+)
+
+const (
+	token string = "sparkles"
+	pin   string = "5678"
+)
+
+//  softhsm initializes a SoftHSM token in a temporary directory, returning the
+//  module path, overridden with SOFTHSM2_MODULE
+func softhsm(t *testing.T) (string, func()) {
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if len(module) < 1 {
+		module = "/usr/lib/softhsm/libsofthsm2.so"
+	}
+
+	if _, err := os.Stat(module); err != nil {
+		t.Skipf("SoftHSM module %s is not available", module)
+	}
+
+	dir, err := ioutil.TempDir("", "softhsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := ioutil.WriteFile(conf, []byte(fmt.Sprintf("directories.tokendir = %s\n", dir)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("SOFTHSM2_CONF", conf)
+
+	out, err := exec.Command("softhsm2-util", "--init-token", "--free", "--label", token, "--so-pin", "1234", "--pin", pin).CombinedOutput()
+	if err != nil {
+		t.Fatalf("unable to initialize token: %s", out)
+	}
+
+	return module, func() { os.RemoveAll(dir) }
+}
+
+//  generate generates an RSA key pair in the token with the label
+func generate(t *testing.T, module, label string) {
+	p, err := Open(&Config{ModulePath: module, Token: token, Object: label, PINValue: pin})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.(*Provider).session(func(sh p11.SessionHandle) error {
+		pub := []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_LABEL, label),
+			p11.NewAttribute(p11.CKA_ENCRYPT, true),
+			p11.NewAttribute(p11.CKA_MODULUS_BITS, 2048),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, []byte{1, 0, 1}),
+		}
+		priv := []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_LABEL, label),
+			p11.NewAttribute(p11.CKA_PRIVATE, true),
+			p11.NewAttribute(p11.CKA_SENSITIVE, true),
+			p11.NewAttribute(p11.CKA_EXTRACTABLE, false),
+			p11.NewAttribute(p11.CKA_DECRYPT, true),
+		}
+
+		mech := []*p11.Mechanism{p11.NewMechanism(p11.CKM_RSA_PKCS_KEY_PAIR_GEN, nil)}
+		_, _, err := p.(*Provider).module.GenerateKeyPair(sh, mech, pub, priv)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider(t *testing.T) {
+	module, cleanup := softhsm(t)
+	defer cleanup()
+
+	generate(t, module, "kek")
+	generate(t, module, "other")
+
+	os.Setenv("SPARKLES_TEST_PIN", pin)
+	defer os.Unsetenv("SPARKLES_TEST_PIN")
+
+	uri := fmt.Sprintf("%s:token=%s;object=kek?module-path=%s&pin-source=env:SPARKLES_TEST_PIN", Scheme, token, module)
+	c, err := crypto.New(crypto.KMS, &crypto.Keys{KMS: uri})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := []byte("I'm going to build my own theme park!")
+	cypher, err := c.Encrypt(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := crypto.ParseEnvelope(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := Scheme+":kek", e.KeyID; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	//	the key ID recorded selects the key pair, whichever object is
+	//	configured
+	other, err := kms.Open(fmt.Sprintf("%s:object=other?module-path=%s&pin-value=%s", Scheme, module, pin))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txt, err := (&kms.Crypter{Provider: other, Scheme: Scheme}).Decrypt(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := string(text), string(txt); want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	wrong, err := kms.Open(fmt.Sprintf("%s:object=kek?module-path=%s&pin-value=0000", Scheme, module))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (&kms.Crypter{Provider: wrong, Scheme: Scheme}).Decrypt(cypher); err == nil {
+		t.Error("want an error decrypting with the wrong PIN")
+	}
+
+	if _, err := other.Unwrap(context.Background(), "missing", e.WrappedKey); errors.Cause(err) != kms.ErrUnknownKey {
+		t.Errorf("want ErrUnknownKey, got %v", err)
+	}
+}
@@ -0,0 +1,14 @@
+//  +build !cgo
+
+package pkcs11
+
+import (
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+
+	"github.com/pkg/errors"
+)
+
+//  Open is unavailable as PKCS #11 modules are loaded with cgo
+func Open(c *Config) (kms.Provider, error) {
+	return nil, errors.New("PKCS #11 support requires building with cgo")
+}
@@ -0,0 +1,217 @@
+//  +build cgo
+
+package pkcs11
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"math/big"
+	"sync"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+
+	p11 "github.com/miekg/pkcs11"
+	"github.com/pkg/errors"
+)
+
+//  Provider wraps data keys with the public key of an RSA key pair held in a
+//  PKCS #11 token (e.g. an HSM or smartcard) using RSA-OAEP, unwrapping them
+//  with the private key within the token, so the private key never leaves it.
+//
+//  OAEP uses SHA-1 (with MGF1-SHA1), being the only hash widely supported by
+//  tokens for OAEP, SoftHSM included.
+type Provider struct {
+	config *Config
+	module *p11.Ctx
+}
+
+var (
+	modulesMu sync.Mutex
+	modules   = make(map[string]*p11.Ctx)
+)
+
+//  load loads and initializes the module, once per process as modules may
+//  only be initialized once
+func load(path string) (*p11.Ctx, error) {
+	modulesMu.Lock()
+	defer modulesMu.Unlock()
+
+	if module, ok := modules[path]; ok {
+		return module, nil
+	}
+
+	module := p11.New(path)
+	if module == nil {
+		return nil, errors.Errorf("unable to load PKCS #11 module %s", path)
+	}
+
+	if err := module.Initialize(); err != nil && err != p11.Error(p11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		module.Destroy()
+		return nil, errors.Wrapf(err, "unable to initialize PKCS #11 module %s", path)
+	}
+
+	modules[path] = module
+	return module, nil
+}
+
+//  Open loads the module of the token, the token itself only being accessed
+//  as data keys are wrapped and unwrapped
+func Open(c *Config) (kms.Provider, error) {
+	module, err := load(c.ModulePath)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{config: c, module: module}, nil
+}
+
+//  slot returns the slot of the token, by ID, label or else the first slot
+//  with a token present
+func (p *Provider) slot() (uint, error) {
+	if p.config.HasSlot {
+		return p.config.Slot, nil
+	}
+
+	slots, err := p.module.GetSlotList(true)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to list slots")
+	}
+
+	for _, slot := range slots {
+		if len(p.config.Token) < 1 {
+			return slot, nil
+		}
+
+		info, err := p.module.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+
+		if info.Label == p.config.Token {
+			return slot, nil
+		}
+	}
+
+	if len(p.config.Token) < 1 {
+		return 0, errors.New("no token present")
+	}
+	return 0, errors.Errorf("token %q is not present", p.config.Token)
+}
+
+//  session calls fn with a session on the token, logged in as the user if
+//  there's a PIN
+func (p *Provider) session(fn func(p11.SessionHandle) error) error {
+	slot, err := p.slot()
+	if err != nil {
+		return err
+	}
+
+	sh, err := p.module.OpenSession(slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return errors.Wrap(err, "unable to open session")
+	}
+	defer p.module.CloseSession(sh)
+
+	pin, err := p.config.PIN()
+	if err != nil {
+		return err
+	}
+
+	if len(pin) > 0 {
+		if err := p.module.Login(sh, p11.CKU_USER, pin); err != nil && err != p11.Error(p11.CKR_USER_ALREADY_LOGGED_IN) {
+			return errors.Wrap(err, "unable to log in to token")
+		}
+		defer p.module.Logout(sh)
+	}
+
+	return fn(sh)
+}
+
+//  find returns the key of the class with the label, which must be unique
+func (p *Provider) find(sh p11.SessionHandle, class uint, label string) (p11.ObjectHandle, error) {
+	template := []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_CLASS, class),
+		p11.NewAttribute(p11.CKA_LABEL, label),
+	}
+
+	if err := p.module.FindObjectsInit(sh, template); err != nil {
+		return 0, errors.Wrap(err, "unable to search for key")
+	}
+
+	objects, _, err := p.module.FindObjects(sh, 2)
+	p.module.FindObjectsFinal(sh)
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to search for key")
+	}
+
+	switch len(objects) {
+	case 0:
+		return 0, errors.Wrapf(kms.ErrUnknownKey, "key %s", label)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, errors.Errorf("more than one key labelled %s", label)
+	}
+}
+
+//  Wrap encrypts the data key with the public key in software, the key ID
+//  being the label of the key pair
+func (p *Provider) Wrap(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	var pub *rsa.PublicKey
+	err := p.session(func(sh p11.SessionHandle) error {
+		key, err := p.find(sh, p11.CKO_PUBLIC_KEY, p.config.Object)
+		if err != nil {
+			return err
+		}
+
+		attrs, err := p.module.GetAttributeValue(sh, key, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_MODULUS, nil),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil || len(attrs) != 2 {
+			return errors.Errorf("key %s is not an RSA public key", p.config.Object)
+		}
+
+		pub = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(attrs[0].Value),
+			E: int(new(big.Int).SetBytes(attrs[1].Value).Int64()),
+		}
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, dataKey, nil)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "unable to encrypt data key")
+	}
+	return p.config.Object, wrapped, nil
+}
+
+//  Unwrap decrypts the data key with the private key within the token
+func (p *Provider) Unwrap(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	var dataKey []byte
+	err := p.session(func(sh p11.SessionHandle) error {
+		key, err := p.find(sh, p11.CKO_PRIVATE_KEY, keyID)
+		if err != nil {
+			return err
+		}
+
+		params := p11.NewOAEPParams(p11.CKM_SHA_1, p11.CKG_MGF1_SHA1, p11.CKZ_DATA_SPECIFIED, nil)
+		if err := p.module.DecryptInit(sh, []*p11.Mechanism{p11.NewMechanism(p11.CKM_RSA_PKCS_OAEP, params)}, key); err != nil {
+			return errors.Wrap(err, "unable to decrypt data key")
+		}
+
+		dataKey, err = p.module.Decrypt(sh, wrapped)
+		if err != nil {
+			return errors.Wrap(err, "unable to decrypt data key")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dataKey, nil
+}
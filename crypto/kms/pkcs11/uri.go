@@ -0,0 +1,165 @@
+package pkcs11
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/kms"
+
+	"github.com/pkg/errors"
+)
+
+//  Scheme is the key-management URI scheme of the provider, the location being
+//  the remainder of a PKCS #11 URI (RFC 7512), e.g.
+//
+//  	pkcs11:token=sparkles;object=sparkles-kek?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=file:/etc/sparkles/pin
+const Scheme string = "pkcs11"
+
+func init() {
+	kms.Register(Scheme, func(location string) (kms.Provider, error) {
+		config, err := ParseConfig(location)
+		if err != nil {
+			return nil, err
+		}
+		return Open(config)
+	})
+}
+
+//  Config is the PKCS #11 module, token and key pair a provider uses
+type Config struct {
+	//  ModulePath is the PKCS #11 module (shared library) of the token
+	ModulePath string
+
+	//  Slot is the ID of the slot the token is in, only used if HasSlot
+	Slot    uint
+	HasSlot bool
+
+	//  Token is the label of the token, the first token found being used if
+	//  neither it nor the slot are set
+	Token string
+
+	//  Object is the label of the RSA key pair wrapping the data keys
+	Object string
+
+	//  PINSource is where the user PIN is read from, either file:<path> or
+	//  env:<variable>
+	PINSource string
+
+	//  PINValue is the user PIN itself, taking precedence over PINSource
+	PINValue string
+}
+
+//  ParseConfig parses the PKCS #11 URI following the scheme, the path
+//  attributes (token, slot-id and object) separated by ';' and the query
+//  attributes (module-path, pin-source and pin-value) by '&'
+func ParseConfig(location string) (*Config, error) {
+	path, query := location, ""
+	if i := strings.IndexByte(location, '?'); i >= 0 {
+		path, query = location[:i], location[i+1:]
+	}
+
+	c := &Config{}
+	for _, attr := range split(path, ';') {
+		name, value, err := attribute(attr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "token":
+			c.Token = value
+		case "object":
+			c.Object = value
+		case "slot-id":
+			slot, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				return nil, errors.Errorf("invalid slot-id %q", value)
+			}
+			c.Slot, c.HasSlot = uint(slot), true
+		default:
+			return nil, errors.Errorf("unsupported path attribute %q", name)
+		}
+	}
+
+	for _, attr := range split(query, '&') {
+		name, value, err := attribute(attr)
+		if err != nil {
+			return nil, err
+		}
+
+		switch name {
+		case "module-path":
+			c.ModulePath = value
+		case "pin-source":
+			c.PINSource = value
+		case "pin-value":
+			c.PINValue = value
+		default:
+			return nil, errors.Errorf("unsupported query attribute %q", name)
+		}
+	}
+
+	if len(c.ModulePath) < 1 {
+		return nil, errors.New("a module-path is required")
+	}
+
+	if len(c.Object) < 1 {
+		return nil, errors.New("the object (label) of the key pair is required")
+	}
+	return c, nil
+}
+
+func split(s string, sep byte) []string {
+	if len(s) < 1 {
+		return nil
+	}
+	return strings.Split(s, string(sep))
+}
+
+//  attribute splits the name=value attribute, percent-decoding the value
+func attribute(attr string) (string, string, error) {
+	i := strings.IndexByte(attr, '=')
+	if i < 1 {
+		return "", "", errors.Errorf("malformed attribute %q", attr)
+	}
+
+	value, err := url.PathUnescape(attr[i+1:])
+	if err != nil {
+		return "", "", errors.Wrapf(err, "malformed attribute %q", attr)
+	}
+	return attr[:i], value, nil
+}
+
+//  PIN returns the user PIN, read from the PIN source if not given by value,
+//  or none if neither are set, e.g. the token has a PIN pad or no login is
+//  required
+func (c *Config) PIN() (string, error) {
+	if len(c.PINValue) > 0 || len(c.PINSource) < 1 {
+		return c.PINValue, nil
+	}
+
+	i := strings.IndexByte(c.PINSource, ':')
+	if i < 0 {
+		return "", errors.Errorf("unsupported pin-source %q, expecting file:<path> or env:<variable>", c.PINSource)
+	}
+
+	switch kind, name := c.PINSource[:i], c.PINSource[i+1:]; kind {
+	case "file":
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", errors.Wrap(err, "unable to read in PIN")
+		}
+		return strings.TrimRight(string(raw), "\r\n"), nil
+	case "env":
+		pin, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("PIN variable %s is not set", name)
+		}
+		return pin, nil
+	default:
+		return "", errors.Errorf("unsupported pin-source %q, expecting file:<path> or env:<variable>", c.PINSource)
+	}
+}
@@ -0,0 +1,81 @@
+package pkcs11
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig("token=sparkles%20prod;slot-id=3;object=kek?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=env:PIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Config{
+		ModulePath: "/usr/lib/softhsm/libsofthsm2.so",
+		Slot:       3,
+		HasSlot:    true,
+		Token:      "sparkles prod",
+		Object:     "kek",
+		PINSource:  "env:PIN",
+	}
+	if got := *c; want != got {
+		t.Errorf("\nwant %+v\ngot  %+v\n", want, got)
+	}
+
+	for _, location := range []string{
+		"object=kek",
+		"token=sparkles?module-path=/lib/p11.so",
+		"object=kek;slot-id=first?module-path=/lib/p11.so",
+		"object=kek;serial=1?module-path=/lib/p11.so",
+		"object=kek?module-path=/lib/p11.so&pin=1234",
+		"object=%zz?module-path=/lib/p11.so",
+		"object?module-path=/lib/p11.so",
+	} {
+		if _, err := ParseConfig(location); err == nil {
+			t.Errorf("want an error parsing %q", location)
+		}
+	}
+}
+
+func TestPIN(t *testing.T) {
+	f, err := ioutil.TempFile("", "pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.WriteString("1234\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	os.Setenv("SPARKLES_TEST_PIN", "5678")
+	defer os.Unsetenv("SPARKLES_TEST_PIN")
+
+	for _, tc := range []struct {
+		c   Config
+		pin string
+	}{
+		{c: Config{}, pin: ""},
+		{c: Config{PINValue: "0000", PINSource: "env:SPARKLES_TEST_PIN"}, pin: "0000"},
+		{c: Config{PINSource: "env:SPARKLES_TEST_PIN"}, pin: "5678"},
+		{c: Config{PINSource: "file:" + f.Name()}, pin: "1234"},
+	} {
+		pin, err := tc.c.PIN()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := tc.pin, pin; want != got {
+			t.Errorf("\nwant %s\ngot  %s\n", want, got)
+		}
+	}
+
+	for _, source := range []string{"env:SPARKLES_TEST_UNSET", "file:/does/not/exist", "pass:1234", "1234"} {
+		if _, err := (&Config{PINSource: source}).PIN(); err == nil {
+			t.Errorf("want an error reading PIN from %q", source)
+		}
+	}
+}
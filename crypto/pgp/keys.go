@@ -0,0 +1,135 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+
+	//  the hash openpgp falls back to for recipients without hash preferences
+	_ "golang.org/x/crypto/ripemd160"
+)
+
+var (
+	ErrNoRecipients = errors.New("at least one recipient public key is required")
+	ErrNoIdentity   = errors.New("no private key able to decrypt the secret")
+	ErrLockedKey    = errors.New("private key is passphrase protected")
+)
+
+//  ReadKeyring reads the public or private keys from an OpenPGP keyring file,
+//  either ASCII armored or binary.
+func ReadKeyring(name string) (openpgp.EntityList, error) {
+	raw, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(raw))
+	if err != nil {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(raw))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) < 1 {
+		return nil, errors.New("no keys found in keyring")
+	}
+
+	return keys, nil
+}
+
+//  ReadKeyrings reads and combines the keys from each of the keyring files
+func ReadKeyrings(names ...string) (openpgp.EntityList, error) {
+	keys := make(openpgp.EntityList, 0)
+	for _, name := range names {
+		k, err := ReadKeyring(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k...)
+	}
+	return keys, nil
+}
+
+//  KeyCrypter encrypts to one or more OpenPGP public keys (recipients), only
+//  requiring a private key (identity) of any recipient to decrypt. The output
+//  is the same base64 encoded, ASCII armored message as the Crypter.
+type KeyCrypter struct {
+	//  Recipients are the public keys to encrypt to
+	Recipients openpgp.EntityList
+
+	//  Identities are the private keys to decrypt with
+	Identities openpgp.EntityList
+
+	//  Passphrase unlocks the identities if they are protected
+	Passphrase []byte
+}
+
+//  Encrypt encrypts the text to every recipient
+func (c *KeyCrypter) Encrypt(text []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := c.EncryptStream(buf, bytes.NewReader(text)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//  Decrypt decrypts the cypher with whichever identity it was encrypted to
+func (c *KeyCrypter) Decrypt(cypher []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := c.DecryptStream(buf, bytes.NewReader(cypher)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//  EncryptStream encrypts the text read from src to every recipient
+func (c *KeyCrypter) EncryptStream(dst io.Writer, src io.Reader) error {
+	if len(c.Recipients) < 1 {
+		return ErrNoRecipients
+	}
+
+	cfg := &packet.Config{
+		DefaultHash:            crypto.SHA512,
+		DefaultCipher:          packet.CipherAES256,
+		DefaultCompressionAlgo: packet.CompressionZLIB,
+		CompressionConfig: &packet.CompressionConfig{
+			Level: 9,
+		},
+	}
+
+	return encode(dst, src, func(w io.Writer) (io.WriteCloser, error) {
+		return openpgp.Encrypt(w, c.Recipients, nil, nil, cfg)
+	})
+}
+
+//  DecryptStream decrypts the cypher read from src with whichever identity it
+//  was encrypted to
+func (c *KeyCrypter) DecryptStream(dst io.Writer, src io.Reader) error {
+	//  called with the matching keys while they remain locked, or with none if
+	//  the message is not encrypted to any identity
+	tried := false
+	return decode(dst, src, c.Identities, func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if len(keys) < 1 || symmetric {
+			return nil, ErrNoIdentity
+		}
+
+		if tried || len(c.Passphrase) < 1 {
+			return nil, ErrLockedKey
+		}
+		tried = true
+
+		for _, k := range keys {
+			if k.PrivateKey != nil && k.PrivateKey.Encrypted {
+				k.PrivateKey.Decrypt(c.Passphrase)
+			}
+		}
+		return nil, nil
+	})
+}
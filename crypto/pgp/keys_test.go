@@ -0,0 +1,106 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func entity(t *testing.T, name string) *openpgp.Entity {
+	e, err := openpgp.NewEntity(name, "testing", fmt.Sprintf("%s@example.com", name), &packet.Config{RSABits: 1024, DefaultHash: crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+//	keyring writes the public (or private) keys of the entities to an armored
+//	keyring file
+func keyring(t *testing.T, private bool, entities ...*openpgp.Entity) string {
+	buf := new(bytes.Buffer)
+
+	typ := openpgp.PublicKeyType
+	if private {
+		typ = openpgp.PrivateKeyType
+	}
+
+	w, err := armor.Encode(buf, typ, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range entities {
+		if private {
+			err = e.SerializePrivate(w, nil)
+		} else {
+			err = e.Serialize(w)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	name := fmt.Sprintf("psparkles_testing_%d.asc", time.Now().UnixNano())
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestKeyCrypter(t *testing.T) {
+	alice, bob, eve := entity(t, "alice"), entity(t, "bob"), entity(t, "eve")
+
+	team := keyring(t, false, alice, bob)
+	defer os.Remove(team)
+
+	recipients, err := ReadKeyrings(team)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recipients) != 2 {
+		t.Fatalf("want 2 recipients, got %d", len(recipients))
+	}
+
+	cypher, err := (&KeyCrypter{Recipients: recipients}).Encrypt([]byte(filler1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//	any recipient can decrypt with only their private key
+	for _, e := range []*openpgp.Entity{alice, bob} {
+		name := keyring(t, true, e)
+		defer os.Remove(name)
+
+		identities, err := ReadKeyring(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plain, err := (&KeyCrypter{Identities: identities}).Decrypt(cypher)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(plain) != filler1 {
+			t.Errorf("want %s\ngot %s", filler1, plain)
+		}
+	}
+
+	if _, err := (&KeyCrypter{Identities: openpgp.EntityList{eve}}).Decrypt(cypher); err == nil {
+		t.Error("want error decrypting with a non-recipient identity")
+	}
+
+	if _, err := (&KeyCrypter{}).Encrypt([]byte(filler1)); err != ErrNoRecipients {
+		t.Errorf("want ErrNoRecipients, got %v", err)
+	}
+}
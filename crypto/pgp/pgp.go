@@ -6,7 +6,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 
 	"golang.org/x/crypto/openpgp/packet"
 
@@ -18,19 +18,56 @@ const PGPMessageType string = "PGP MESSAGE"
 
 var ErrInvalidToken error = errors.New("invalid token")
 
+const (
+	//  DefaultCost is the log2 of the S2K iteration count used by default,
+	//  65536
+	DefaultCost int = 16
+
+	//  minCost and maxCost are the range of S2K iteration counts which can be
+	//  represented
+	minCost int = 10
+	maxCost int = 25
+)
+
 type Crypter struct {
 	Token []byte
+
+	//  Cost is the log2 of the S2K iteration count hashing the token into the
+	//  key, DefaultCost if unset
+	Cost int
 }
 
 //  Encrypt takes a key and text which attempts to encode using the OpenPGP
 //  symmetrical encryption.
 func (c *Crypter) Encrypt(text []byte) ([]byte, error) {
 	buf := new(bytes.Buffer)
+	if err := c.EncryptStream(buf, bytes.NewReader(text)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
 
-	encoder, err := armor.Encode(buf, PGPMessageType, nil)
-	if err != nil {
+//  Decrypt expects an OpenPGP encoded cypher, returning the decrypted results
+//  of the cypher text using the provided token.
+func (c *Crypter) Decrypt(cypher []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := c.DecryptStream(buf, bytes.NewReader(cypher)); err != nil {
 		return nil, err
 	}
+	return buf.Bytes(), nil
+}
+
+//  EncryptStream encrypts the text read from src, writing the base64 encoded,
+//  ASCII armored message to dst
+func (c *Crypter) EncryptStream(dst io.Writer, src io.Reader) error {
+	cost := c.Cost
+	if cost < 1 {
+		cost = DefaultCost
+	}
+
+	if cost < minCost || cost > maxCost {
+		return fmt.Errorf("S2K cost %d is outside of the range %d - %d", cost, minCost, maxCost)
+	}
 
 	cfg := &packet.Config{
 		DefaultHash:            crypto.SHA512,
@@ -39,37 +76,19 @@ func (c *Crypter) Encrypt(text []byte) ([]byte, error) {
 		CompressionConfig: &packet.CompressionConfig{
 			Level: 9,
 		},
-		RSABits: 15360,
-	}
-
-	ptxtWriter, err := openpgp.SymmetricallyEncrypt(encoder, c.Token, nil, cfg)
-	if err != nil {
-		return nil, err
+		S2KCount: 1 << uint(cost),
 	}
 
-	fmt.Fprintf(ptxtWriter, string(text))
-
-	ptxtWriter.Close()
-	encoder.Close()
-
-	return []byte(base64.StdEncoding.EncodeToString(buf.Bytes())), nil
+	return encode(dst, src, func(w io.Writer) (io.WriteCloser, error) {
+		return openpgp.SymmetricallyEncrypt(w, c.Token, nil, cfg)
+	})
 }
 
-//  Decrypt expects an OpenPGP encoded cypher, returning the decrypted results
-//  of the cypher text using the provided token.
-func (c *Crypter) Decrypt(cypher []byte) ([]byte, error) {
-	decoded, err := base64.StdEncoding.DecodeString(string(cypher))
-	if err != nil {
-		return nil, err
-	}
-
-	block, err := armor.Decode(bytes.NewBuffer(decoded))
-	if err != nil {
-		return nil, err
-	}
-
+//  DecryptStream decrypts the base64 encoded, ASCII armored message read from
+//  src, writing the text to dst
+func (c *Crypter) DecryptStream(dst io.Writer, src io.Reader) error {
 	readTick := 0
-	details, err := openpgp.ReadMessage(block.Body, nil, func(k []openpgp.Key, s bool) ([]byte, error) {
+	return decode(dst, src, nil, func(k []openpgp.Key, s bool) ([]byte, error) {
 		// 	temporary hack since this will be called several times when a given
 		//	token is not valid.
 		//	TODO :: review openpgp source for more info
@@ -79,17 +98,50 @@ func (c *Crypter) Decrypt(cypher []byte) ([]byte, error) {
 
 		readTick++
 		return c.Token, nil
-	}, nil)
+	})
+}
 
+//  encode writes the text read from src to the plaintext writer opened by
+//  encrypt, the message being ASCII armored then base64 encoded to dst
+func encode(dst io.Writer, src io.Reader, encrypt func(w io.Writer) (io.WriteCloser, error)) error {
+	b64 := base64.NewEncoder(base64.StdEncoding, dst)
+
+	encoder, err := armor.Encode(b64, PGPMessageType, nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	plaintxt, err := ioutil.ReadAll(details.UnverifiedBody)
+	ptxtWriter, err := encrypt(encoder)
 	if err != nil {
-		fmt.Println(string(plaintxt))
-		return nil, err
+		return err
+	}
+
+	if _, err := io.Copy(ptxtWriter, src); err != nil {
+		return err
+	}
+
+	for _, w := range []io.Closer{ptxtWriter, encoder, b64} {
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//  decode reads the message from the base64 encoded, ASCII armored src,
+//  writing the text to dst. The integrity of the message is only checked once
+//  read in full, an error being returned if it was altered.
+func decode(dst io.Writer, src io.Reader, keys openpgp.KeyRing, prompt openpgp.PromptFunction) error {
+	block, err := armor.Decode(base64.NewDecoder(base64.StdEncoding, src))
+	if err != nil {
+		return err
+	}
+
+	details, err := openpgp.ReadMessage(block.Body, keys, prompt, nil)
+	if err != nil {
+		return err
 	}
 
-	return plaintxt, nil
+	_, err = io.Copy(dst, details.UnverifiedBody)
+	return err
 }
@@ -2,6 +2,8 @@ package pgp
 
 import (
 	"testing"
+
+	sparkles "github.com/manulife-gwam/peppermint-sparkles/crypto"
 )
 
 var (
@@ -86,3 +88,68 @@ func TestDecrypt(t *testing.T) {
 		t.Error("same token, different text returns the same decrypted text")
 	}
 }
+
+func TestDetect(t *testing.T) {
+	cypher, err := (&Crypter{Token: token1}).Encrypt([]byte(filler1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alg := sparkles.Detect(cypher); alg != sparkles.PGP {
+		t.Errorf("want %s detected, got %q", sparkles.PGP, alg)
+	}
+
+	if alg := sparkles.Detect([]byte(filler1)); alg != "" {
+		t.Errorf("want no algorithm detected for plaintext, got %q", alg)
+	}
+}
+
+func TestCost(t *testing.T) {
+	c, err := sparkles.New(sparkles.PGP, &sparkles.Keys{Token: token1, KDF: &sparkles.KDFParams{Cost: 12}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cypher, err := c.Encrypt([]byte(filler1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//	the S2K count is read from the message, so any crypter with the token
+	//	decrypts
+	res, err := (&Crypter{Token: token1}).Decrypt(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := filler1, string(res); want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	if _, err := (&Crypter{Token: token1, Cost: 30}).Encrypt([]byte(filler1)); err == nil {
+		t.Error("expected a cost outside of the range to be rejected")
+	}
+
+	if _, err := sparkles.New(sparkles.PGP, &sparkles.Keys{Token: token1, KDF: &sparkles.KDFParams{Name: sparkles.Argon2id}}); err == nil {
+		t.Error("expected an unsupported KDF to be rejected")
+	}
+}
+
+func TestFormatVerbs(t *testing.T) {
+	c := &Crypter{Token: token1}
+	text := "p@ss%word%s%d%%"
+
+	cypher, err := c.Encrypt([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Decrypt(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(res) != text {
+		t.Errorf("want %q, got %q", text, res)
+	}
+}
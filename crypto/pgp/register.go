@@ -0,0 +1,55 @@
+package pgp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+)
+
+//  prefix is the start of the content, the base64 encoded armor header
+var prefix []byte = []byte(base64.StdEncoding.EncodeToString([]byte("-----BEGIN " + PGPMessageType + "-----")))
+
+func init() {
+	crypto.Register(&crypto.Implementation{
+		Name: crypto.PGP,
+		New: func(k *crypto.Keys) (crypto.Crypter, error) {
+			switch {
+			case len(k.Recipients) > 0:
+				keys, err := ReadKeyrings(k.Recipients...)
+				if err != nil {
+					return nil, err
+				}
+				return &KeyCrypter{Recipients: keys}, nil
+
+			case len(k.Identity) > 0:
+				keys, err := ReadKeyring(k.Identity)
+				if err == nil {
+					return &KeyCrypter{Identities: keys, Passphrase: k.IdentityPassphrase}, nil
+				}
+
+				//  the identity may be for another algorithm
+				if len(k.Token) < 1 {
+					return nil, err
+				}
+			}
+
+			if len(k.Token) < 1 {
+				return nil, crypto.ErrNoKeys
+			}
+
+			c := &Crypter{Token: k.Token}
+			if k.KDF != nil {
+				if len(k.KDF.Name) > 0 && k.KDF.Name != crypto.S2K {
+					return nil, fmt.Errorf("%s does not support the %s KDF", crypto.PGP, k.KDF.Name)
+				}
+				c.Cost = k.KDF.Cost
+			}
+			return c, nil
+		},
+		Detect: func(content []byte) bool {
+			return bytes.HasPrefix(content, prefix)
+		},
+	})
+}
@@ -0,0 +1,152 @@
+package crypto
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	//  ErrNoKeys is returned when none of the keys provided are of use to the
+	//  algorithm
+	ErrNoKeys = errors.New("no token or keys provided for the algorithm")
+
+	ErrUnknownAlgorithm = errors.New("unknown algorithm")
+)
+
+//  Keys is the key material provided to construct a crypter, any of which may
+//  be unset. What each is depends on the algorithm, e.g. file names of
+//  keyrings for PGP.
+type Keys struct {
+	//  Token is the shared token (or passphrase)
+	Token []byte
+
+	//  Recipients are the public keys to encrypt to, in preference to the token
+	Recipients []string
+
+	//  Identity is the private key to decrypt with, in preference to the token
+	Identity string
+
+	//  IdentityPassphrase unlocks the identity if protected
+	IdentityPassphrase []byte
+
+	//  KMS is the URI of the key-management provider wrapping data keys, e.g.
+	//  file:/etc/sparkles/kms.json
+	KMS string
+
+	//  KDF tunes the derivation of the key from the token when encrypting, the
+	//  algorithm's defaults being used if not set
+	KDF *KDFParams
+}
+
+//  Implementation is an algorithm registered by the package implementing it
+type Implementation struct {
+	//  Name is the algorithm recorded in secrets and envelopes
+	Name string
+
+	//  New returns a crypter using the keys provided, or ErrNoKeys if none of
+	//  them are of use
+	New func(k *Keys) (Crypter, error)
+
+	//  Detect reports if content which is not enveloped was encrypted with the
+	//  algorithm, only needed for formats predating the envelope
+	Detect func(content []byte) bool
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]*Implementation)
+)
+
+//  Register makes the algorithm available, typically from the init of the
+//  package implementing it. It panics if the algorithm is already registered.
+func Register(impl *Implementation) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[impl.Name]; ok {
+		panic("crypto: algorithm " + impl.Name + " registered twice")
+	}
+	registry[impl.Name] = impl
+}
+
+//  Registered returns the names of the registered algorithms, sorted
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(algorithm string) (*Implementation, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	impl, ok := registry[algorithm]
+	return impl, ok
+}
+
+//  New returns a crypter for the registered algorithm using the keys provided
+func New(algorithm string, k *Keys) (Crypter, error) {
+	impl, ok := lookup(algorithm)
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownAlgorithm, algorithm)
+	}
+	return impl.New(k)
+}
+
+//  NewDecrypters returns a crypter for every registered algorithm able to use
+//  the keys provided
+func NewDecrypters(k *Keys) (Decrypters, error) {
+	d := Decrypters{}
+
+	var first error
+	for _, name := range Registered() {
+		c, err := New(name, k)
+		if err != nil {
+			if first == nil && err != ErrNoKeys {
+				first = errors.Wrapf(err, "unable to use the keys for %s", name)
+			}
+			continue
+		}
+		d[name] = c
+	}
+
+	if len(d) < 1 {
+		if first != nil {
+			return nil, first
+		}
+		return nil, ErrNoKeys
+	}
+	return d, nil
+}
+
+//  Detect returns the algorithm the content was encrypted with, as recorded in
+//  the envelope header or detected by the registered algorithms for content
+//  prior to the envelope, so only the start of the content is needed. An
+//  empty string is returned if not known (e.g. plaintext), and the content is
+//  never decrypted.
+func Detect(content []byte) string {
+	if i := bytes.IndexByte(content, '.'); i > 0 {
+		if e, err := parseHeader(content[:i]); err == nil {
+			return e.Algorithm
+		}
+	}
+
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for name, impl := range registry {
+		if impl.Detect != nil && impl.Detect(content) {
+			return name
+		}
+	}
+	return ""
+}
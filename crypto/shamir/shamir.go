@@ -0,0 +1,154 @@
+package shamir
+
+import (
+	"crypto/rand"
+
+	"github.com/pkg/errors"
+)
+
+//  MaxShares is the most shares a secret can be split into, each share being
+//  a distinct, non-zero point in GF(2^8)
+const MaxShares int = 255
+
+//  overhead is the threshold and x coordinate prefixing each share
+const overhead int = 2
+
+var (
+	//  ErrTooFewShares is returned when fewer shares than the threshold are
+	//  combined
+	ErrTooFewShares = errors.New("too few shares to recombine the secret")
+
+	//  ErrMismatchedShares is returned when the shares combined were not split
+	//  from the same secret
+	ErrMismatchedShares = errors.New("shares are not from the same secret")
+)
+
+//  Split splits the secret (e.g. a token) into parts shares using Shamir's
+//  secret sharing over GF(2^8). Any threshold of the shares recombine into the
+//  secret (see Combine), while fewer reveal nothing about it. Each share is the
+//  threshold, the x coordinate, then a byte per byte of the secret.
+func Split(secret []byte, parts, threshold int) ([][]byte, error) {
+	if len(secret) < 1 {
+		return nil, errors.New("secret must not be empty")
+	}
+
+	if threshold < 2 {
+		return nil, errors.New("threshold must be at least 2")
+	}
+
+	if parts < threshold || parts > MaxShares {
+		return nil, errors.Errorf("shares must be from the threshold (%d) to %d", threshold, MaxShares)
+	}
+
+	shares := make([][]byte, parts)
+	for i := range shares {
+		shares[i] = make([]byte, overhead+len(secret))
+		shares[i][0], shares[i][1] = byte(threshold), byte(i+1)
+	}
+
+	//  each byte of the secret is the intercept of a random polynomial of
+	//  degree threshold - 1, evaluated at each share's x coordinate
+	coefficients := make([]byte, threshold)
+	defer zero(coefficients)
+
+	for j, b := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, errors.Wrap(err, "unable to generate polynomial")
+		}
+		coefficients[0] = b
+
+		for _, share := range shares {
+			share[overhead+j] = evaluate(coefficients, share[1])
+		}
+	}
+
+	return shares, nil
+}
+
+//  Combine recombines the secret from at least the threshold of the shares it
+//  was split into. Shares beyond the threshold are ignored.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 1 {
+		return nil, ErrTooFewShares
+	}
+
+	size := len(shares[0])
+	if size <= overhead || shares[0][0] < 2 {
+		return nil, errors.New("malformed share")
+	}
+	threshold := int(shares[0][0])
+
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		if len(share) != size || int(share[0]) != threshold {
+			return nil, ErrMismatchedShares
+		}
+
+		x := share[1]
+		if x == 0 || seen[x] {
+			return nil, errors.New("shares must have distinct, non-zero x coordinates")
+		}
+		seen[x] = true
+	}
+
+	if len(shares) < threshold {
+		return nil, errors.Wrapf(ErrTooFewShares, "%d of %d required", len(shares), threshold)
+	}
+	shares = shares[:threshold]
+
+	//  Lagrange interpolation at x = 0, per byte of the secret
+	secret := make([]byte, size-overhead)
+	for i, si := range shares {
+		basis := byte(1)
+		for j, sj := range shares {
+			if i != j {
+				basis = mul(basis, div(sj[1], sj[1]^si[1]))
+			}
+		}
+
+		for k := range secret {
+			secret[k] ^= mul(si[overhead+k], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+//  evaluate evaluates the polynomial at x by Horner's method
+func evaluate(coefficients []byte, x byte) byte {
+	y := byte(0)
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coefficients[i]
+	}
+	return y
+}
+
+//  mul multiplies in GF(2^8) modulo the AES polynomial x^8 + x^4 + x^3 + x + 1,
+//  without branching on the operands
+func mul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		a = (a << 1) ^ (-(a >> 7) & 0x1b)
+		b >>= 1
+	}
+	return p
+}
+
+//  div divides in GF(2^8), the inverse of b being b^254. b must be non-zero.
+func div(a, b byte) byte {
+	inv, sq := byte(1), b
+	for e := 254; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			inv = mul(inv, sq)
+		}
+		sq = mul(sq, sq)
+	}
+	return mul(a, inv)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
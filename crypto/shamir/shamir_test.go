@@ -0,0 +1,126 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestField(t *testing.T) {
+	//  from FIPS 197, 4.2
+	if want, got := byte(0xc1), mul(0x57, 0x83); want != got {
+		t.Errorf("want %#x, got %#x", want, got)
+	}
+
+	for a := 1; a < 256; a++ {
+		if got := mul(byte(a), div(1, byte(a))); got != 1 {
+			t.Fatalf("want %#x * %#x^-1 = 1, got %#x", a, a, got)
+		}
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("Bite my shiny metal ass!")
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(shares) != 5 {
+		t.Fatalf("want 5 shares, got %d", len(shares))
+	}
+
+	//  every combination of 3 or more shares recombines the secret
+	for mask := 0; mask < 1<<5; mask++ {
+		subset := make([][]byte, 0)
+		for i := range shares {
+			if mask&(1<<uint(i)) != 0 {
+				subset = append(subset, shares[i])
+			}
+		}
+
+		res, err := Combine(subset)
+		if len(subset) < 3 {
+			if errors.Cause(err) != ErrTooFewShares {
+				t.Errorf("%d shares: want %v, got %v", len(subset), ErrTooFewShares, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(res, secret) {
+			t.Errorf("shares %05b: want %q, got %q", mask, secret, res)
+		}
+	}
+}
+
+func TestSplitRandom(t *testing.T) {
+	secret := []byte("token")
+
+	first, err := Split(secret, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := Split(secret, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(first[0], second[0]) && bytes.Equal(first[1], second[1]) {
+		t.Error("expected random polynomials for each split")
+	}
+
+	for _, share := range first {
+		if bytes.Contains(share, secret) {
+			t.Errorf("share %x contains the secret", share)
+		}
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	splits := []struct {
+		secret           []byte
+		parts, threshold int
+	}{
+		{secret: nil, parts: 3, threshold: 2},
+		{secret: []byte("token"), parts: 3, threshold: 1},
+		{secret: []byte("token"), parts: 2, threshold: 3},
+		{secret: []byte("token"), parts: 256, threshold: 2},
+	}
+
+	for _, tc := range splits {
+		if _, err := Split(tc.secret, tc.parts, tc.threshold); err == nil {
+			t.Errorf("%d of %d shares of %q: want an error", tc.threshold, tc.parts, tc.secret)
+		}
+	}
+
+	a, err := Split([]byte("token"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Split([]byte("other token"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Combine([][]byte{a[0], b[1]}); err != ErrMismatchedShares {
+		t.Errorf("want %v, got %v", ErrMismatchedShares, err)
+	}
+
+	if _, err := Combine([][]byte{a[0], a[0]}); err == nil {
+		t.Error("want an error for duplicate shares")
+	}
+
+	for _, share := range [][]byte{nil, {2}, {1, 1, 0}} {
+		if _, err := Combine([][]byte{share}); err == nil {
+			t.Errorf("want an error for malformed share %x", share)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package sign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"strings"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+)
+
+//  Algorithms of the signatures, prefixing the encoded signature
+const (
+	Ed25519 string = "ed25519"
+	PGP     string = "pgp"
+)
+
+var (
+	//  ErrUnsigned is returned when verifying content without a signature
+	ErrUnsigned = errors.New("content is not signed")
+
+	//  ErrUntrusted is returned when the signature is by a key which is not
+	//  trusted
+	ErrUntrusted = errors.New("signed by an untrusted key")
+
+	//  ErrInvalidSignature is returned when the signature does not match the
+	//  content, e.g. it was altered or moved from another secret
+	ErrInvalidSignature = errors.New("signature does not match the content")
+)
+
+var pgpArmor []byte = []byte("-----BEGIN PGP ")
+
+//  Signer signs messages, returning the signature encoded as the algorithm
+//  followed by the algorithm specific signature:
+//
+//  	ed25519:<key ID>:<base64 signature>
+//  	pgp:<base64 detached signature>
+type Signer interface {
+	Sign(message []byte) (string, error)
+}
+
+//  KeyID returns the ID of the ed25519 public key, the first 8 bytes of its
+//  SHA-256 hash as hex
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+type ed25519Signer struct {
+	key ed25519.PrivateKey
+	id  string
+}
+
+func (s *ed25519Signer) Sign(message []byte) (string, error) {
+	return Ed25519 + ":" + s.id + ":" + base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, message)), nil
+}
+
+type pgpSigner struct {
+	entity *openpgp.Entity
+}
+
+func (s *pgpSigner) Sign(message []byte) (string, error) {
+	buf := new(bytes.Buffer)
+	if err := openpgp.DetachSign(buf, s.entity, bytes.NewReader(message), nil); err != nil {
+		return "", errors.Wrap(err, "unable to sign")
+	}
+	return PGP + ":" + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+//  LoadSigner reads in the signing key, either a PEM encoded PKCS #8 ed25519
+//  private key, e.g.
+//
+//  	openssl genpkey -algorithm ed25519 -out signing.pem
+//
+//  or an OpenPGP private keyring (the first private key), unlocked by the
+//  passphrase if protected
+func LoadSigner(name string, passphrase []byte) (Signer, error) {
+	raw, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read in signing key")
+	}
+
+	if block, _ := pem.Decode(raw); block != nil && !bytes.Contains(raw, pgpArmor) {
+		if block.Type != "PRIVATE KEY" {
+			return nil, errors.Errorf("signing key must be an unencrypted PKCS #8 private key, not %s", block.Type)
+		}
+
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse signing key")
+		}
+
+		key, ok := k.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("signing key must be an ed25519 key")
+		}
+
+		return &ed25519Signer{key: key, id: KeyID(key.Public().(ed25519.PublicKey))}, nil
+	}
+
+	keys, err := pgp.ReadKeyring(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "signing key must be either a PEM encoded ed25519 key or OpenPGP keyring")
+	}
+
+	for _, e := range keys {
+		if e.PrivateKey == nil {
+			continue
+		}
+
+		if e.PrivateKey.Encrypted {
+			if len(passphrase) < 1 {
+				return nil, pgp.ErrLockedKey
+			}
+
+			if err := e.PrivateKey.Decrypt(passphrase); err != nil {
+				return nil, errors.Wrap(err, "unable to unlock signing key")
+			}
+		}
+
+		return &pgpSigner{entity: e}, nil
+	}
+
+	return nil, errors.New("signing keyring does not contain a private key")
+}
+
+//  Trusted are the public keys signatures are verified against
+type Trusted struct {
+	ed25519 map[string]ed25519.PublicKey
+	pgp     openpgp.EntityList
+}
+
+//  LoadTrusted reads in the trusted public keys from each file, either one or
+//  more PEM encoded PKIX ed25519 public keys, e.g.
+//
+//  	openssl pkey -in signing.pem -pubout -out signing.pub
+//
+//  or an OpenPGP keyring
+func LoadTrusted(names ...string) (*Trusted, error) {
+	t := &Trusted{ed25519: make(map[string]ed25519.PublicKey), pgp: make(openpgp.EntityList, 0)}
+
+	for _, name := range names {
+		raw, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read in trusted keys")
+		}
+
+		if block, _ := pem.Decode(raw); block == nil || bytes.Contains(raw, pgpArmor) {
+			keys, err := pgp.ReadKeyring(name)
+			if err != nil {
+				return nil, errors.Wrapf(err, "trusted keys %s must be either PEM encoded ed25519 keys or an OpenPGP keyring", name)
+			}
+			t.pgp = append(t.pgp, keys...)
+			continue
+		}
+
+		for rest := raw; ; {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+
+			if block.Type != "PUBLIC KEY" {
+				return nil, errors.Errorf("trusted keys %s must be public keys, not %s", name, block.Type)
+			}
+
+			k, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, errors.Wrapf(err, "unable to parse trusted key in %s", name)
+			}
+
+			pub, ok := k.(ed25519.PublicKey)
+			if !ok {
+				return nil, errors.Errorf("trusted keys %s must be ed25519 keys", name)
+			}
+			t.ed25519[KeyID(pub)] = pub
+		}
+	}
+
+	if len(t.ed25519) < 1 && len(t.pgp) < 1 {
+		return nil, errors.New("no trusted keys provided")
+	}
+	return t, nil
+}
+
+//  Verify verifies the signature of the message is by a trusted key
+func (t *Trusted) Verify(message []byte, signature string) error {
+	if len(signature) < 1 {
+		return ErrUnsigned
+	}
+
+	alg, rest := signature, ""
+	if i := strings.IndexByte(signature, ':'); i > 0 {
+		alg, rest = signature[:i], signature[i+1:]
+	}
+
+	switch alg {
+	case Ed25519:
+		i := strings.IndexByte(rest, ':')
+		if i < 0 {
+			return errors.Wrap(ErrInvalidSignature, "malformed signature")
+		}
+
+		pub, ok := t.ed25519[rest[:i]]
+		if !ok {
+			return errors.Wrapf(ErrUntrusted, "key %s", rest[:i])
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(rest[i+1:])
+		if err != nil {
+			return errors.Wrap(ErrInvalidSignature, "malformed signature")
+		}
+
+		if !ed25519.Verify(pub, message, sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+
+	case PGP:
+		sig, err := base64.StdEncoding.DecodeString(rest)
+		if err != nil {
+			return errors.Wrap(ErrInvalidSignature, "malformed signature")
+		}
+
+		if _, err := openpgp.CheckDetachedSignature(t.pgp, bytes.NewReader(message), bytes.NewReader(sig)); err != nil {
+			if err == pgperrors.ErrUnknownIssuer {
+				return ErrUntrusted
+			}
+			return errors.Wrap(ErrInvalidSignature, err.Error())
+		}
+		return nil
+
+	default:
+		return errors.Errorf("unknown signature algorithm %q", alg)
+	}
+}
@@ -0,0 +1,175 @@
+package sign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+var message = []byte("Bite my shiny metal ass!")
+
+func write(t *testing.T, raw []byte) string {
+	name := fmt.Sprintf("psparkles_testing_%d", time.Now().UnixNano())
+	if err := ioutil.WriteFile(name, raw, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+//	ed25519Keys writes a PEM encoded ed25519 private key and public key file
+func ed25519Keys(t *testing.T) (string, string) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawPriv, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawPub, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return write(t, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: rawPriv})),
+		write(t, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rawPub}))
+}
+
+//	pgpKeys writes an armored OpenPGP private keyring and public keyring
+func pgpKeys(t *testing.T, name string) (string, string) {
+	e, err := openpgp.NewEntity(name, "testing", name+"@example.com", &packet.Config{RSABits: 1024, DefaultHash: crypto.SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	armored := func(typ string, serialize func(w *bytes.Buffer) error) string {
+		buf := new(bytes.Buffer)
+		if err := serialize(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		out := new(bytes.Buffer)
+		w, err := armor.Encode(out, typ, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(buf.Bytes())
+		w.Close()
+		return write(t, out.Bytes())
+	}
+
+	return armored(openpgp.PrivateKeyType, func(w *bytes.Buffer) error { return e.SerializePrivate(w, nil) }),
+		armored(openpgp.PublicKeyType, func(w *bytes.Buffer) error { return e.Serialize(w) })
+}
+
+func TestSign(t *testing.T) {
+	edPriv, edPub := ed25519Keys(t)
+	otherPriv, otherPub := ed25519Keys(t)
+	pgpPriv, pgpPub := pgpKeys(t, "alice")
+	evePriv, evePub := pgpKeys(t, "eve")
+
+	defer func() {
+		for _, name := range []string{edPriv, edPub, otherPriv, otherPub, pgpPriv, pgpPub, evePriv, evePub} {
+			os.Remove(name)
+		}
+	}()
+
+	trusted, err := LoadTrusted(edPub, pgpPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key     string
+		prefix  string
+		trusted bool
+	}{
+		{key: edPriv, prefix: Ed25519 + ":", trusted: true},
+		{key: pgpPriv, prefix: PGP + ":", trusted: true},
+		{key: otherPriv, prefix: Ed25519 + ":"},
+		{key: evePriv, prefix: PGP + ":"},
+	}
+
+	for _, tc := range tests {
+		s, err := LoadSigner(tc.key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sig, err := s.Sign(message)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(sig, tc.prefix) {
+			t.Errorf("want signature prefixed by %s, got %s", tc.prefix, sig)
+		}
+
+		err = trusted.Verify(message, sig)
+		if !tc.trusted {
+			if errors.Cause(err) != ErrUntrusted {
+				t.Errorf("%s: want %v, got %v", tc.prefix, ErrUntrusted, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %v", tc.prefix, err)
+		}
+
+		if err := trusted.Verify(append([]byte("!"), message...), sig); errors.Cause(err) != ErrInvalidSignature {
+			t.Errorf("%s: want %v for altered content, got %v", tc.prefix, ErrInvalidSignature, err)
+		}
+	}
+
+	if err := trusted.Verify(message, ""); err != ErrUnsigned {
+		t.Errorf("want %v, got %v", ErrUnsigned, err)
+	}
+
+	for _, sig := range []string{"ed25519", "ed25519:nokeyid", "pgp:!!!", "rsa:c2ln"} {
+		if err := trusted.Verify(message, sig); err == nil {
+			t.Errorf("%q: want an error for a malformed signature", sig)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	edPriv, edPub := ed25519Keys(t)
+	defer os.Remove(edPriv)
+	defer os.Remove(edPub)
+
+	if _, err := LoadSigner(edPub, nil); err == nil {
+		t.Error("want an error for a public key as the signing key")
+	}
+
+	if _, err := LoadTrusted(edPriv); err == nil {
+		t.Error("want an error for a private key as a trusted key")
+	}
+
+	if _, err := LoadTrusted(); err == nil {
+		t.Error("want an error for no trusted keys")
+	}
+
+	garbage := write(t, []byte("not a key"))
+	defer os.Remove(garbage)
+
+	if _, err := LoadSigner(garbage, nil); err == nil {
+		t.Error("want an error for an invalid signing key")
+	}
+}
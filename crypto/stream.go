@@ -0,0 +1,130 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+//  ChunkSize is the size of the chunks streamed content is sealed in, bounding
+//  the memory used to encrypt or decrypt regardless of the size of the content
+const ChunkSize int = 64 * 1024
+
+//  ErrTruncated is returned when streamed content ends before its final chunk
+var ErrTruncated = errors.New("content is truncated")
+
+//  NonceFunc returns the nonce of a chunk, which must be unique to the chunk
+//  counter and whether it is the final chunk, so chunks cannot be reordered
+//  and the content cannot be truncated
+type NonceFunc func(counter uint64, last bool) []byte
+
+//  SealStream encrypts the text read from src in chunks of ChunkSize, each
+//  sealed with the AEAD and authenticating the additional data, writing the
+//  sealed chunks to dst. An empty text is sealed as a single, empty final
+//  chunk.
+func SealStream(dst io.Writer, src io.Reader, aead cipher.AEAD, nonce NonceFunc, aad []byte) error {
+	in := bufio.NewReader(src)
+	buf := make([]byte, ChunkSize, ChunkSize+aead.Overhead())
+
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(in, buf[:ChunkSize])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Wrap(err, "unable to read content")
+		}
+
+		last, err := final(in, n < ChunkSize)
+		if err != nil {
+			return errors.Wrap(err, "unable to read content")
+		}
+
+		if _, err := dst.Write(aead.Seal(buf[:0], nonce(counter, last), buf[:n], aad)); err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+//  OpenStream decrypts the chunks sealed by SealStream read from src, writing
+//  the text to dst as each chunk is authenticated. Should an error be returned
+//  the text written so far must be discarded, since the content was altered or
+//  truncated.
+func OpenStream(dst io.Writer, src io.Reader, aead cipher.AEAD, nonce NonceFunc, aad []byte) error {
+	in := bufio.NewReader(src)
+	buf := make([]byte, ChunkSize+aead.Overhead())
+
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(in, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return errors.Wrap(err, "unable to read content")
+		}
+
+		if n < aead.Overhead() {
+			return ErrTruncated
+		}
+
+		last, err := final(in, n < len(buf))
+		if err != nil {
+			return errors.Wrap(err, "unable to read content")
+		}
+
+		text, err := aead.Open(buf[:0], nonce(counter, last), buf[:n], aad)
+		if err != nil {
+			return errors.Wrapf(err, "unable to decrypt chunk %d", counter)
+		}
+
+		//  only an empty text may have an empty final chunk
+		if last && len(text) < 1 && counter > 0 {
+			return errors.New("content has an empty final chunk")
+		}
+
+		if _, err := dst.Write(text); err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+//  final reports if the chunk just read is the final chunk, either being short
+//  or followed by the end of the content
+func final(in *bufio.Reader, short bool) (bool, error) {
+	if short {
+		return true, nil
+	}
+
+	if _, err := in.Peek(1); err != nil {
+		if err == io.EOF {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+//  Encrypt encrypts the text with the streaming crypter, for crypters
+//  implementing Encrypt by EncryptStream
+func Encrypt(c Crypter, text []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := c.EncryptStream(buf, bytes.NewReader(text)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//  Decrypt decrypts the cypher with the streaming crypter, for crypters
+//  implementing Decrypt by DecryptStream
+func Decrypt(c Crypter, cypher []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := c.DecryptStream(buf, bytes.NewReader(cypher)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,132 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestStream(t *testing.T) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEnvelope("test")
+	e.Nonce = make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(e.Nonce); err != nil {
+		t.Fatal(err)
+	}
+	aad := []byte("header")
+
+	chunk := ChunkSize + aead.Overhead()
+
+	//  empty, exactly one chunk, and spanning chunks with a partial final chunk
+	for _, size := range []int{0, 7, ChunkSize, 2*ChunkSize + 7} {
+		text := make([]byte, size)
+		if _, err := rand.Read(text); err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		if err := SealStream(buf, bytes.NewReader(text), aead, e.ChunkNonce, aad); err != nil {
+			t.Fatal(err)
+		}
+		sealed := buf.Bytes()
+
+		res := new(bytes.Buffer)
+		if err := OpenStream(res, bytes.NewReader(sealed), aead, e.ChunkNonce, aad); err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+
+		if !bytes.Equal(res.Bytes(), text) {
+			t.Errorf("%d bytes: text does not match", size)
+		}
+
+		if err := OpenStream(ioutil.Discard, bytes.NewReader(sealed), aead, e.ChunkNonce, []byte("other")); err == nil {
+			t.Errorf("%d bytes: expected other additional data to fail", size)
+		}
+
+		if size <= ChunkSize {
+			continue
+		}
+
+		//  dropping the final chunk, or the chunks being reordered, must not go
+		//  unnoticed
+		if err := OpenStream(ioutil.Discard, bytes.NewReader(sealed[:2*chunk]), aead, e.ChunkNonce, aad); err == nil {
+			t.Errorf("%d bytes: expected truncation to be detected", size)
+		}
+
+		reordered := append(append(append([]byte{}, sealed[chunk:2*chunk]...), sealed[:chunk]...), sealed[2*chunk:]...)
+		if err := OpenStream(ioutil.Discard, bytes.NewReader(reordered), aead, e.ChunkNonce, aad); err == nil {
+			t.Errorf("%d bytes: expected reordering to be detected", size)
+		}
+	}
+
+	if err := OpenStream(ioutil.Discard, bytes.NewReader(nil), aead, e.ChunkNonce, aad); err != ErrTruncated {
+		t.Errorf("want %v, got %v", ErrTruncated, err)
+	}
+}
+
+func TestReadEnvelope(t *testing.T) {
+	e := NewEnvelope("test")
+	e.KeyID = "key-1"
+	e.Nonce = []byte("nonce")
+
+	buf := new(bytes.Buffer)
+	w, err := e.WriteHeader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.Write([]byte("ciphertext")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//  the streamed envelope is the same as that marshaled
+	e.Ciphertext = []byte("ciphertext")
+	raw, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(buf.Bytes(), raw) {
+		t.Errorf("want %s\ngot  %s", raw, buf.Bytes())
+	}
+
+	got, r, err := ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ciphertext, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Algorithm != "test" || got.KeyID != "key-1" || !got.Chunked() || !bytes.Equal(got.Nonce, e.Nonce) || !bytes.Equal(ciphertext, e.Ciphertext) {
+		t.Errorf("unexpected envelope %+v with ciphertext %q", got, ciphertext)
+	}
+
+	for _, content := range []string{"", "notSuperS3cret", "!!!.AA.AA", "eyJ2IjoxLCJhbGciOiJ0ZXN0In0.!!.AA"} {
+		if _, _, err := ReadEnvelope(bytes.NewReader([]byte(content))); err == nil {
+			t.Errorf("expected %q to be rejected", content)
+		}
+	}
+
+	if _, _, err := ReadEnvelope(bytes.NewReader(bytes.Repeat([]byte("e"), maxHeaderSize+2))); err == nil {
+		t.Error("expected an oversized header to be rejected")
+	}
+}
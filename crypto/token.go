@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+//  Kinds of token generated (see GenerateToken)
+const (
+	RandomToken   string = "random"
+	DicewareToken string = "diceware"
+)
+
+const (
+	//  TokenSize is the number of random bytes (256 bits) in a generated token
+	TokenSize int = 32
+
+	//  DefaultWords is the number of words in a generated passphrase, ~90 bits
+	DefaultWords int = 7
+
+	//  MinTokenBits is the least estimated entropy (see TokenBits) accepted for
+	//  a token provided to encrypt with
+	MinTokenBits float64 = 64
+
+	separator string = "-"
+)
+
+//  ErrWeakToken is returned when a token's estimated entropy is too low
+var ErrWeakToken = errors.New("token is too weak")
+
+//  NewToken returns a random 256 bit token, base64 encoded
+func NewToken() (string, error) {
+	b := make([]byte, TokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "unable to read in random data to generate token")
+	}
+
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+//  NewPassphrase returns a diceware passphrase of the words chosen at random
+//  from the EFF large wordlist, separated by hyphens. Easier to read out or
+//  write down than a token, each word adds ~12.9 bits.
+func NewPassphrase(words int) (string, error) {
+	if words < 1 {
+		return "", errors.New("passphrase must have at least 1 word")
+	}
+
+	max, chosen := big.NewInt(int64(len(wordlist))), make([]string, words)
+	for i := range chosen {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", errors.Wrap(err, "unable to read in random data to generate passphrase")
+		}
+		chosen[i] = wordlist[n.Int64()]
+	}
+
+	return strings.Join(chosen, separator), nil
+}
+
+//  GenerateToken returns a token of the kind, random or diceware, the words
+//  only applying to diceware passphrases (DefaultWords if unset)
+func GenerateToken(kind string, words int) (string, error) {
+	switch kind {
+	case "", RandomToken:
+		return NewToken()
+
+	case DicewareToken:
+		if words == 0 {
+			words = DefaultWords
+		}
+		return NewPassphrase(words)
+
+	default:
+		return "", errors.Errorf("unknown token type %q, must be %s or %s", kind, RandomToken, DicewareToken)
+	}
+}
+
+//  TokenBits returns a conservative estimate of the entropy (in bits) of the
+//  token. Diceware passphrases are estimated by the number of words, others as
+//  if each character were chosen at random from the classes of characters
+//  present (lower and upper case letters, digits, and symbols), with repeated
+//  characters counting for a quarter.
+func TokenBits(token string) float64 {
+	if words := strings.Split(token, separator); len(words) > 1 && inWordlist(words) {
+		return float64(len(words)) * math.Log2(float64(len(wordlist)))
+	}
+
+	var lower, upper, digit, other bool
+	seen, length := make(map[rune]bool), 0.0
+	for _, r := range token {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+
+		if seen[r] {
+			length += 0.25
+			continue
+		}
+		seen[r], length = true, length+1
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {other, 33}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+
+	if pool < 2 {
+		return 0
+	}
+	return length * math.Log2(float64(pool))
+}
+
+//  CheckToken returns an ErrWeakToken if the estimated entropy of the token
+//  (see TokenBits) is less than MinTokenBits
+func CheckToken(token string) error {
+	if bits := TokenBits(token); bits < MinTokenBits {
+		return errors.Wrapf(ErrWeakToken, "~%.0f bits estimated, at least %.0f required", bits, MinTokenBits)
+	}
+	return nil
+}
+
+//  inWordlist reports if each of the words is in the wordlist, which is sorted
+func inWordlist(words []string) bool {
+	for _, w := range words {
+		i := sort.SearchStrings(wordlist, w)
+		if i >= len(wordlist) || wordlist[i] != w {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewToken(t *testing.T) {
+	tok, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(tok)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(raw) != TokenSize {
+		t.Errorf("want %d random bytes, got %d", TokenSize, len(raw))
+	}
+
+	again, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tok == again {
+		t.Error("expected a random token each time")
+	}
+
+	if err := CheckToken(tok); err != nil {
+		t.Errorf("expected a generated token to be strong enough, got %v", err)
+	}
+}
+
+func TestNewPassphrase(t *testing.T) {
+	if want, got := 7776, len(wordlist); want != got {
+		t.Fatalf("want %d words in the wordlist, got %d", want, got)
+	}
+
+	if !sort.StringsAreSorted(wordlist) {
+		t.Fatal("expected the wordlist to be sorted")
+	}
+
+	pass, err := GenerateToken(DicewareToken, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	words := strings.Split(pass, separator)
+	if len(words) < DefaultWords {
+		t.Fatalf("want %d words, got %q", DefaultWords, pass)
+	}
+
+	if err := CheckToken(pass); err != nil {
+		t.Errorf("expected a generated passphrase to be strong enough, got %v", err)
+	}
+
+	if _, err := NewPassphrase(0); err == nil {
+		t.Error("expected a passphrase of no words to be rejected")
+	}
+
+	if _, err := GenerateToken("uuid", 0); err == nil {
+		t.Error("expected an unknown token type to be rejected")
+	}
+}
+
+func TestTokenBits(t *testing.T) {
+	tests := []struct {
+		token  string
+		strong bool
+	}{
+		{token: "", strong: false},
+		{token: "password", strong: false},
+		{token: "password1234", strong: false},
+		{token: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", strong: false},
+		{token: "abacus-zoom-abide", strong: false},
+		{token: "correct-horse-battery-staple-abacus-zoom", strong: true},
+		{token: "Tr0ub4dor&3xTr4-N0t!Guessable", strong: true},
+		{token: "OTUzMmE1N2QtZjU5MS00N2Y2LWIxZmEtMzBlYzllZjNlYzNj", strong: true},
+	}
+
+	for _, tc := range tests {
+		err := CheckToken(tc.token)
+		if strong := err == nil; strong != tc.strong {
+			t.Errorf("%q (~%.0f bits): want strong %t, got %v", tc.token, TokenBits(tc.token), tc.strong, err)
+		}
+
+		if err != nil && errors.Cause(err) != ErrWeakToken {
+			t.Errorf("%q: want %v, got %v", tc.token, ErrWeakToken, err)
+		}
+	}
+}
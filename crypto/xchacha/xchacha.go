@@ -0,0 +1,281 @@
+package xchacha
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	//  DefaultCost is the log2 of the scrypt work factor used by default. Tokens
+	//  are random, so need far less stretching than a passphrase.
+	DefaultCost int = 15
+
+	//  maxCost and maxWork cap the cost and block size * parallelism accepted
+	//  when decrypting, to bound the time and memory a crafted secret can
+	//  consume
+	maxCost int = 22
+	maxWork int = 64
+
+	blockSize   int = 8
+	parallelism int = 1
+	saltSize    int = 16
+
+	//  DefaultTime, DefaultMemory (in KiB), and DefaultParallelism are the
+	//  argon2id parameters used by default, per RFC 9106
+	DefaultTime        int = 3
+	DefaultMemory      int = 64 * 1024
+	DefaultParallelism int = 4
+
+	//  maxTime, maxMemory, and maxParallelism cap the argon2id parameters
+	//  accepted when decrypting, as for scrypt
+	maxTime        int = 16
+	maxMemory      int = 1024 * 1024
+	maxParallelism int = 255
+)
+
+func init() {
+	crypto.Register(&crypto.Implementation{
+		Name: crypto.XChaCha,
+		New: func(k *crypto.Keys) (crypto.Crypter, error) {
+			if len(k.Recipients) > 0 {
+				return nil, errors.Errorf("%s does not support recipients", crypto.XChaCha)
+			}
+
+			if len(k.Token) < 1 {
+				return nil, crypto.ErrNoKeys
+			}
+
+			c := &Crypter{Token: k.Token}
+			if p := k.KDF; p != nil {
+				switch p.Name {
+				case "", crypto.Scrypt, crypto.Argon2id:
+				default:
+					return nil, errors.Errorf("%s does not support the %s KDF", crypto.XChaCha, p.Name)
+				}
+				c.KDF, c.Cost, c.Time, c.Memory, c.Parallelism = p.Name, p.Cost, p.Time, p.Memory, p.Parallelism
+			}
+			return c, nil
+		},
+	})
+}
+
+//  Crypter encrypts with XChaCha20-Poly1305, the key derived from the token by
+//  scrypt or argon2id. The output is an envelope (see crypto.Envelope)
+//  recording the KDF parameters, with the random nonce.
+type Crypter struct {
+	Token []byte
+
+	//  KDF derives the key when encrypting, scrypt (the default) or argon2id
+	KDF string
+
+	//  Cost is the log2 of the scrypt work factor when encrypting, DefaultCost
+	//  if unset
+	Cost int
+
+	//  Time, Memory (in KiB), and Parallelism are the argon2id parameters when
+	//  encrypting, the defaults if unset
+	Time        int
+	Memory      int
+	Parallelism int
+}
+
+//  Algorithm returns the algorithm recorded in secrets encrypted by the crypter
+func (c *Crypter) Algorithm() string {
+	return crypto.XChaCha
+}
+
+func (c *Crypter) Encrypt(text []byte) ([]byte, error) {
+	return crypto.Encrypt(c, text)
+}
+
+func (c *Crypter) Decrypt(cypher []byte) ([]byte, error) {
+	return crypto.Decrypt(c, cypher)
+}
+
+//  EncryptStream encrypts the text in chunks (see crypto.SealStream)
+func (c *Crypter) EncryptStream(dst io.Writer, src io.Reader) error {
+	if len(c.Token) < 1 {
+		return crypto.ErrNoKeys
+	}
+
+	e := crypto.NewEnvelope(crypto.XChaCha)
+	e.KDF = c.params()
+
+	if err := validate(e.KDF); err != nil {
+		return err
+	}
+
+	e.KDF.Salt = make([]byte, saltSize)
+	if _, err := rand.Read(e.KDF.Salt); err != nil {
+		return errors.Wrap(err, "unable to generate salt")
+	}
+
+	e.Nonce = make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(e.Nonce); err != nil {
+		return errors.Wrap(err, "unable to generate nonce")
+	}
+
+	aead, err := c.aead(e.KDF)
+	if err != nil {
+		return err
+	}
+
+	aad, err := e.AAD()
+	if err != nil {
+		return err
+	}
+
+	w, err := e.WriteHeader(dst)
+	if err != nil {
+		return err
+	}
+
+	if err := crypto.SealStream(w, src, aead, e.ChunkNonce, aad); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+//  DecryptStream decrypts the envelope, streaming chunked ciphertext
+func (c *Crypter) DecryptStream(dst io.Writer, src io.Reader) error {
+	e, ciphertext, err := crypto.ReadEnvelope(src)
+	if err != nil {
+		return err
+	}
+
+	if e.Algorithm != crypto.XChaCha {
+		return errors.Errorf("content is encrypted with %s", e.Algorithm)
+	}
+
+	if e.KDF == nil {
+		return errors.New("envelope does not specify the KDF parameters")
+	}
+
+	if err := validate(e.KDF); err != nil {
+		return err
+	}
+
+	if len(e.Nonce) != chacha20poly1305.NonceSizeX {
+		return errors.New("malformed nonce")
+	}
+
+	aead, err := c.aead(e.KDF)
+	if err != nil {
+		return err
+	}
+
+	aad, err := e.AAD()
+	if err != nil {
+		return err
+	}
+
+	if e.Chunked() {
+		if err := crypto.OpenStream(dst, ciphertext, aead, e.ChunkNonce, aad); err != nil {
+			return errors.Wrap(err, "invalid token")
+		}
+		return nil
+	}
+
+	//  ciphertext sealed as a whole is read in whole
+	sealed, err := ioutil.ReadAll(ciphertext)
+	if err != nil {
+		return errors.Wrap(err, "malformed envelope ciphertext")
+	}
+
+	text, err := aead.Open(nil, e.Nonce, sealed, aad)
+	if err != nil {
+		return errors.New("invalid token")
+	}
+
+	_, err = dst.Write(text)
+	return err
+}
+
+//  params returns the parameters of the KDF to encrypt with, defaulting any
+//  unset
+func (c *Crypter) params() *crypto.KDF {
+	switch c.KDF {
+	case "", crypto.Scrypt:
+		kdf := &crypto.KDF{Name: crypto.Scrypt, Cost: c.Cost, BlockSize: blockSize, Parallelism: parallelism}
+		if kdf.Cost < 1 {
+			kdf.Cost = DefaultCost
+		}
+		return kdf
+
+	case crypto.Argon2id:
+		kdf := &crypto.KDF{Name: crypto.Argon2id, Time: c.Time, Memory: c.Memory, Parallelism: c.Parallelism}
+		if kdf.Time < 1 {
+			kdf.Time = DefaultTime
+		}
+		if kdf.Memory < 1 {
+			kdf.Memory = DefaultMemory
+		}
+		if kdf.Parallelism < 1 {
+			kdf.Parallelism = DefaultParallelism
+		}
+		return kdf
+
+	default:
+		//  rejected by validate
+		return &crypto.KDF{Name: c.KDF}
+	}
+}
+
+//  validate checks the KDF parameters are within the ranges allowed, bounding
+//  the time and memory a crafted secret can consume
+func validate(kdf *crypto.KDF) error {
+	switch kdf.Name {
+	case crypto.Scrypt:
+		if kdf.Cost < 1 || kdf.Cost > maxCost {
+			return errors.Errorf("scrypt cost %d is outside of the range allowed", kdf.Cost)
+		}
+
+		if kdf.BlockSize < 1 || kdf.Parallelism < 1 || kdf.BlockSize*kdf.Parallelism > maxWork {
+			return errors.New("scrypt block size and parallelism are outside of the range allowed")
+		}
+
+	case crypto.Argon2id:
+		if kdf.Time < 1 || kdf.Time > maxTime {
+			return errors.Errorf("argon2id time %d is outside of the range allowed", kdf.Time)
+		}
+
+		if kdf.Parallelism < 1 || kdf.Parallelism > maxParallelism {
+			return errors.Errorf("argon2id parallelism %d is outside of the range allowed", kdf.Parallelism)
+		}
+
+		//  argon2 requires at least 8 KiB per thread
+		if kdf.Memory < 8*kdf.Parallelism || kdf.Memory > maxMemory {
+			return errors.Errorf("argon2id memory %d KiB is outside of the range allowed", kdf.Memory)
+		}
+
+	default:
+		return errors.Errorf("unknown KDF %q", kdf.Name)
+	}
+
+	return nil
+}
+
+func (c *Crypter) aead(kdf *crypto.KDF) (cipher.AEAD, error) {
+	var key []byte
+	switch kdf.Name {
+	case crypto.Argon2id:
+		key = argon2.IDKey(c.Token, kdf.Salt, uint32(kdf.Time), uint32(kdf.Memory), uint8(kdf.Parallelism), chacha20poly1305.KeySize)
+
+	default:
+		k, err := scrypt.Key(c.Token, kdf.Salt, 1<<uint(kdf.Cost), kdf.BlockSize, kdf.Parallelism, chacha20poly1305.KeySize)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to derive key")
+		}
+		key = k
+	}
+	return chacha20poly1305.NewX(key)
+}
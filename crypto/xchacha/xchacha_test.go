@@ -0,0 +1,230 @@
+package xchacha
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func TestCrypter(t *testing.T) {
+	text := []byte("Bite my shiny metal ass!")
+
+	c := &Crypter{Token: []byte("token"), Cost: 10}
+	cypher, err := c.Encrypt(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alg := crypto.Detect(cypher); alg != crypto.XChaCha {
+		t.Errorf("want %s detected, got %q", crypto.XChaCha, alg)
+	}
+
+	res, err := c.Decrypt(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, text) {
+		t.Errorf("want %q, got %q", text, res)
+	}
+
+	again, err := c.Encrypt(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Equal(cypher, again) {
+		t.Error("expected a random salt and nonce for each encryption")
+	}
+
+	if _, err := (&Crypter{Token: []byte("wrong")}).Decrypt(cypher); err == nil {
+		t.Error("expected the wrong token to fail")
+	}
+}
+
+func TestTamperedHeader(t *testing.T) {
+	c := &Crypter{Token: []byte("token"), Cost: 10}
+	cypher, err := c.Encrypt([]byte("text"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := crypto.ParseEnvelope(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//  the same key but a different header must not decrypt
+	e2 := crypto.NewEnvelope(e.Algorithm)
+	e2.KDF, e2.KeyID, e2.Nonce, e2.Ciphertext = e.KDF, "other", e.Nonce, e.Ciphertext
+
+	tampered, err := e2.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Decrypt(tampered); err == nil {
+		t.Error("expected a tampered header to fail")
+	}
+
+	e2 = crypto.NewEnvelope(e.Algorithm)
+	e2.KDF = &crypto.KDF{Name: crypto.Scrypt, Salt: e.KDF.Salt, Cost: 40, BlockSize: blockSize, Parallelism: parallelism}
+	e2.Nonce, e2.Ciphertext = e.Nonce, e.Ciphertext
+
+	expensive, err := e2.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.Decrypt(expensive); err == nil || !strings.Contains(err.Error(), "cost") {
+		t.Errorf("expected an excessive cost to be rejected, got %v", err)
+	}
+}
+
+func TestArgon2id(t *testing.T) {
+	text := []byte("Bite my shiny metal ass!")
+
+	c := &Crypter{Token: []byte("token"), KDF: crypto.Argon2id, Time: 1, Memory: 64, Parallelism: 1}
+	cypher, err := c.Encrypt(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := crypto.ParseEnvelope(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := (crypto.KDF{Name: crypto.Argon2id, Salt: e.KDF.Salt, Time: 1, Memory: 64, Parallelism: 1}), *e.KDF; want.Name != got.Name || want.Time != got.Time || want.Memory != got.Memory || want.Parallelism != got.Parallelism {
+		t.Errorf("\nwant %+v\ngot  %+v\n", want, got)
+	}
+
+	//  the parameters are read from the envelope, so any crypter with the
+	//  token decrypts
+	res, err := (&Crypter{Token: []byte("token")}).Decrypt(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, text) {
+		t.Errorf("want %q, got %q", text, res)
+	}
+
+	if _, err := (&Crypter{Token: []byte("wrong")}).Decrypt(cypher); err == nil {
+		t.Error("expected the wrong token to fail")
+	}
+
+	for _, invalid := range []*Crypter{
+		{Token: []byte("token"), KDF: crypto.Argon2id, Time: maxTime + 1},
+		{Token: []byte("token"), KDF: crypto.Argon2id, Memory: maxMemory + 1},
+		{Token: []byte("token"), KDF: crypto.Argon2id, Memory: 8, Parallelism: 2},
+		{Token: []byte("token"), Cost: maxCost + 1},
+		{Token: []byte("token"), KDF: "bcrypt"},
+	} {
+		if _, err := invalid.Encrypt(text); err == nil {
+			t.Errorf("%+v: expected the parameters to be rejected", invalid)
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	c, err := crypto.New(crypto.XChaCha, &crypto.Keys{Token: []byte("token")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alg := crypto.Algorithm(c); alg != crypto.XChaCha {
+		t.Errorf("want %s, got %s", crypto.XChaCha, alg)
+	}
+
+	if _, err := crypto.New(crypto.XChaCha, &crypto.Keys{}); err != crypto.ErrNoKeys {
+		t.Errorf("want ErrNoKeys, got %v", err)
+	}
+
+	if _, err := crypto.New("rot13", &crypto.Keys{}); err == nil {
+		t.Error("expected an unknown algorithm to be rejected")
+	}
+
+	kdf := &crypto.KDFParams{Name: crypto.Argon2id, Time: 2}
+	c, err = crypto.New(crypto.XChaCha, &crypto.Keys{Token: []byte("token"), KDF: kdf})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if x := c.(*Crypter); x.KDF != crypto.Argon2id || x.Time != 2 {
+		t.Errorf("want the KDF parameters %+v, got %+v", kdf, x)
+	}
+
+	if _, err := crypto.New(crypto.XChaCha, &crypto.Keys{Token: []byte("token"), KDF: &crypto.KDFParams{Name: crypto.S2K}}); err == nil {
+		t.Error("expected an unsupported KDF to be rejected")
+	}
+}
+
+func TestStream(t *testing.T) {
+	c := &Crypter{Token: []byte("token"), Cost: 10}
+
+	//  spanning several chunks
+	text := bytes.Repeat([]byte("Bite my shiny metal ass! "), 3*crypto.ChunkSize/25)
+
+	buf := new(bytes.Buffer)
+	if err := c.EncryptStream(buf, bytes.NewReader(text)); err != nil {
+		t.Fatal(err)
+	}
+
+	//  decrypted with the crypter detected from the start of the content
+	res := new(bytes.Buffer)
+	if err := (crypto.Decrypters{crypto.XChaCha: c}).DecryptStream("", res, bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res.Bytes(), text) {
+		t.Error("text does not match")
+	}
+
+	truncated := buf.Bytes()[:buf.Len()-100]
+	if err := c.DecryptStream(ioutil.Discard, bytes.NewReader(truncated)); err == nil {
+		t.Error("expected truncated content to fail")
+	}
+}
+
+//  envelopes prior to chunking are sealed as a whole
+func TestVersion1(t *testing.T) {
+	c := &Crypter{Token: []byte("token"), Cost: 10}
+	text := []byte("Bite my shiny metal ass!")
+
+	e := crypto.NewEnvelope(crypto.XChaCha)
+	e.Version = 1
+	e.KDF = c.params()
+	e.KDF.Salt = []byte("0123456789abcdef")
+	e.Nonce = make([]byte, chacha20poly1305.NonceSizeX)
+
+	aead, err := c.aead(e.KDF)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aad, err := e.AAD()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.Ciphertext = aead.Seal(nil, e.Nonce, text, aad)
+	cypher, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Decrypt(cypher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(res, text) {
+		t.Errorf("want %q, got %q", text, res)
+	}
+}
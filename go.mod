@@ -1,21 +1,25 @@
 module github.com/manulife-gwam/peppermint-sparkles
 
-go 1.12
+go 1.19
 
 require (
-	github.com/boltdb/bolt v1.3.1 // indirect
+	filippo.io/age v1.1.1
 	github.com/coreos/bbolt v1.3.0
 	github.com/go-redis/redis v6.14.1+incompatible
 	github.com/google/uuid v1.1.1
-	github.com/kr/pretty v0.1.0 // indirect
-	github.com/onsi/ginkgo v1.12.0 // indirect
-	github.com/onsi/gomega v1.9.0 // indirect
+	github.com/miekg/pkcs11 v1.1.1
 	github.com/pkg/errors v0.8.1
 	github.com/sirupsen/logrus v1.4.2
-	github.com/stretchr/testify v1.5.1 // indirect
-	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
-	golang.org/x/net v0.0.0-20190311183353-d8887717615a // indirect
-	golang.org/x/sync v0.0.0-20190423024810-112230192c58 // indirect
-	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
+	golang.org/x/crypto v0.17.0
 	gopkg.in/urfave/cli.v2 v2.0.0-20180128182452-d3ae77c26ac8
 )
+
+require (
+	github.com/boltdb/bolt v1.3.1 // indirect
+	github.com/konsorten/go-windows-terminal-sequences v1.0.1 // indirect
+	github.com/onsi/ginkgo v1.12.0 // indirect
+	github.com/onsi/gomega v1.9.0 // indirect
+	github.com/stretchr/testify v1.5.1 // indirect
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
+)
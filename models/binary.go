@@ -0,0 +1,340 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+//  binaryCodec stores values as a sequence of numbered fields, each a uvarint
+//  key (the field number and wire type) followed by either a zigzag varint or
+//  length prefixed bytes. Unknown fields are skipped and zero values omitted,
+//  allowing fields to be added without breaking older readers.
+//
+//  Secret content is typically base64 encoded, ASCII armored PGP, so is stored
+//  decoded (and de-armored) whenever encoding it again reproduces the
+//  original exactly, roughly halving its size.
+type binaryCodec struct{}
+
+const (
+	wireVarint byte = 0
+	wireBytes  byte = 1
+)
+
+var (
+	recordMagic     []byte = []byte("\x00psr\x01")
+	historicalMagic []byte = []byte("\x00psh\x01")
+)
+
+//  record fields
+const (
+	recSchemaVersion int = iota + 1
+	recSecret
+	recCreated
+	recCreatedBy
+	recUpdated
+	recUpdatedBy
+	recStatus
+)
+
+//  secret fields, only one of the content fields is set
+const (
+	secId int = iota + 1
+	secApp
+	secEnv
+	secContent
+	secContentBase64
+	secContentPGP
+	secAlgorithm
+	secSignature
+)
+
+//  historical fields
+const (
+	histSchemaVersion int = iota + 1
+	histRecord
+	histAction
+	histCreated
+	histCreatedBy
+)
+
+func (binaryCodec) Name() string {
+	return "binary"
+}
+
+func (binaryCodec) Detect(raw []byte) bool {
+	return bytes.HasPrefix(raw, recordMagic) || bytes.HasPrefix(raw, historicalMagic)
+}
+
+func (binaryCodec) EncodeRecord(r *Record) ([]byte, error) {
+	w := &fieldWriter{}
+	w.buf.Write(recordMagic)
+	writeRecord(w, r)
+	return w.buf.Bytes(), nil
+}
+
+func (binaryCodec) DecodeRecord(raw []byte) (*Record, error) {
+	if !bytes.HasPrefix(raw, recordMagic) {
+		return nil, errors.New("value is not a binary record")
+	}
+	return readRecord(raw[len(recordMagic):])
+}
+
+func (binaryCodec) EncodeHistorical(h *Historical) ([]byte, error) {
+	w := &fieldWriter{}
+	w.buf.Write(historicalMagic)
+
+	w.varint(histSchemaVersion, int64(h.SchemaVersion))
+	if h.Record != nil {
+		rw := &fieldWriter{}
+		writeRecord(rw, h.Record)
+		w.field(histRecord, rw.buf.Bytes())
+	}
+	w.string(histAction, h.Action)
+	w.varint(histCreated, h.Created)
+	w.string(histCreatedBy, h.CreatedBy)
+
+	return w.buf.Bytes(), nil
+}
+
+func (binaryCodec) DecodeHistorical(raw []byte) (*Historical, error) {
+	if !bytes.HasPrefix(raw, historicalMagic) {
+		return nil, errors.New("value is not a binary historical")
+	}
+
+	h := &Historical{}
+	err := readFields(raw[len(historicalMagic):], func(field int, n int64, b []byte) error {
+		switch field {
+		case histSchemaVersion:
+			h.SchemaVersion = int(n)
+		case histRecord:
+			r, err := readRecord(b)
+			if err != nil {
+				return err
+			}
+			h.Record = r
+		case histAction:
+			h.Action = string(b)
+		case histCreated:
+			h.Created = n
+		case histCreatedBy:
+			h.CreatedBy = string(b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func writeRecord(w *fieldWriter, r *Record) {
+	w.varint(recSchemaVersion, int64(r.SchemaVersion))
+	if r.Secret != nil {
+		sw := &fieldWriter{}
+		sw.string(secId, r.Id)
+		sw.string(secApp, r.App)
+		sw.string(secEnv, r.Env)
+		sw.field(packContent(r.Content))
+		sw.string(secAlgorithm, r.Algorithm)
+		sw.string(secSignature, r.Signature)
+		w.field(recSecret, sw.buf.Bytes())
+	}
+	w.varint(recCreated, r.Created)
+	w.string(recCreatedBy, r.CreatedBy)
+	w.varint(recUpdated, r.Updated)
+	w.string(recUpdatedBy, r.UpdatedBy)
+	w.string(recStatus, r.Status)
+}
+
+func readRecord(raw []byte) (*Record, error) {
+	r := &Record{}
+	err := readFields(raw, func(field int, n int64, b []byte) error {
+		switch field {
+		case recSchemaVersion:
+			r.SchemaVersion = int(n)
+		case recSecret:
+			s, err := readSecret(b)
+			if err != nil {
+				return err
+			}
+			r.Secret = s
+		case recCreated:
+			r.Created = n
+		case recCreatedBy:
+			r.CreatedBy = string(b)
+		case recUpdated:
+			r.Updated = n
+		case recUpdatedBy:
+			r.UpdatedBy = string(b)
+		case recStatus:
+			r.Status = string(b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func readSecret(raw []byte) (*Secret, error) {
+	s := &Secret{}
+	err := readFields(raw, func(field int, n int64, b []byte) error {
+		switch field {
+		case secId:
+			s.Id = string(b)
+		case secApp:
+			s.App = string(b)
+		case secEnv:
+			s.Env = string(b)
+		case secContent:
+			s.Content = string(b)
+		case secContentBase64:
+			s.Content = base64.StdEncoding.EncodeToString(b)
+		case secContentPGP:
+			armored, err := rearmor(b)
+			if err != nil {
+				return err
+			}
+			s.Content = base64.StdEncoding.EncodeToString(armored)
+		case secAlgorithm:
+			s.Algorithm = string(b)
+		case secSignature:
+			s.Signature = string(b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+//  packContent returns the most compact field for the content which can be
+//  reversed to the exact original
+func packContent(content string) (int, []byte) {
+	decoded, err := base64.StdEncoding.DecodeString(content)
+	if err != nil || len(content) < 1 || base64.StdEncoding.EncodeToString(decoded) != content {
+		return secContent, []byte(content)
+	}
+
+	block, err := armor.Decode(bytes.NewReader(decoded))
+	if err != nil || block.Type != pgp.PGPMessageType || len(block.Header) > 0 {
+		return secContentBase64, decoded
+	}
+
+	body, err := ioutil.ReadAll(block.Body)
+	if err != nil {
+		return secContentBase64, decoded
+	}
+
+	if armored, err := rearmor(body); err != nil || !bytes.Equal(armored, decoded) {
+		return secContentBase64, decoded
+	}
+
+	return secContentPGP, body
+}
+
+func rearmor(body []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	w, err := armor.Encode(buf, pgp.PGPMessageType, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to armor content")
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return nil, errors.Wrap(err, "unable to armor content")
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, errors.Wrap(err, "unable to armor content")
+	}
+
+	return buf.Bytes(), nil
+}
+
+type fieldWriter struct {
+	buf bytes.Buffer
+	tmp [binary.MaxVarintLen64]byte
+}
+
+func (w *fieldWriter) key(field int, wire byte) {
+	n := binary.PutUvarint(w.tmp[:], uint64(field)<<1|uint64(wire))
+	w.buf.Write(w.tmp[:n])
+}
+
+func (w *fieldWriter) varint(field int, v int64) {
+	if v == 0 {
+		return
+	}
+
+	w.key(field, wireVarint)
+	n := binary.PutVarint(w.tmp[:], v)
+	w.buf.Write(w.tmp[:n])
+}
+
+func (w *fieldWriter) field(field int, b []byte) {
+	if len(b) < 1 {
+		return
+	}
+
+	w.key(field, wireBytes)
+	n := binary.PutUvarint(w.tmp[:], uint64(len(b)))
+	w.buf.Write(w.tmp[:n])
+	w.buf.Write(b)
+}
+
+func (w *fieldWriter) string(field int, s string) {
+	w.field(field, []byte(s))
+}
+
+//  readFields calls fn with each field, providing the value as n for varints
+//  or b for bytes
+func readFields(raw []byte, fn func(field int, n int64, b []byte) error) error {
+	for len(raw) > 0 {
+		key, kn := binary.Uvarint(raw)
+		if kn <= 0 {
+			return errors.New("invalid binary field key")
+		}
+		raw = raw[kn:]
+
+		field := int(key >> 1)
+		switch byte(key & 1) {
+		case wireVarint:
+			v, n := binary.Varint(raw)
+			if n <= 0 {
+				return errors.Errorf("invalid varint for binary field %d", field)
+			}
+			raw = raw[n:]
+
+			if err := fn(field, v, nil); err != nil {
+				return err
+			}
+
+		case wireBytes:
+			l, n := binary.Uvarint(raw)
+			if n <= 0 || uint64(len(raw)-n) < l {
+				return errors.Errorf("invalid length for binary field %d", field)
+			}
+			b := raw[n : n+int(l)]
+			raw = raw[n+int(l):]
+
+			if err := fn(field, 0, b); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
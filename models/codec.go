@@ -0,0 +1,109 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+//  Codec encodes records and historical entries for storage. Values are
+//  decoded by whichever codec detects them, so a datastore may hold values
+//  written by any registered codec (e.g. while converting between them).
+type Codec interface {
+	//  Name is the name the codec is selected by
+	Name() string
+
+	//  Detect reports if the raw value was encoded by the codec
+	Detect(raw []byte) bool
+
+	EncodeRecord(r *Record) ([]byte, error)
+	DecodeRecord(raw []byte) (*Record, error)
+
+	EncodeHistorical(h *Historical) ([]byte, error)
+	DecodeHistorical(raw []byte) (*Historical, error)
+}
+
+var (
+	//  JSON stores values as indented JSON, as written by all previous versions
+	JSON Codec = jsonCodec{}
+
+	//  Binary stores values in a compact binary form (see binaryCodec)
+	Binary Codec = binaryCodec{}
+
+	codecs = []Codec{JSON, Binary}
+
+	codecMu sync.RWMutex
+	active  Codec = JSON
+)
+
+//  CodecByName returns the codec registered with the name
+func CodecByName(name string) (Codec, error) {
+	for _, c := range codecs {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, errors.Errorf("%s is not a supported record codec", name)
+}
+
+//  SetCodec sets the codec used to encode all subsequent writes (JSON by
+//  default)
+func SetCodec(c Codec) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+
+	active = c
+}
+
+func activeCodec() Codec {
+	codecMu.RLock()
+	defer codecMu.RUnlock()
+
+	return active
+}
+
+//  detect returns the codec which encoded the raw value
+func detect(raw []byte) (Codec, error) {
+	for _, c := range codecs {
+		if c.Detect(raw) {
+			return c, nil
+		}
+	}
+	return nil, errors.New("unable to detect the encoding of the stored value")
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Detect(raw []byte) bool {
+	return bytes.HasPrefix(bytes.TrimLeft(raw, " \t\r\n"), []byte("{"))
+}
+
+func (jsonCodec) EncodeRecord(r *Record) ([]byte, error) {
+	return json.MarshalIndent(r, "", " ")
+}
+
+func (jsonCodec) DecodeRecord(raw []byte) (*Record, error) {
+	r := &Record{}
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (jsonCodec) EncodeHistorical(h *Historical) ([]byte, error) {
+	return json.MarshalIndent(h, "", " ")
+}
+
+func (jsonCodec) DecodeHistorical(raw []byte) (*Historical, error) {
+	h := &Historical{}
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto/pgp"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+func TestBinaryCodec(t *testing.T) {
+	armored, err := (&pgp.Crypter{Token: []byte("token")}).Encrypt([]byte("notSuperS3cret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "empty"},
+		{name: "plain", content: "notSuperS3cret"},
+		{name: "base64", content: base64.StdEncoding.EncodeToString([]byte("notSuperS3cret"))},
+		{name: "non canonical base64", content: "bm90U3VwZXJTM2NyZXV="},
+		{name: "pgp", content: string(armored)},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Record{
+				Secret: &Secret{
+					Id:        uuid.New().String(),
+					App:       "dummy",
+					Env:       "test",
+					Content:   tc.content,
+					Algorithm: "pgp",
+					Signature: "ed25519:0123456789abcdef:c2lnbmF0dXJl",
+				},
+				SchemaVersion: SchemaVersion,
+				Created:       1534474065732344471,
+				CreatedBy:     "tester",
+				Updated:       -1,
+				Status:        ActiveStatus,
+			}
+
+			raw, err := Binary.EncodeRecord(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c, err := detect(raw); err != nil || c != Binary {
+				t.Fatalf("want binary codec detected, got %v with error %v", c, err)
+			}
+
+			got, err := ParseRecord(string(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := r.MustString(), got.MustString(); want != got {
+				t.Errorf("\nwant %s\ngot  %s", want, got)
+			}
+
+			h := &Historical{Record: r, SchemaVersion: SchemaVersion, Action: CreateAction, Created: r.Created, CreatedBy: "tester"}
+			if raw, err = Binary.EncodeHistorical(h); err != nil {
+				t.Fatal(err)
+			}
+
+			gotH, err := ParseHistorical(string(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := h.MustString(), gotH.MustString(); want != got {
+				t.Errorf("\nwant %s\ngot  %s", want, got)
+			}
+		})
+	}
+
+	//	armored content should be stored at roughly half the size
+	r := &Record{Secret: &Secret{Content: string(armored)}}
+	raw, err := Binary.EncodeRecord(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if max := len(armored) * 2 / 3; len(raw) > max {
+		t.Errorf("want binary record of at most %d bytes, got %d", max, len(raw))
+	}
+
+	if _, err := Binary.DecodeRecord(raw[:len(raw)-1]); err == nil {
+		t.Error("want error for a truncated binary record")
+	}
+}
+
+func TestMixedCodecs(t *testing.T) {
+	defer SetCodec(JSON)
+
+	tmpRepo := fmt.Sprintf("test_%s.db", uuid.New().String())
+
+	ds, err := fileds.Open(tmpRepo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(ds *fileds.Datastore) {
+		ds.Close()
+		if err := os.RemoveAll(tmpRepo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", tmpRepo)
+		}
+	}(ds)
+
+	ctx := context.Background()
+
+	records := make([]*Record, 0)
+	for _, c := range []Codec{JSON, Binary} {
+		SetCodec(c)
+
+		r := &Record{
+			Secret: &Secret{
+				Id:      uuid.New().String(),
+				App:     "dummy",
+				Env:     c.Name(),
+				Content: "notSuperS3cret",
+			},
+			Created:   1534474065732344471,
+			CreatedBy: "tester",
+			Status:    ActiveStatus,
+		}
+
+		if err := r.Create(ctx, ds); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+
+	for _, r := range records {
+		got, err := GetRecord(ctx, ds, r.App, r.Env, r.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := r.MustString(), got.MustString(); want != got {
+			t.Errorf("\nwant %s\ngot  %s", want, got)
+		}
+	}
+
+	//	converts the JSON record and historical to binary
+	n, err := MigrateSchema(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("want 2 entries converted, got %d", n)
+	}
+
+	vals, err := backend.Collect(ds.Iterate(ctx, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vals {
+		for k, raw := range v {
+			if !Binary.Detect([]byte(raw)) {
+				t.Errorf("want binary record for key %s", k)
+			}
+		}
+	}
+}
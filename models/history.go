@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/manulife-gwam/peppermint-sparkles/backend"
@@ -12,16 +13,66 @@ const (
 	CreateAction string = "create"
 	UpdateAction string = "update"
 	DeleteAction string = "delete"
+
+	//  RotateAction is an update re-encrypting the content with new keys
+	RotateAction string = "rotate"
 )
 
 type Historical struct {
 	*Record `json:"record"`
 
+	//  SchemaVersion is set to the current version when written, separately
+	//  from the version of the record (see SchemaVersion)
+	SchemaVersion int `json:"schema_version"`
+
 	Action    string `json:"action"`
 	Created   int64  `json:"created"`
 	CreatedBy string `json:"created_by"`
 }
 
+//  ParseHistorical parses the raw historical as encoded by any codec, migrating
+//  it (and the record within it) to the current schema version if stored by a
+//  previous version
+func ParseHistorical(raw string) (*Historical, error) {
+	h, _, err := parseHistorical([]byte(raw))
+	return h, err
+}
+
+//  parseHistorical parses the raw historical, reporting if it was migrated
+func parseHistorical(raw []byte) (*Historical, bool, error) {
+	c, err := detect(raw)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to parse raw historical")
+	}
+
+	h, err := c.DecodeHistorical(raw)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to parse raw historical")
+	}
+
+	if h.SchemaVersion == SchemaVersion && (h.Record == nil || h.Record.SchemaVersion == SchemaVersion) {
+		return h, false, nil
+	}
+
+	//  migrations are made against the JSON form
+	if c != JSON {
+		if raw, err = json.Marshal(h); err != nil {
+			return nil, false, errors.Wrap(err, "unable to prep historical for upgrade")
+		}
+	}
+
+	up, err := upgradeHistorical(raw)
+	if err != nil {
+		return nil, false, err
+	}
+
+	h = &Historical{}
+	if err := json.Unmarshal(up, &h); err != nil {
+		return nil, false, errors.Wrap(err, "unable to parse upgraded historical")
+	}
+	return h, true, nil
+}
+
 func FromCurrent(what string) (*Historical, error) {
 	r, err := ParseRecord(what)
 	if err != nil {
@@ -31,21 +82,50 @@ func FromCurrent(what string) (*Historical, error) {
 	return &Historical{Record: r}, nil
 }
 
-func (h *Historical) Write(where backend.Datastore, why, who string, when int64) error {
+//  prep sets the action details of the historical, returning the content ready
+//  for storage
+func (h *Historical) prep(why, who string, when int64) ([]byte, error) {
 	h.Action = why
 	h.CreatedBy = who
 	h.Created = when
 
-	out, err := h.String()
+	out, err := h.encode()
 	if err != nil {
-		return errors.Wrap(err, "unable to prep historical for storage")
+		return nil, errors.Wrap(err, "unable to prep historical for storage")
 	}
 
-	return where.AddHistory(out)
+	return out, nil
+}
+
+func (h *Historical) Write(ctx context.Context, where backend.Datastore, why, who string, when int64) error {
+	out, err := h.prep(why, who, when)
+	if err != nil {
+		return err
+	}
+
+	return where.AddHistory(ctx, h.Key(), out)
+}
+
+//  stamped returns a copy of the historical (and the record within it) at the
+//  current schema version
+func (h *Historical) stamped() *Historical {
+	c := *h
+	c.SchemaVersion = SchemaVersion
+	if h.Record != nil {
+		c.Record = h.Record.stamped()
+	}
+	return &c
+}
+
+//  encode returns the historical as stored, i.e. at the current schema version
+//  and encoded by the active codec (see SetCodec)
+func (h *Historical) encode() ([]byte, error) {
+	return activeCodec().EncodeHistorical(h.stamped())
 }
 
+//  String returns the historical as JSON at the current schema version
 func (h *Historical) String() (string, error) {
-	out, err := json.MarshalIndent(h, "", " ")
+	out, err := json.MarshalIndent(h.stamped(), "", " ")
 	if err != nil {
 		return "", err
 	}
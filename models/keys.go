@@ -0,0 +1,122 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+
+	"github.com/pkg/errors"
+)
+
+//  RekeyRecords migrates the records and history stored under the raw secret ID
+//  (or any key not matching the namespaced key) to the key generated from the
+//  app, environment, and ID of the record. Entries already stored under the
+//  namespaced key are left untouched, allowing the migration to be re-run. The
+//  number of records and historical entries migrated is returned.
+func RekeyRecords(ctx context.Context, ds backend.Datastore) (int, error) {
+	n, err := rekeyRecords(ctx, ds)
+	if err != nil {
+		return n, err
+	}
+
+	h, err := rekeyHistory(ctx, ds)
+	return n + h, err
+}
+
+func rekeyRecords(ctx context.Context, ds backend.Datastore) (int, error) {
+	//  collect the keys prior to migrating to avoid modifying the datastore
+	//  while iterating
+	keys, err := backend.CollectKeys(ds.Iterate(ctx, ""))
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to retrieve record keys")
+	}
+
+	var n int
+	for _, k := range keys {
+		raw, err := ds.Get(ctx, k)
+		if err != nil {
+			if backend.IsNotFound(err) {
+				continue
+			}
+			return n, errors.Wrapf(err, "unable to retrieve record for key %s", k)
+		}
+
+		r, err := ParseRecord(string(raw))
+		if err != nil {
+			return n, errors.Wrapf(err, "unable to parse record for key %s", k)
+		}
+
+		if r.Secret == nil {
+			return n, errors.Errorf("record for key %s has no secret", k)
+		}
+
+		key := r.Key()
+		if key == k {
+			continue
+		}
+
+		//  an identical record under the new key means a previous run was
+		//  interrupted prior to removing the old key
+		if err := ds.SetIfAbsent(ctx, key, raw, nil); err != nil {
+			if !backend.IsExists(err) {
+				return n, errors.Wrapf(err, "unable to write record for ID %s", r.Id)
+			}
+
+			cur, err := ds.Get(ctx, key)
+			if err != nil {
+				return n, errors.Wrapf(err, "unable to retrieve existing record for ID %s", r.Id)
+			}
+
+			if !bytes.Equal(cur, raw) {
+				return n, errors.Errorf("a different record already exists for ID %s", r.Id)
+			}
+		}
+
+		if err := ds.CompareAndSwap(ctx, k, raw, nil, nil); err != nil {
+			return n, errors.Wrapf(err, "unable to remove record for key %s", k)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+func rekeyHistory(ctx context.Context, ds backend.Datastore) (int, error) {
+	vals, err := backend.Collect(ds.IterateHistory(ctx, ""))
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to retrieve history")
+	}
+
+	var n int
+	for _, v := range vals {
+		for hkey, raw := range v {
+			h, err := ParseHistorical(raw)
+			if err != nil {
+				return n, errors.Wrapf(err, "unable to parse historical for key %s", hkey)
+			}
+
+			if h.Record == nil || h.Secret == nil {
+				return n, errors.Errorf("historical for key %s has no secret", hkey)
+			}
+
+			//  historical keys are in the form <record key>.<hash>
+			key := h.Key()
+			if strings.HasPrefix(hkey, key+".") {
+				continue
+			}
+
+			if err := ds.AddHistory(ctx, key, []byte(raw)); err != nil {
+				return n, errors.Wrapf(err, "unable to write historical for ID %s", h.Id)
+			}
+
+			if err := ds.RemoveHistory(ctx, hkey); err != nil {
+				return n, errors.Wrapf(err, "unable to remove historical for key %s", hkey)
+			}
+			n++
+		}
+	}
+
+	return n, nil
+}
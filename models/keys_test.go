@@ -0,0 +1,137 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+func TestRekeyRecords(t *testing.T) {
+	tmpRepo := fmt.Sprintf("test_%s.db", uuid.New().String())
+
+	ds, err := fileds.Open(tmpRepo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(ds *fileds.Datastore) {
+		ds.Close()
+		if err := os.RemoveAll(tmpRepo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", tmpRepo)
+		}
+	}(ds)
+
+	ctx, now := context.Background(), time.Now().UnixNano()
+
+	r := &Record{
+		Secret: &Secret{
+			Id:      uuid.New().String(),
+			App:     "dummy",
+			Env:     "test",
+			Content: "notSuperS3cret",
+		},
+		Created:   now,
+		CreatedBy: "tester",
+		Updated:   now,
+		UpdatedBy: "tester",
+		Status:    ActiveStatus,
+	}
+
+	//  write the record and history under the legacy raw ID
+	raw, err := r.String()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.Set(ctx, r.Id, []byte(raw)); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := (&Historical{Record: r}).prep(CreateAction, "tester", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ds.AddHistory(ctx, r.Id, h); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := RekeyRecords(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("want 2 migrated entries, got %d", n)
+	}
+
+	if _, err := ds.Get(ctx, r.Id); !backend.IsNotFound(err) {
+		t.Errorf("want legacy key to be removed, got %v", err)
+	}
+
+	got, err := GetRecord(ctx, ds, r.App, r.Env, r.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := raw, got.MustString(); want != got {
+		t.Errorf("want: %s\n\ngot: %s", want, got)
+	}
+
+	hkeys, err := backend.CollectKeys(ds.IterateHistory(ctx, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hkeys) != 1 || !strings.HasPrefix(hkeys[0], r.Key()+".") {
+		t.Errorf("want a single historical entry for key %s, got %v", r.Key(), hkeys)
+	}
+
+	//  re-running should be a no-op
+	if n, err := RekeyRecords(ctx, ds); err != nil || n != 0 {
+		t.Errorf("want no migrated entries on re-run, got %d with error %v", n, err)
+	}
+}
+
+func TestRekeyNoSecret(t *testing.T) {
+	tmpRepo := fmt.Sprintf("test_%s.db", uuid.New().String())
+
+	ds, err := fileds.Open(tmpRepo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(ds *fileds.Datastore) {
+		ds.Close()
+		if err := os.RemoveAll(tmpRepo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", tmpRepo)
+		}
+	}(ds)
+
+	ctx := context.Background()
+
+	//  a record without a secret must fail the migration rather than end it
+	//  early as though it had completed
+	if err := ds.Set(ctx, "legacy", []byte(`{"status":"active"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RekeyRecords(ctx, ds); err == nil || !strings.Contains(err.Error(), "has no secret") {
+		t.Errorf("want an error for a record without a secret, got %v", err)
+	}
+
+	if err := ds.AddHistory(ctx, "legacy", []byte(`{"action":"create"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rekeyHistory(ctx, ds); err == nil || !strings.Contains(err.Error(), "has no secret") {
+		t.Errorf("want an error for a historical entry without a secret, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/manulife-gwam/peppermint-sparkles/backend"
@@ -17,6 +18,10 @@ const (
 type Record struct {
 	*Secret `json:"secret"`
 
+	//  SchemaVersion is set to the current version when written (see
+	//  SchemaVersion)
+	SchemaVersion int `json:"schema_version"`
+
 	Created   int64  `json:"created"`
 	CreatedBy string `json:"created_by"`
 	Updated   int64  `json:"updated"`
@@ -24,32 +29,161 @@ type Record struct {
 	Status    string `json:"status"`
 }
 
+//  ParseRecord parses the raw record as encoded by any codec, migrating it to
+//  the current schema version if stored by a previous version
 func ParseRecord(raw string) (*Record, error) {
-	r := &Record{}
-	if err := json.Unmarshal([]byte(raw), &r); err != nil {
-		return nil, errors.Wrap(err, "unable to parse raw record")
+	r, _, err := parseRecord([]byte(raw))
+	return r, err
+}
+
+//  parseRecord parses the raw record, reporting if it was migrated
+func parseRecord(raw []byte) (*Record, bool, error) {
+	c, err := detect(raw)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to parse raw record")
+	}
+
+	r, err := c.DecodeRecord(raw)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "unable to parse raw record")
+	}
+
+	if r.SchemaVersion == SchemaVersion {
+		return r, false, nil
+	}
+
+	//  migrations are made against the JSON form
+	if c != JSON {
+		if raw, err = json.Marshal(r); err != nil {
+			return nil, false, errors.Wrap(err, "unable to prep record for upgrade")
+		}
+	}
+
+	up, err := upgradeRecord(raw)
+	if err != nil {
+		return nil, false, err
 	}
-	return r, nil
+
+	r = &Record{}
+	if err := json.Unmarshal(up, &r); err != nil {
+		return nil, false, errors.Wrap(err, "unable to parse upgraded record")
+	}
+	return r, true, nil
+}
+
+//  GetRecord retrieves and parses the record stored for the provided app,
+//  environment, and ID. If no record exists, the returned error will be a
+//  backend.ErrNotFound.
+func GetRecord(ctx context.Context, from backend.Datastore, app, env, id string) (*Record, error) {
+	raw, err := from.Get(ctx, backend.Key(app, env, id))
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseRecord(string(raw))
 }
 
-func (r *Record) Exists(in backend.Datastore) bool {
-	return len(in.Get(r.Secret.Id)) > 0
+//  Key returns the namespaced storage key for the record
+func (r *Record) Key() string {
+	return backend.Key(r.Secret.App, r.Secret.Env, r.Secret.Id)
 }
 
-func (r *Record) Write(where backend.Datastore) error {
-	out, err := r.String()
+func (r *Record) Exists(ctx context.Context, in backend.Datastore) (bool, error) {
+	if _, err := in.Get(ctx, r.Key()); err != nil {
+		if backend.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *Record) Write(ctx context.Context, where backend.Datastore) error {
+	out, err := r.encode()
 	if err != nil {
 		return errors.Wrap(err, "unable to prep record for storage")
 	}
-	return where.Set(r.Secret.Id, out)
+	return where.Set(ctx, r.Key(), out)
+}
+
+func (r *Record) Rm(ctx context.Context, from backend.Datastore) error {
+	return from.Remove(ctx, r.Key())
+}
+
+//  Create atomically writes the record along with a create historical entry,
+//  only if no record currently exists for the ID. If one does, the returned
+//  error will be a backend.ErrExists.
+func (r *Record) Create(ctx context.Context, where backend.Datastore) error {
+	out, err := r.encode()
+	if err != nil {
+		return errors.Wrap(err, "unable to prep record for storage")
+	}
+
+	histo, err := (&Historical{Record: r}).prep(CreateAction, r.CreatedBy, r.Created)
+	if err != nil {
+		return err
+	}
+
+	return where.SetIfAbsent(ctx, r.Key(), out, histo)
+}
+
+//  Update atomically replaces the stored record along with an update
+//  historical entry, only if the stored record still matches the previously
+//  retrieved raw content. If not, the returned error will be a
+//  backend.ErrConflict.
+func (r *Record) Update(ctx context.Context, where backend.Datastore, prev []byte) error {
+	return r.replace(ctx, where, prev, UpdateAction)
+}
+
+//  Rotate is an Update recording the rotate action in the history, for content
+//  re-encrypted with new keys
+func (r *Record) Rotate(ctx context.Context, where backend.Datastore, prev []byte) error {
+	return r.replace(ctx, where, prev, RotateAction)
+}
+
+func (r *Record) replace(ctx context.Context, where backend.Datastore, prev []byte, action string) error {
+	out, err := r.encode()
+	if err != nil {
+		return errors.Wrap(err, "unable to prep record for storage")
+	}
+
+	histo, err := (&Historical{Record: r}).prep(action, r.UpdatedBy, r.Updated)
+	if err != nil {
+		return err
+	}
+
+	return where.CompareAndSwap(ctx, r.Key(), prev, out, histo)
+}
+
+//  Delete atomically removes the stored record along with writing a delete
+//  historical entry, only if the stored record still matches the previously
+//  retrieved raw content. If not, the returned error will be a
+//  backend.ErrConflict.
+func (r *Record) Delete(ctx context.Context, from backend.Datastore, prev []byte, who string, when int64) error {
+	histo, err := (&Historical{Record: r}).prep(DeleteAction, who, when)
+	if err != nil {
+		return err
+	}
+
+	return from.CompareAndSwap(ctx, r.Key(), prev, nil, histo)
+}
+
+//  stamped returns a copy of the record at the current schema version
+func (r *Record) stamped() *Record {
+	c := *r
+	c.SchemaVersion = SchemaVersion
+	return &c
 }
 
-func (r *Record) Rm(from backend.Datastore) error {
-	return from.Remove(r.Secret.Id)
+//  encode returns the record as stored, i.e. at the current schema version
+//  and encoded by the active codec (see SetCodec)
+func (r *Record) encode() ([]byte, error) {
+	return activeCodec().EncodeRecord(r.stamped())
 }
 
+//  String returns the record as JSON at the current schema version
 func (r *Record) String() (string, error) {
-	out, err := json.MarshalIndent(r, "", " ")
+	out, err := json.MarshalIndent(r.stamped(), "", " ")
 	if err != nil {
 		return "", err
 	}
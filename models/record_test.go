@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -19,6 +20,7 @@ func TestRecord(t *testing.T) {
   "env": "test",
   "content": "notSuperS3cret"
  },
+ "schema_version": 1,
  "created": 1534474065732344471,
  "created_by": "tester",
  "updated": 1534474065732344471,
@@ -51,18 +53,28 @@ func TestRecord(t *testing.T) {
 	}
 
 	// tests writing of record to datastore
-	if err := r.Write(ds); err != nil {
+	if err := r.Write(context.Background(), ds); err != nil {
 		t.Fatal(err)
 	}
 
 	// tests a valid records existence
-	if !r.Exists(ds) {
+	exists, err := r.Exists(context.Background(), ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !exists {
 		t.Error("failed to verify test item written")
 	}
 
 	// tests a valid records existence
 	invalid := &Record{Secret: &Secret{Id: "invalid_not_real_id"}}
-	if invalid.Exists(ds) {
+	exists, err = invalid.Exists(context.Background(), ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exists {
 		t.Error("found invalid record")
 	}
 }
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+//  Retention is the policy for how much history to keep per record. A zero
+//  value for either limit means no limit.
+type Retention struct {
+	//  Versions is the max number of historical entries kept per record
+	Versions int
+
+	//  MaxAge is the max age of the historical entries kept per record. The
+	//  most recent entry is always kept regardless of its age, so the last
+	//  action taken on every record (including deletes) remains known.
+	MaxAge time.Duration
+}
+
+//  Enabled reports if the policy limits the history kept
+func (p *Retention) Enabled() bool {
+	return p.Versions > 0 || p.MaxAge > 0
+}
+
+type stamped struct {
+	hkey    string
+	created int64
+}
+
+//  Compact removes the historical entries not retained by the policy,
+//  returning the number removed. Entries are ordered by their created time, so
+//  the datastore must provide the values as written (i.e. decrypted). Entries
+//  which can not be parsed are logged and kept.
+func (p *Retention) Compact(ctx context.Context, ds backend.Datastore) (int, error) {
+	if !p.Enabled() {
+		return 0, nil
+	}
+
+	//  collect the keys and created times prior to removing entries to avoid
+	//  modifying the datastore while iterating
+	byRecord := make(map[string][]stamped)
+
+	it := ds.IterateHistory(ctx, "")
+	for it.Next() {
+		h, _, err := parseHistorical(it.Value())
+		if err != nil {
+			log.Warnf("unable to parse historical for key %s, it will be kept: %v", it.Key(), err)
+			continue
+		}
+
+		key := backend.HistoryRecordKey(it.Key())
+		byRecord[key] = append(byRecord[key], stamped{hkey: it.Key(), created: h.Created})
+	}
+	it.Close()
+
+	if err := it.Err(); err != nil {
+		return 0, errors.Wrap(err, "unable to retrieve history")
+	}
+
+	var cutoff int64
+	if p.MaxAge > 0 {
+		cutoff = time.Now().Add(-p.MaxAge).UnixNano()
+	}
+
+	var n int
+	for _, entries := range byRecord {
+		//  newest first
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].created > entries[j].created
+		})
+
+		for i, e := range entries {
+			if i == 0 {
+				continue
+			}
+
+			if (p.Versions < 1 || i < p.Versions) && (cutoff == 0 || e.created >= cutoff) {
+				continue
+			}
+
+			if err := ds.RemoveHistory(ctx, e.hkey); err != nil {
+				return n, errors.Wrapf(err, "unable to remove historical for key %s", e.hkey)
+			}
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+func TestRetention(t *testing.T) {
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name   string
+		policy *Retention
+		want   int
+	}{
+		{name: "disabled", policy: &Retention{}, want: 5},
+		{name: "versions", policy: &Retention{Versions: 2}, want: 2},
+		{name: "max age", policy: &Retention{MaxAge: 3 * day}, want: 3},
+		{name: "both", policy: &Retention{Versions: 2, MaxAge: 3 * day}, want: 2},
+		{name: "newest is kept", policy: &Retention{MaxAge: time.Hour}, want: 1},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpRepo := fmt.Sprintf("test_%s.db", uuid.New().String())
+
+			ds, err := fileds.Open(tmpRepo, bolt.DefaultOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer func(ds *fileds.Datastore) {
+				ds.Close()
+				if err := os.RemoveAll(tmpRepo); err != nil {
+					t.Errorf("unable to remove temporary test repo %s\n", tmpRepo)
+				}
+			}(ds)
+
+			ctx, now := context.Background(), time.Now()
+
+			r := &Record{
+				Secret: &Secret{
+					Id:      uuid.New().String(),
+					App:     "dummy",
+					Env:     "test",
+					Content: "notSuperS3cret",
+				},
+				Status: ActiveStatus,
+			}
+
+			//	an entry per day, the newest being a day old
+			for i := 1; i <= 5; i++ {
+				h := &Historical{Record: r}
+				when := now.Add(-time.Duration(i) * day).Add(time.Minute).UnixNano()
+				if err := h.Write(ctx, ds, UpdateAction, "tester", when); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if _, err := tc.policy.Compact(ctx, ds); err != nil {
+				t.Fatal(err)
+			}
+
+			vals, err := backend.Collect(ds.IterateHistory(ctx, r.Key()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(vals) != tc.want {
+				t.Fatalf("want %d historical entries, got %d", tc.want, len(vals))
+			}
+
+			//	the newest entry must always remain
+			var newest int64
+			for _, v := range vals {
+				for _, raw := range v {
+					h, err := ParseHistorical(raw)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					if h.Created > newest {
+						newest = h.Created
+					}
+				}
+			}
+
+			if want := now.Add(-day).Add(time.Minute).UnixNano(); newest != want {
+				t.Errorf("want newest entry created at %d, got %d", want, newest)
+			}
+		})
+	}
+}
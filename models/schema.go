@@ -0,0 +1,242 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+
+	"github.com/pkg/errors"
+)
+
+//  SchemaVersion is the version of the record and historical schema written.
+//  Anything stored prior to versioning is version 0.
+const SchemaVersion int = 1
+
+const schemaField string = "schema_version"
+
+//  Migration upgrades a stored record or historical, in its generic JSON form
+//  (with numbers as json.Numbers), from one schema version to the next. The schema version of the document is
+//  set once the migration returns.
+type Migration func(doc map[string]interface{}) error
+
+var (
+	recordMigrations     = make(map[int]Migration)
+	historicalMigrations = make(map[int]Migration)
+)
+
+//  RegisterRecordMigration registers the migration of records from the schema
+//  version to the next. It panics if a migration is already registered for the
+//  version.
+func RegisterRecordMigration(from int, m Migration) {
+	register(recordMigrations, from, m)
+}
+
+//  RegisterHistoricalMigration registers the migration of historical entries
+//  from the schema version to the next. The record within the historical is
+//  migrated separately by the record migrations. It panics if a migration is
+//  already registered for the version.
+func RegisterHistoricalMigration(from int, m Migration) {
+	register(historicalMigrations, from, m)
+}
+
+func register(migrations map[int]Migration, from int, m Migration) {
+	if _, ok := migrations[from]; ok {
+		panic(fmt.Sprintf("models: migration already registered from schema version %d", from))
+	}
+	migrations[from] = m
+}
+
+func init() {
+	//  version 1 only introduced the schema version
+	noop := func(doc map[string]interface{}) error { return nil }
+
+	RegisterRecordMigration(0, noop)
+	RegisterHistoricalMigration(0, noop)
+}
+
+//  upgrade applies the migrations to the document until it is at the version,
+//  reporting if any were applied
+func upgrade(doc map[string]interface{}, migrations map[int]Migration, to int) (bool, error) {
+	var from int
+	if v, ok := doc[schemaField]; ok {
+		n, ok := v.(json.Number)
+		if !ok {
+			return false, errors.Errorf("invalid schema version %v", v)
+		}
+
+		i, err := n.Int64()
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid schema version %v", v)
+		}
+		from = int(i)
+	}
+
+	if from > to {
+		return false, errors.Errorf("schema version %d is newer than the supported version %d", from, to)
+	}
+
+	for v := from; v < to; v++ {
+		m, ok := migrations[v]
+		if !ok {
+			return false, errors.Errorf("no migration registered from schema version %d", v)
+		}
+
+		if err := m(doc); err != nil {
+			return false, errors.Wrapf(err, "unable to migrate from schema version %d", v)
+		}
+		doc[schemaField] = json.Number(strconv.Itoa(v + 1))
+	}
+
+	return from < to, nil
+}
+
+//  decode parses the raw document, keeping numbers as json.Numbers to avoid
+//  losing the precision of timestamps
+func decode(raw []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	doc := make(map[string]interface{})
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+//  upgradeRecord migrates the raw record to the current schema version
+func upgradeRecord(raw []byte) ([]byte, error) {
+	doc, err := decode(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse raw record")
+	}
+
+	if _, err := upgrade(doc, recordMigrations, SchemaVersion); err != nil {
+		return nil, errors.Wrap(err, "unable to upgrade record")
+	}
+
+	return json.Marshal(doc)
+}
+
+//  upgradeHistorical migrates the raw historical and the record within it to
+//  the current schema version
+func upgradeHistorical(raw []byte) ([]byte, error) {
+	doc, err := decode(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse raw historical")
+	}
+
+	if rec, ok := doc["record"].(map[string]interface{}); ok {
+		if _, err := upgrade(rec, recordMigrations, SchemaVersion); err != nil {
+			return nil, errors.Wrap(err, "unable to upgrade historical record")
+		}
+	}
+
+	if _, err := upgrade(doc, historicalMigrations, SchemaVersion); err != nil {
+		return nil, errors.Wrap(err, "unable to upgrade historical")
+	}
+
+	return json.Marshal(doc)
+}
+
+//  MigrateSchema rewrites every record and historical entry stored prior to
+//  the current schema version or by a codec other than the active one (see
+//  SetCodec), returning the number rewritten. Records are
+//  migrated on read regardless, so this is only needed prior to removing a
+//  migration or to have other tools see the current schema. Records modified
+//  while migrating are skipped since they will have been rewritten by the
+//  write, allowing the migration to be run against a live datastore and
+//  safely re-run.
+func MigrateSchema(ctx context.Context, ds backend.Datastore) (int, error) {
+	n, err := migrateRecords(ctx, ds)
+	if err != nil {
+		return n, err
+	}
+
+	h, err := migrateHistory(ctx, ds)
+	return n + h, err
+}
+
+func migrateRecords(ctx context.Context, ds backend.Datastore) (int, error) {
+	//  collect the keys prior to migrating to avoid modifying the datastore
+	//  while iterating
+	keys, err := backend.CollectKeys(ds.Iterate(ctx, ""))
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to retrieve record keys")
+	}
+
+	var n int
+	for _, k := range keys {
+		raw, err := ds.Get(ctx, k)
+		if err != nil {
+			if backend.IsNotFound(err) {
+				continue
+			}
+			return n, errors.Wrapf(err, "unable to retrieve record for key %s", k)
+		}
+
+		r, upgraded, err := parseRecord(raw)
+		if err != nil {
+			return n, errors.Wrapf(err, "unable to parse record for key %s", k)
+		}
+
+		if !upgraded && activeCodec().Detect(raw) {
+			continue
+		}
+
+		out, err := r.encode()
+		if err != nil {
+			return n, errors.Wrapf(err, "unable to prep record for key %s", k)
+		}
+
+		if err := ds.CompareAndSwap(ctx, k, raw, out, nil); err != nil {
+			if backend.IsConflict(err) {
+				continue
+			}
+			return n, errors.Wrapf(err, "unable to rewrite record for key %s", k)
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+func migrateHistory(ctx context.Context, ds backend.Datastore) (int, error) {
+	vals, err := backend.Collect(ds.IterateHistory(ctx, ""))
+	if err != nil {
+		return 0, errors.Wrap(err, "unable to retrieve history")
+	}
+
+	var n int
+	for _, v := range vals {
+		for hkey, raw := range v {
+			h, upgraded, err := parseHistorical([]byte(raw))
+			if err != nil {
+				return n, errors.Wrapf(err, "unable to parse historical for key %s", hkey)
+			}
+
+			if !upgraded && activeCodec().Detect([]byte(raw)) {
+				continue
+			}
+
+			out, err := h.encode()
+			if err != nil {
+				return n, errors.Wrapf(err, "unable to prep historical for key %s", hkey)
+			}
+
+			if err := ds.AddHistory(ctx, backend.HistoryRecordKey(hkey), out); err != nil {
+				return n, errors.Wrapf(err, "unable to rewrite historical for key %s", hkey)
+			}
+
+			if err := ds.RemoveHistory(ctx, hkey); err != nil {
+				return n, errors.Wrapf(err, "unable to remove historical for key %s", hkey)
+			}
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+const legacyRecord string = `{
+ "secret": {
+  "id": "6f0f9805-08c6-48f2-b3c4-fe8e7c35ea4a",
+  "app_name": "dummy",
+  "env": "test",
+  "content": "notSuperS3cret"
+ },
+ "created": 1534474065732344471,
+ "created_by": "tester",
+ "updated": 1534474065732344471,
+ "updated_by": "tester",
+ "status": "active"
+}`
+
+func TestParseLegacy(t *testing.T) {
+	r, err := ParseRecord(legacyRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.SchemaVersion != SchemaVersion {
+		t.Errorf("want schema version %d, got %d", SchemaVersion, r.SchemaVersion)
+	}
+
+	//	timestamps must survive the migration intact
+	if want := int64(1534474065732344471); r.Created != want || r.Updated != want {
+		t.Errorf("want created / updated %d, got %d / %d", want, r.Created, r.Updated)
+	}
+
+	h, err := ParseHistorical(fmt.Sprintf(`{"record": %s, "action": "create", "created": 1534474065732344471}`, legacyRecord))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.SchemaVersion != SchemaVersion || h.Record.SchemaVersion != SchemaVersion {
+		t.Errorf("want schema version %d, got %d with record %d", SchemaVersion, h.SchemaVersion, h.Record.SchemaVersion)
+	}
+
+	future := strings.Replace(legacyRecord, `"status"`, fmt.Sprintf(`"schema_version": %d, "status"`, SchemaVersion+1), 1)
+	if _, err := ParseRecord(future); err == nil {
+		t.Error("want error for a newer schema version")
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	migrations := map[int]Migration{
+		0: func(doc map[string]interface{}) error {
+			doc["name"] = doc["title"]
+			delete(doc, "title")
+			return nil
+		},
+		1: func(doc map[string]interface{}) error {
+			doc["labels"] = []string{"migrated"}
+			return nil
+		},
+	}
+
+	doc, err := decode([]byte(`{"title": "foo"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	upgraded, err := upgrade(doc, migrations, 2)
+	if err != nil || !upgraded {
+		t.Fatalf("want upgraded, got %t with error %v", upgraded, err)
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := `{"labels":["migrated"],"name":"foo","schema_version":2}`, string(out); want != got {
+		t.Errorf("\nwant %s\ngot  %s", want, got)
+	}
+
+	if upgraded, err := upgrade(doc, migrations, 2); err != nil || upgraded {
+		t.Errorf("want no upgrade, got %t with error %v", upgraded, err)
+	}
+
+	if _, err := upgrade(doc, migrations, 3); err == nil {
+		t.Error("want error for a missing migration")
+	}
+}
+
+func TestMigrateSchema(t *testing.T) {
+	tmpRepo := fmt.Sprintf("test_%s.db", uuid.New().String())
+
+	ds, err := fileds.Open(tmpRepo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(ds *fileds.Datastore) {
+		ds.Close()
+		if err := os.RemoveAll(tmpRepo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", tmpRepo)
+		}
+	}(ds)
+
+	ctx := context.Background()
+	key := backend.Key("dummy", "test", "6f0f9805-08c6-48f2-b3c4-fe8e7c35ea4a")
+
+	legacyHistorical := fmt.Sprintf(`{"record": %s, "action": "create", "created": 1534474065732344471}`, legacyRecord)
+	if err := ds.SetIfAbsent(ctx, key, []byte(legacyRecord), []byte(legacyHistorical)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := MigrateSchema(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 2 {
+		t.Errorf("want 2 entries migrated, got %d", n)
+	}
+
+	raw, err := ds.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(raw), `"schema_version": 1`) {
+		t.Errorf("want the stored record at schema version 1, got %s", raw)
+	}
+
+	vals, err := backend.Collect(ds.IterateHistory(ctx, key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(vals) != 1 {
+		t.Fatalf("want 1 historical entry, got %d", len(vals))
+	}
+
+	for _, v := range vals[0] {
+		if strings.Count(v, `"schema_version": 1`) != 2 {
+			t.Errorf("want the stored historical and record at schema version 1, got %s", v)
+		}
+	}
+
+	if n, err := MigrateSchema(ctx, ds); err != nil || n != 0 {
+		t.Errorf("want nothing left to migrate, got %d with error %v", n, err)
+	}
+}
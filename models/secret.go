@@ -1,6 +1,8 @@
 package models
 
 import (
+	"bytes"
+	"encoding/binary"
 	"encoding/json"
 
 	"github.com/pkg/errors"
@@ -13,6 +15,34 @@ type Secret struct {
 	App     string `json:"app_name"`
 	Env     string `json:"env"`
 	Content string `json:"content"`
+
+	//  Algorithm is the algorithm the content was encrypted with by the client
+	//  (see crypto.Algorithm), empty for secrets stored prior to it being
+	//  recorded
+	Algorithm string `json:"algorithm,omitempty"`
+
+	//  Signature is the client's signature of the content along with the ID,
+	//  app, environment, and algorithm (see Signed), empty if unsigned
+	Signature string `json:"signature,omitempty"`
+}
+
+//  signedContext separates signatures of secrets from any other use of the
+//  signing keys
+const signedContext string = "peppermint-sparkles secret v1"
+
+//  Signed returns the message the signature is of, the ID, app, environment,
+//  algorithm, and content, each length prefixed so that content cannot be moved
+//  between secrets, nor the algorithm it is decrypted with changed, without
+//  invalidating the signature
+func (s *Secret) Signed() []byte {
+	buf := new(bytes.Buffer)
+	for _, field := range []string{signedContext, s.Id, s.App, s.Env, s.Algorithm, s.Content} {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(field)))
+		buf.Write(n[:])
+		buf.WriteString(field)
+	}
+	return buf.Bytes()
 }
 
 func ParseSecret(raw string) (*Secret, error) {
@@ -23,3 +23,29 @@ func TestSecret(t *testing.T) {
 		t.Errorf("want: %s\n\ngot: %s", want, got)
 	}
 }
+
+func TestSigned(t *testing.T) {
+	s := &Secret{Id: "6f0f9805-08c6-48f2-b3c4-fe8e7c35ea4a", App: "dummy", Env: "test", Content: "notSuperS3cret"}
+	signed := string(s.Signed())
+
+	//  the signature is not part of the message signed
+	if other := (&Secret{Id: s.Id, App: s.App, Env: s.Env, Content: s.Content, Signature: "sig"}).Signed(); signed != string(other) {
+		t.Error("expected the signature to not change the message signed")
+	}
+
+	//  moving the content to another secret, changing the algorithm, or
+	//  shifting between fields, must change the message signed
+	for _, other := range []*Secret{
+		{Id: "other", App: s.App, Env: s.Env, Content: s.Content},
+		{Id: s.Id, App: "other", Env: s.Env, Content: s.Content},
+		{Id: s.Id, App: s.App, Env: "prod", Content: s.Content},
+		{Id: s.Id, App: s.App + s.Env, Env: "", Content: s.Content},
+		{Id: s.Id, App: s.App, Env: s.Env, Algorithm: "pgp", Content: s.Content},
+		{Id: s.Id, App: s.App, Env: s.Env + "pgp", Algorithm: "", Content: s.Content},
+		{Id: s.Id, App: s.App, Env: s.Env, Content: s.Content + "!"},
+	} {
+		if signed == string(other.Signed()) {
+			t.Errorf("%+v: expected a different message signed", other)
+		}
+	}
+}
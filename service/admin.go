@@ -0,0 +1,85 @@
+package service
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	"github.com/manulife-gwam/peppermint-sparkles/backend/backup"
+	"github.com/manulife-gwam/peppermint-sparkles/internal/respond"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const PathBackup string = "/api/v3/admin/backup"
+
+//	AdminHandler serves the administrative endpoints, authenticated by a
+//	bearer token.
+type AdminHandler struct {
+	//	Backend is backed up as is, so should be the raw datastore (i.e. not
+	//	wrapped for encryption at rest) to keep the values encrypted in the
+	//	archive.
+	Backend backend.Datastore
+
+	//	Token is the bearer token required by every request
+	Token string
+}
+
+//	HandleAdmin registers the admin endpoints. The request logging middleware
+//	is not used since it would log the token.
+func HandleAdmin(mux *http.ServeMux, h *AdminHandler) *http.ServeMux {
+	mux.Handle(PathBackup, h)
+	return mux
+}
+
+//	authorized reports if the request provides the admin token, compared in
+//	constant time
+func (h *AdminHandler) authorized(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || len(h.Token) < 1 {
+		return false
+	}
+
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) == 1
+}
+
+//	backup streams an unencrypted archive of the datastore. Since the response
+//	has been started by the time a failure occurs, the archive is left without
+//	its trailer which is reported as truncated when read.
+func (h *AdminHandler) backup(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	name := fmt.Sprintf("psparkles_%s.backup", time.Now().UTC().Format("20060102T150405Z"))
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+
+	sum, err := backup.Write(r.Context(), w, h.Backend, nil)
+	if err != nil {
+		log.Error(err, "unable to complete backup")
+		return
+	}
+
+	log.Infof("backup of %d records and %d historical entries complete", sum.Records, sum.History)
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Infof("Request - %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+
+	if !h.authorized(r) {
+		respond.WithUnauthorized(w, "a valid admin token is required")
+		return
+	}
+
+	switch {
+	case r.URL.Path == PathBackup && r.Method == http.MethodGet:
+		h.backup(w, r)
+
+	default:
+		respond.WithMethodNotAllowed(w)
+	}
+}
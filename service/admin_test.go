@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/manulife-gwam/peppermint-sparkles/backend/backup"
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+func TestBackup(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	raw := fmt.Sprintf(`{"id":"%s","app_name":"dummy","env":"test","content":"notSuperS3cret"}`, uuid.New().String())
+	src, err := models.ParseSecret(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UnixNano()
+	rec := &models.Record{
+		Secret:    src,
+		Created:   now,
+		CreatedBy: "tester",
+		Updated:   now,
+		UpdatedBy: "tester",
+		Status:    models.ActiveStatus,
+	}
+
+	if err := rec.Write(context.Background(), ds); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(HandleAdmin(http.NewServeMux(), &AdminHandler{Backend: ds, Token: "s3cret"}))
+	defer srv.Close()
+
+	tests := []struct {
+		method string
+		token  string
+		want   int
+	}{
+		{method: http.MethodGet, token: "", want: http.StatusUnauthorized},
+		{method: http.MethodGet, token: "wrong", want: http.StatusUnauthorized},
+		{method: http.MethodPost, token: "s3cret", want: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, token: "s3cret", want: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		req, err := http.NewRequest(tc.method, srv.URL+PathBackup, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(tc.token) > 0 {
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tc.token))
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != tc.want {
+			t.Errorf("%s with token %q: want status code %d, got %d", tc.method, tc.token, tc.want, res.StatusCode)
+		}
+
+		if res.StatusCode == http.StatusOK {
+			ar, err := backup.NewReader(res.Body, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			it := ar.Records()
+			for it.Next() {
+				if it.Key() != rec.Key() {
+					t.Errorf("want record key %s, got %s", rec.Key(), it.Key())
+				}
+			}
+
+			for it = ar.History(); it.Next(); {
+			}
+
+			if sum, err := ar.Summary(); err != nil || sum.Records != 1 {
+				t.Errorf("want 1 record, got %+v with error %v", sum, err)
+			}
+		}
+		res.Body.Close()
+	}
+}
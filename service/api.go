@@ -1,13 +1,16 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"sort"
 	"time"
 
 	"github.com/manulife-gwam/peppermint-sparkles/backend"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
 	"github.com/manulife-gwam/peppermint-sparkles/internal/respond"
 	"github.com/manulife-gwam/peppermint-sparkles/middleware"
 	"github.com/manulife-gwam/peppermint-sparkles/models"
@@ -25,12 +28,27 @@ const (
 	EnvParam  string = "env"
 	UserParam string = "username"
 	IdParam   string = "uuid"
+
+	//	ActionParam is the action recorded in the history for an update, either
+	//	models.UpdateAction (the default) or models.RotateAction
+	ActionParam string = "action"
+
+	//	PathHistory follows the secret ID for the history of the secret, i.e.
+	//	PathSecrets/<id>/history
+	PathHistory string = "history"
 )
 
-var idExp *regexp.Regexp = regexp.MustCompile(`secrets/(?P<id>([a-zA-Z\d]+(-)?){5})(\/)?$`)
+var (
+	idExp   *regexp.Regexp = regexp.MustCompile(`secrets/(?P<id>([a-zA-Z\d]+(-)?){5})(\/)?$`)
+	histExp *regexp.Regexp = regexp.MustCompile(`secrets/(?P<id>([a-zA-Z\d]+(-)?){5})/` + PathHistory + `(\/)?$`)
+)
 
 type Handler struct {
 	Backend backend.Datastore
+
+	//	Timeout is the max duration allowed for datastore calls made on behalf
+	//	of a single request. A zero value means no timeout is applied.
+	Timeout time.Duration
 }
 
 func Handle(mux *http.ServeMux, h *Handler) *http.ServeMux {
@@ -39,6 +57,52 @@ func Handle(mux *http.ServeMux, h *Handler) *http.ServeMux {
 	return mux
 }
 
+//	context returns the context to be used for datastore calls for the request
+func (h *Handler) context(r *http.Request) (context.Context, context.CancelFunc) {
+	if h.Timeout > 0 {
+		return context.WithTimeout(r.Context(), h.Timeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
+//	withBackendError responds with the relevant status code for the provided
+//	datastore error, ensuring backend failures are not reported as not found
+func withBackendError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case backend.IsNotFound(err):
+		respond.WithErrorMessage(w, http.StatusNotFound, "file not found")
+
+	case backend.IsExists(err):
+		respond.WithErrorMessage(w, http.StatusConflict, "record found for provided ID")
+
+	case backend.IsConflict(err):
+		respond.WithErrorMessage(w, http.StatusConflict, "record was modified by another request")
+
+	case errors.Cause(err) == context.DeadlineExceeded:
+		respond.WithError(w, http.StatusGatewayTimeout, err, message)
+
+	default:
+		respond.WithError(w, http.StatusInternalServerError, err, message)
+	}
+}
+
+//	describe records the algorithm the content is encrypted with, as detected
+//	from the content (without decrypting it), rejecting content which does not
+//	match the algorithm recorded by the client
+func describe(s *models.Secret) error {
+	detected := crypto.Detect([]byte(s.Content))
+
+	switch {
+	case len(detected) < 1:
+	case len(s.Algorithm) < 1:
+		s.Algorithm = detected
+	case s.Algorithm != detected:
+		return errors.Errorf("content is encrypted with %s rather than %s", detected, s.Algorithm)
+	}
+
+	return nil
+}
+
 func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
@@ -67,14 +131,18 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ds := h.Backend
-	raw := ds.Get(id)
-	if len(raw) < 1 {
-		respond.WithErrorMessage(w, http.StatusNotFound, "file not found")
+	ctx, cancel := h.context(r)
+	defer cancel()
+
+	//	records are stored by the key namespaced to the app and env, meaning a
+	//	mismatched app or env is indistinguishable from a missing record
+	raw, err := h.Backend.Get(ctx, backend.Key(app, env, id))
+	if err != nil {
+		withBackendError(w, err, "unable to retrieve secret")
 		return
 	}
 
-	rec, err := models.ParseRecord(raw)
+	rec, err := models.ParseRecord(string(raw))
 	if err != nil {
 		log.Error(err, "unable to parse stored secret")
 		respond.WithErrorMessage(w, http.StatusBadRequest, "invalid secret")
@@ -97,10 +165,85 @@ func (h *Handler) get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//	secrets stored prior to the algorithm being recorded
+	if len(rec.Algorithm) < 1 {
+		rec.Algorithm = crypto.Detect([]byte(rec.Content))
+	}
+
 	log.Debugf("retrieved secret with ID %s", id)
 	respond.WithJson(w, rec.Secret)
 }
 
+//	history responds with the historical entries of the secret, oldest first,
+//	which remain available once the secret is deleted. The content is as
+//	stored, encrypted with whichever keys were in use at the time.
+func (h *Handler) history(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	matches := histExp.FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		respond.WithErrorMessage(w, http.StatusBadRequest, "a valid ID must be specified")
+		return
+	}
+	id := matches[histExp.SubexpIndex("id")]
+
+	params := r.URL.Query()
+	app, env := params.Get(AppParam), params.Get(EnvParam)
+
+	if len(app) < 1 {
+		respond.WithErrorMessage(w, http.StatusBadRequest, "a valid app name must be specified")
+		return
+	}
+
+	if len(env) < 1 {
+		respond.WithErrorMessage(w, http.StatusBadRequest, "a valid environment must be specified")
+		return
+	}
+
+	ctx, cancel := h.context(r)
+	defer cancel()
+
+	entries := make([]*models.Historical, 0)
+
+	it := h.Backend.IterateHistory(ctx, backend.Key(app, env, id))
+	defer it.Close()
+
+	for it.Next() {
+		hist, err := models.ParseHistorical(string(it.Value()))
+		if err != nil {
+			respond.WithError(w, http.StatusInternalServerError, err, "unable to parse secret history")
+			return
+		}
+
+		if hist.Record == nil || hist.Secret == nil || hist.App != app || hist.Env != env {
+			continue
+		}
+
+		//	secrets stored prior to the algorithm being recorded
+		if len(hist.Algorithm) < 1 {
+			hist.Algorithm = crypto.Detect([]byte(hist.Content))
+		}
+		entries = append(entries, hist)
+	}
+
+	if err := it.Err(); err != nil {
+		withBackendError(w, err, "unable to retrieve secret history")
+		return
+	}
+
+	if len(entries) < 1 {
+		respond.WithErrorMessage(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Created < entries[j].Created
+	})
+
+	log.Debugf("retrieved %d historical entries for secret with ID %s", len(entries), id)
+	respond.WithJson(w, entries)
+}
+
 func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
@@ -113,6 +256,11 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//	the timeout applies to the datastore calls, not to reading in the
+	//	request, which may be streamed as it is encrypted
+	ctx, cancel := h.context(r)
+	defer cancel()
+
 	usr := params.Get(UserParam)
 	if len(usr) < 1 {
 		respond.WithErrorMessage(w, http.StatusBadRequest, "a valid user name must be provided")
@@ -143,6 +291,11 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := describe(s); err != nil {
+		respond.WithErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	now := time.Now().UnixNano()
 	rec := &models.Record{
 		Secret:    s,
@@ -153,14 +306,10 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 		Status:    models.ActiveStatus,
 	}
 
-	if rec.Exists(ds) {
-		respond.WithErrorMessage(w, http.StatusConflict, "record found for provided ID")
-		return
-	}
-
-	if err := rec.Write(ds); err != nil {
-		log.Error(err, "unable to write record to storage")
-		respond.WithErrorMessage(w, http.StatusInternalServerError, "unable to write secret record to storage")
+	//	the existence check and write are a single atomic operation to prevent
+	//	concurrent creates for the same ID from both succeeding
+	if err := rec.Create(ctx, ds); err != nil {
+		withBackendError(w, err, "unable to write secret record to storage")
 		return
 	}
 
@@ -168,7 +317,7 @@ func (h *Handler) create(w http.ResponseWriter, r *http.Request) {
 	respond.WithJsonCreated(w, s)
 }
 
-func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) update(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	matched, id, err := getId(r.URL.Path)
@@ -183,30 +332,124 @@ func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	in, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		log.Error(err, "unable to read in request body")
+		respond.WithErrorMessage(w, http.StatusBadRequest, "unable to read in request")
+		return
+	}
+
+	usr := r.URL.Query().Get(UserParam)
+	if len(usr) < 1 {
+		respond.WithErrorMessage(w, http.StatusBadRequest, "a valid user name must be provided")
+		return
+	}
+
+	action := r.URL.Query().Get(ActionParam)
+	switch action {
+	case "":
+		action = models.UpdateAction
+	case models.UpdateAction, models.RotateAction:
+	default:
+		respond.WithErrorMessage(w, http.StatusBadRequest, "action must be update or rotate")
+		return
+	}
+
+	s, err := models.ParseSecret(string(in))
+	if err != nil {
+		log.Error(err, "unable to unmarshal request to secret")
+		respond.WithErrorMessage(w, http.StatusBadRequest, "unable to convert request to valid secret")
+		return
+	}
+
+	if len(s.Id) > 0 && s.Id != id {
+		respond.WithErrorMessage(w, http.StatusBadRequest, "secret ID does not match the requested ID")
+		return
+	}
+	s.Id = id
+
+	if err := describe(s); err != nil {
+		respond.WithErrorMessage(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	ds := h.Backend
 
-	raw := ds.Get(id)
-	if len(raw) < 1 {
-		respond.WithErrorMessage(w, http.StatusNotFound, "file not found")
+	ctx, cancel := h.context(r)
+	defer cancel()
+
+	raw, err := ds.Get(ctx, backend.Key(s.App, s.Env, id))
+	if err != nil {
+		withBackendError(w, err, "unable to retrieve secret")
 		return
 	}
 
-	rec, err := models.ParseRecord(raw)
+	rec, err := models.ParseRecord(string(raw))
 	if err != nil {
 		log.Error(err, "unable to parse stored secret")
 		respond.WithErrorMessage(w, http.StatusBadRequest, "invalid secret")
 		return
 	}
 
+	if rec.App != s.App {
+		respond.WithErrorMessage(w, http.StatusBadRequest, "app ID and name are invalid")
+		return
+	}
+
+	if rec.Env != s.Env {
+		respond.WithErrorMessage(w, http.StatusBadRequest, "app ID and environment are invalid")
+		return
+	}
+
+	if rec.Status != models.ActiveStatus {
+		log.Infof("record for ID %s found, but has status %s", rec.Id, rec.Status)
+		respond.WithErrorMessage(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	rec.Secret = s
+	rec.Updated = time.Now().UnixNano()
+	rec.UpdatedBy = usr
+
+	//	only swap in the update if the record has not changed since retrieved
+	update := rec.Update
+	if action == models.RotateAction {
+		update = rec.Rotate
+	}
+
+	if err := update(ctx, ds, raw); err != nil {
+		withBackendError(w, err, "unable to update secret record in storage")
+		return
+	}
+
+	log.Debugf("%s of record with ID %s for user %s", action, s.Id, usr)
+	respond.WithJson(w, s)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	matched, id, err := getId(r.URL.Path)
+	if err != nil {
+		log.Error(err, "unable to retrieve the secret ID from the URL path")
+		respond.WithErrorMessage(w, http.StatusNotFound, "file not found")
+		return
+	}
+
+	if !matched {
+		respond.WithErrorMessage(w, http.StatusBadRequest, "a valid ID must be specified")
+		return
+	}
+
 	params := r.URL.Query()
 	app, env, usr := params.Get(AppParam), params.Get(EnvParam), params.Get(UserParam)
 
-	if len(app) < 1 || rec.App != app {
+	if len(app) < 1 {
 		respond.WithErrorMessage(w, http.StatusBadRequest, "invalid app name")
 		return
 	}
 
-	if len(env) < 1 || rec.Env != env {
+	if len(env) < 1 {
 		respond.WithErrorMessage(w, http.StatusBadRequest, "invalid app environment")
 		return
 	}
@@ -216,22 +459,40 @@ func (h *Handler) delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if rec.Status != models.ActiveStatus {
-		log.Infof("record for ID %s found, but has status %s", rec.Id, rec.Status)
-		respond.WithErrorMessage(w, http.StatusNotFound, "file not found")
+	ds := h.Backend
+
+	ctx, cancel := h.context(r)
+	defer cancel()
+
+	raw, err := ds.Get(ctx, backend.Key(app, env, id))
+	if err != nil {
+		withBackendError(w, err, "unable to retrieve secret")
+		return
+	}
+
+	rec, err := models.ParseRecord(string(raw))
+	if err != nil {
+		log.Error(err, "unable to parse stored secret")
+		respond.WithErrorMessage(w, http.StatusBadRequest, "invalid secret")
+		return
+	}
+
+	if rec.App != app || rec.Env != env {
+		respond.WithErrorMessage(w, http.StatusBadRequest, "invalid app name or environment")
 		return
 	}
 
-	histo := models.Historical{Record: rec}
-	if err := histo.Write(ds, models.DeleteAction, usr, time.Now().UnixNano()); err != nil {
-		log.Error(err, "unable to write record to history")
-		respond.WithError(w, http.StatusInternalServerError, err, "unable to delete secret")
+	if rec.Status != models.ActiveStatus {
+		log.Infof("record for ID %s found, but has status %s", rec.Id, rec.Status)
+		respond.WithErrorMessage(w, http.StatusNotFound, "file not found")
 		return
 	}
 
-	if err := rec.Rm(ds); err != nil {
+	//	the history and removal are written as a single atomic operation, only
+	//	if the record has not changed since retrieved
+	if err := rec.Delete(ctx, ds, raw, usr, time.Now().UnixNano()); err != nil {
 		log.Error(err, "unable to remove record from datastore")
-		respond.WithError(w, http.StatusInternalServerError, err, "unable to delete secrete")
+		withBackendError(w, err, "unable to delete secret")
 		return
 	}
 
@@ -260,11 +521,18 @@ func getId(path string) (bool, string, error) {
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
+		if histExp.MatchString(r.URL.Path) {
+			h.history(w, r)
+			return
+		}
 		h.get(w, r)
 
 	case http.MethodPost:
 		h.create(w, r)
 
+	case http.MethodPut:
+		h.update(w, r)
+
 	case http.MethodDelete:
 		h.delete(w, r)
 
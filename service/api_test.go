@@ -3,6 +3,8 @@ package service
 import (
 	"fmt"
 	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
@@ -27,6 +29,11 @@ func freeport() int {
 	return listener.Addr().(*net.TCPAddr).Port
 }
 
+//	serve starts a test server for the handler, which the caller closes
+func serve(h *Handler) *httptest.Server {
+	return httptest.NewServer(Handle(http.NewServeMux(), h))
+}
+
 func TestGetId(t *testing.T) {
 	want := "6f0f9805-08c6-48f2-b3c4-fe8e7c35ea4a"
 	m, got, err := getId(fmt.Sprintf("secrets/%s", want))
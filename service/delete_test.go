@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/manulife-gwam/peppermint-sparkles/backend"
 	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
 	"github.com/manulife-gwam/peppermint-sparkles/models"
 
@@ -50,7 +52,7 @@ func TestDelete(t *testing.T) {
 		Status:    models.ActiveStatus,
 	}
 
-	if err := rec.Write(ds); err != nil {
+	if err := rec.Write(context.Background(), ds); err != nil {
 		t.Fatal(err)
 	}
 
@@ -94,7 +96,7 @@ func TestDelete(t *testing.T) {
 		t.Fatalf("test service DELETE responded with status code %d and message %s", code, msg)
 	}
 
-	if raw := ds.Get(src.Id); len(raw) > 0 {
-		t.Errorf("the deleted secert id responded with %s", raw)
+	if raw, err := ds.Get(context.Background(), backend.Key(src.App, src.Env, src.Id)); err == nil || !backend.IsNotFound(err) {
+		t.Errorf("the deleted secert id responded with %s and error %v", raw, err)
 	}
 }
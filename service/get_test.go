@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
 	"github.com/manulife-gwam/peppermint-sparkles/models"
 
 	bolt "github.com/coreos/bbolt"
@@ -49,7 +51,7 @@ func TestGet(t *testing.T) {
 		Status:    models.ActiveStatus,
 	}
 
-	if err := rec.Write(ds); err != nil {
+	if err := rec.Write(context.Background(), ds); err != nil {
 		t.Fatal(err)
 	}
 
@@ -122,7 +124,7 @@ func TestInvalidGet(t *testing.T) {
 		Status:    models.ActiveStatus,
 	}
 
-	if err := rec.Write(ds); err != nil {
+	if err := rec.Write(context.Background(), ds); err != nil {
 		t.Fatal(err)
 	}
 
@@ -156,14 +158,14 @@ func TestInvalidGet(t *testing.T) {
 		&sample{
 			name:    "invalid_app_name",
 			from:    fmt.Sprintf("http://localhost:%d%s/%s?%s=%s&%s=%s", port, PathSecrets, src.Id, AppParam, "flerp", EnvParam, src.Env),
-			code:    http.StatusBadRequest,
-			message: "app ID and name are invalid",
+			code:    http.StatusNotFound,
+			message: "file not found",
 		},
 		&sample{
 			name:    "invalid_app_env",
 			from:    fmt.Sprintf("http://localhost:%d%s/%s?%s=%s&%s=%s", port, PathSecrets, src.Id, AppParam, src.App, EnvParam, "PROD"),
-			code:    http.StatusBadRequest,
-			message: "app ID and environment are invalid",
+			code:    http.StatusNotFound,
+			message: "file not found",
 		},
 	}
 
@@ -184,3 +186,104 @@ func TestInvalidGet(t *testing.T) {
 		}
 	}
 }
+
+func TestBackendFailureGet(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	//	close the datastore to force a backend failure rather than a not found
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := serve(&Handler{Backend: ds})
+	defer srv.Close()
+
+	res, err := http.Get(fmt.Sprintf("%s%s/%s?%s=dummy&%s=test", srv.URL, PathSecrets, uuid.New().String(), AppParam, EnvParam))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if want, got := http.StatusInternalServerError, res.StatusCode; want != got {
+		t.Errorf("\nwant %d\ngot  %d\n", want, got)
+	}
+}
+
+func TestAlgorithmGet(t *testing.T) {
+	e := crypto.NewEnvelope("test")
+	e.Nonce, e.Ciphertext = []byte("nonce"), []byte("ciphertext")
+	content, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//	stored prior to the algorithm being recorded
+	sample := fmt.Sprintf(`{"id":"%s","app_name":"dummy","env":"test","content":"%s"}`, uuid.New().String(), content)
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	src, err := models.ParseSecret(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UnixNano()
+	rec := &models.Record{
+		Secret:    src,
+		Created:   now,
+		CreatedBy: "tester",
+		Updated:   now,
+		UpdatedBy: "tester",
+		Status:    models.ActiveStatus,
+	}
+
+	if err := rec.Write(context.Background(), ds); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := serve(&Handler{Backend: ds})
+	defer srv.Close()
+
+	res, err := http.Get(fmt.Sprintf("%s%s/%s?%s=%s&%s=%s", srv.URL, PathSecrets, src.Id, AppParam, src.App, EnvParam, src.Env))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, msg := res.StatusCode, string(b); code != http.StatusOK {
+		t.Fatalf("test service GET responded with status code %d and message %s", code, msg)
+	}
+
+	s, err := models.ParseSecret(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "test", s.Algorithm; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+}
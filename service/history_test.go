@@ -0,0 +1,109 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+func TestHistory(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	srv := serve(&Handler{Backend: ds})
+	defer srv.Close()
+
+	id := uuid.New().String()
+	addr := fmt.Sprintf("%s%s", srv.URL, PathSecrets)
+	query := fmt.Sprintf("%s=dummy&%s=test&%s=tester", AppParam, EnvParam, UserParam)
+
+	call := func(method, url, body string) (int, string) {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, string(b)
+	}
+
+	history := fmt.Sprintf("%s/%s/%s?%s", addr, id, PathHistory, query)
+	if code, _ := call(http.MethodGet, history, ""); code != http.StatusNotFound {
+		t.Errorf("want status code %d for a secret without history, got %d", http.StatusNotFound, code)
+	}
+
+	for _, step := range []struct{ method, url, body string }{
+		{method: http.MethodPost, url: addr + "?" + query, body: fmt.Sprintf(`{"id":"%s","app_name":"dummy","env":"test","content":"first"}`, id)},
+		{method: http.MethodPut, url: fmt.Sprintf("%s/%s?%s", addr, id, query), body: `{"app_name":"dummy","env":"test","content":"second"}`},
+		{method: http.MethodDelete, url: fmt.Sprintf("%s/%s?%s", addr, id, query)},
+	} {
+		if code, msg := call(step.method, step.url, step.body); code < 200 || code > 299 {
+			t.Fatalf("test service %s responded with status code %d and message %s", step.method, code, msg)
+		}
+	}
+
+	//	the history remains available once deleted
+	code, msg := call(http.MethodGet, history, "")
+	if code != http.StatusOK {
+		t.Fatalf("test service GET responded with status code %d and message %s", code, msg)
+	}
+
+	entries := make([]*models.Historical, 0)
+	if err := json.Unmarshal([]byte(msg), &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ action, content string }{
+		{action: models.CreateAction, content: "first"},
+		{action: models.UpdateAction, content: "second"},
+		{action: models.DeleteAction, content: "second"},
+	}
+
+	if len(entries) != len(want) {
+		t.Fatalf("want %d historical entries, got %d", len(want), len(entries))
+	}
+
+	for i, e := range entries {
+		if want, got := want[i].action, e.Action; want != got {
+			t.Errorf("\nwant %s\ngot  %s\n", want, got)
+		}
+
+		if want, got := want[i].content, e.Content; want != got {
+			t.Errorf("\nwant %s\ngot  %s\n", want, got)
+		}
+	}
+
+	//	the history is scoped to the app and environment, as the secret is
+	other := fmt.Sprintf("%s/%s/%s?%s=other&%s=test", addr, id, PathHistory, AppParam, EnvParam)
+	if code, _ := call(http.MethodGet, other, ""); code != http.StatusNotFound {
+		t.Errorf("want status code %d for another app, got %d", http.StatusNotFound, code)
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"testing"
 
 	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/crypto"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
 
 	bolt "github.com/coreos/bbolt"
 	"github.com/google/uuid"
@@ -138,3 +140,129 @@ func TestInvalidIdPost(t *testing.T) {
 		}
 	}
 }
+
+func TestConflictPost(t *testing.T) {
+	sample := fmt.Sprintf(`{"id":"%s","app_name":"dummy","env":"test","content":"notSuperS3cret"}`, uuid.New().String())
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	srv := serve(&Handler{Backend: ds})
+	defer srv.Close()
+
+	//	fire concurrent creates for the same ID, only 1 should succeed
+	const attempts int = 10
+
+	codes := make(chan int, attempts)
+	for i := 0; i < attempts; i++ {
+		go func() {
+			res, err := http.Post(fmt.Sprintf("%s%s?%s=tester", srv.URL, PathSecrets, UserParam), "application/json", strings.NewReader(sample))
+			if err != nil {
+				codes <- 0
+				return
+			}
+			res.Body.Close()
+			codes <- res.StatusCode
+		}()
+	}
+
+	created, conflicts := 0, 0
+	for i := 0; i < attempts; i++ {
+		switch <-codes {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+			conflicts++
+		}
+	}
+
+	if want, got := 1, created; want != got {
+		t.Errorf("\nwant %d created\ngot  %d\n", want, got)
+	}
+
+	if want, got := attempts-1, conflicts; want != got {
+		t.Errorf("\nwant %d conflicts\ngot  %d\n", want, got)
+	}
+}
+
+func TestAlgorithmPost(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	srv := serve(&Handler{Backend: ds})
+	defer srv.Close()
+
+	e := crypto.NewEnvelope("test")
+	e.Nonce, e.Ciphertext = []byte("nonce"), []byte("ciphertext")
+	content, err := e.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		content   string
+		code      int
+		want      string
+	}{
+		{name: "detected", content: string(content), code: http.StatusCreated, want: "test"},
+		{name: "matching", algorithm: "test", content: string(content), code: http.StatusCreated, want: "test"},
+		{name: "mismatched", algorithm: "pgp", content: string(content), code: http.StatusBadRequest},
+		{name: "plaintext", content: "notSuperS3cret", code: http.StatusCreated},
+		{name: "unknown", algorithm: "rot13", content: "abcdef", code: http.StatusCreated, want: "rot13"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sample := fmt.Sprintf(`{"id":"%s","app_name":"dummy","env":"test","content":"%s","algorithm":"%s"}`, uuid.New().String(), tc.content, tc.algorithm)
+
+			res, err := http.Post(fmt.Sprintf("%s%s?%s=tester", srv.URL, PathSecrets, UserParam), "application/json", strings.NewReader(sample))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			b, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if code, msg := res.StatusCode, string(b); code != tc.code {
+				t.Fatalf("want status code %d, got %d with message %s", tc.code, code, msg)
+			}
+
+			if tc.code != http.StatusCreated {
+				return
+			}
+
+			s, err := models.ParseSecret(string(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := tc.want, s.Algorithm; want != got {
+				t.Errorf("\nwant %s\ngot  %s\n", want, got)
+			}
+		})
+	}
+}
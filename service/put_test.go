@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	fileds "github.com/manulife-gwam/peppermint-sparkles/backend/file"
+	"github.com/manulife-gwam/peppermint-sparkles/models"
+
+	bolt "github.com/coreos/bbolt"
+	"github.com/google/uuid"
+)
+
+func TestPut(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	app, env, usr := "dummy", "test", "tester"
+
+	sample := fmt.Sprintf(`{"id":"%s","app_name":"%s","env":"%s","content":"notSuperS3cret"}`, uuid.New().String(), app, env)
+	src, err := models.ParseSecret(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UnixNano()
+	rec := &models.Record{
+		Secret:    src,
+		Created:   now,
+		CreatedBy: usr,
+		Updated:   now,
+		UpdatedBy: usr,
+		Status:    models.ActiveStatus,
+	}
+
+	if err := rec.Create(context.Background(), ds); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := serve(&Handler{Backend: ds})
+	defer srv.Close()
+
+	updated := fmt.Sprintf(`{"id":"%s","app_name":"%s","env":"%s","content":"stillNotSuperS3cret"}`, src.Id, app, env)
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s%s/%s", srv.URL, PathSecrets, src.Id), strings.NewReader(updated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.URL.RawQuery = (&url.Values{UserParam: []string{usr}}).Encode()
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, msg := res.StatusCode, string(b); code != http.StatusOK {
+		t.Fatalf("test service PUT responded with status code %d and message %s", code, msg)
+	}
+
+	got, err := models.GetRecord(context.Background(), ds, src.App, src.Env, src.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "stillNotSuperS3cret", got.Content; want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+
+	//	history should contain both the create and the update
+	histo, err := ds.Historical(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := 2, len(histo); want != got {
+		t.Errorf("\nwant %d\ngot  %d\n", want, got)
+	}
+}
+
+func TestRotatePut(t *testing.T) {
+	repo := fmt.Sprintf("test_%s.db", uuid.New().String())
+	ds, err := fileds.Open(repo, bolt.DefaultOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ds.Close()
+		if err := os.RemoveAll(repo); err != nil {
+			t.Errorf("unable to remove temporary test repo %s\n", repo)
+		}
+	}()
+
+	app, env, usr := "dummy", "test", "tester"
+
+	sample := fmt.Sprintf(`{"id":"%s","app_name":"%s","env":"%s","content":"notSuperS3cret"}`, uuid.New().String(), app, env)
+	src, err := models.ParseSecret(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UnixNano()
+	rec := &models.Record{
+		Secret:    src,
+		Created:   now,
+		CreatedBy: usr,
+		Updated:   now,
+		UpdatedBy: usr,
+		Status:    models.ActiveStatus,
+	}
+
+	if err := rec.Create(context.Background(), ds); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := serve(&Handler{Backend: ds})
+	defer srv.Close()
+
+	tests := []struct {
+		action string
+		code   int
+	}{
+		{action: "bogus", code: http.StatusBadRequest},
+		{action: models.RotateAction, code: http.StatusOK},
+	}
+
+	for _, tc := range tests {
+		rotated := fmt.Sprintf(`{"id":"%s","app_name":"%s","env":"%s","content":"reEncryptedS3cret"}`, src.Id, app, env)
+		req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s%s/%s", srv.URL, PathSecrets, src.Id), strings.NewReader(rotated))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.URL.RawQuery = (&url.Values{UserParam: []string{usr}, ActionParam: []string{tc.action}}).Encode()
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code, msg := res.StatusCode, string(b); code != tc.code {
+			t.Fatalf("%s: want status code %d, got %d with message %s", tc.action, tc.code, code, msg)
+		}
+	}
+
+	//	history should contain the create and the rotation, in no particular
+	//	order
+	actions := make([]string, 0)
+
+	it := ds.IterateHistory(context.Background(), rec.Key())
+	for it.Next() {
+		h, err := models.ParseHistorical(string(it.Value()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		actions = append(actions, h.Action)
+	}
+	it.Close()
+
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(actions)
+	if want, got := fmt.Sprint([]string{models.CreateAction, models.RotateAction}), fmt.Sprint(actions); want != got {
+		t.Errorf("\nwant %s\ngot  %s\n", want, got)
+	}
+}